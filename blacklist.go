@@ -0,0 +1,229 @@
+package ledsim
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// BlacklistEntry describes a keyframe whose effect panicked. The keyframe
+// renders its fallback effect in its place, or nothing if it has none, until
+// the entry is cleared or retried.
+type BlacklistEntry struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Stage is where the effect panicked: OnEnter, Eval or Seek.
+	Stage   string    `json:"stage"`
+	Message string    `json:"message"`
+	Stack   string    `json:"stack"`
+	Time    time.Time `json:"time"`
+	// Fallback is the Go type of the fallback effect, or empty if there is
+	// none. FallbackError is set if the fallback panicked too, and then
+	// nothing is rendered.
+	Fallback      string `json:"fallback,omitempty"`
+	FallbackError string `json:"fallbackError,omitempty"`
+}
+
+type blacklistEntry struct {
+	BlacklistEntry
+	fallback Effect
+	// clearOnExit hides the entry, and removes it once the keyframe exits
+	clearOnExit bool
+}
+
+// SetFallback sets the effect rendered in place of a keyframe whose effect
+// panics, for keyframes without a Fallback of their own. fallback is called
+// once each time a keyframe is blacklisted, and can return nil for nothing.
+func (r *EffectsManager) SetFallback(fallback func(keyframe *Keyframe) Effect) {
+	r.fallback = fallback
+}
+
+// OnBlacklistChange sets a hook that's called with the blacklist whenever it
+// changes, such as to export metrics. It's called on the goroutine running
+// Evaluate, and must not block.
+func (r *EffectsManager) OnBlacklistChange(hook func(entries []BlacklistEntry)) {
+	r.blacklistHook = hook
+}
+
+// Blacklist returns the blacklisted keyframes, oldest first. It's safe to
+// call from any goroutine.
+func (r *EffectsManager) Blacklist() []BlacklistEntry {
+	r.index.mu.Lock()
+	defer r.index.mu.Unlock()
+
+	return append([]BlacklistEntry(nil), r.index.blacklist...)
+}
+
+// QueueClear queues removing the blacklist entry of the keyframe with the
+// given ID. A keyframe that's running keeps its fallback until it ends, and
+// runs its own effect the next time it starts.
+func (r *EffectsManager) QueueClear(id string) <-chan KeyframeEditResult {
+	return r.queue(func(system *System) (*Keyframe, error) {
+		keyframe, err := r.blacklisted(id)
+		if err != nil {
+			return nil, err
+		}
+
+		r.clear(keyframe)
+		return keyframe, nil
+	})
+}
+
+// QueueRetry queues removing the blacklist entry of the keyframe with the
+// given ID, and if it's running, entering its own effect again in place of
+// the fallback, seeked to where the keyframe is.
+func (r *EffectsManager) QueueRetry(id string) <-chan KeyframeEditResult {
+	return r.queue(func(system *System) (*Keyframe, error) {
+		keyframe, err := r.blacklisted(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if isKeyframeIn(keyframe, r.lastKeyframes) {
+			r.exitAnimations(keyframe, system)
+			r.lastKeyframes = removeKeyframe(r.lastKeyframes, keyframe)
+			r.resume[keyframe] = true
+		}
+		delete(r.blacklist, keyframe)
+		r.publishBlacklist()
+
+		return keyframe, nil
+	})
+}
+
+func (r *EffectsManager) blacklisted(id string) (*Keyframe, error) {
+	keyframe := r.ids[id]
+	if keyframe == nil {
+		return nil, fmt.Errorf("%w: %q", ErrKeyframeNotFound, id)
+	}
+
+	if entry := r.blacklist[keyframe]; entry == nil || entry.clearOnExit {
+		return nil, fmt.Errorf("%w: %q isn't blacklisted", ErrKeyframeNotFound, id)
+	}
+
+	return keyframe, nil
+}
+
+func removeKeyframe(keyframes []*Keyframe, keyframe *Keyframe) []*Keyframe {
+	result := make([]*Keyframe, 0, len(keyframes))
+	for _, k := range keyframes {
+		if k != keyframe {
+			result = append(result, k)
+		}
+	}
+	return result
+}
+
+// clear removes keyframe's blacklist entry, or if it's running, hides it
+// until the keyframe exits, so its fallback is exited rather than its own
+// effect.
+func (r *EffectsManager) clear(keyframe *Keyframe) {
+	entry := r.blacklist[keyframe]
+	if entry == nil {
+		return
+	}
+
+	if isKeyframeIn(keyframe, r.lastKeyframes) {
+		entry.clearOnExit = true
+	} else {
+		delete(r.blacklist, keyframe)
+	}
+	r.publishBlacklist()
+}
+
+// effect returns what keyframe renders: its own effect, its fallback if it's
+// blacklisted, or nil if neither can run.
+func (r *EffectsManager) effect(keyframe *Keyframe) Effect {
+	entry := r.blacklist[keyframe]
+	if entry == nil {
+		return keyframe.Effect
+	}
+	return entry.fallback
+}
+
+// recoverEffect recovers a panic from keyframe's effect during stage, and
+// blacklists the keyframe. If it was its fallback that panicked, the fallback
+// is dropped. It must be deferred directly.
+func (r *EffectsManager) recoverEffect(keyframe *Keyframe, stage string, system *System) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	stack := string(debug.Stack())
+
+	if entry := r.blacklist[keyframe]; entry != nil {
+		log.Printf("warn: panic %s with fallback of effect %q: %v\n%s",
+			stage, keyframe.Label, rec, stack)
+		log.Printf("warn: %q will render nothing", keyframe.Label)
+		entry.fallback = nil
+		entry.FallbackError = fmt.Sprint(rec)
+		r.publishBlacklist()
+		return
+	}
+
+	log.Printf("warn: panic %s with effect %q: %v\n%s",
+		stage, keyframe.Label, rec, stack)
+	log.Printf("warn: %q will be blacklisted", keyframe.Label)
+
+	r.blacklist[keyframe] = &blacklistEntry{
+		BlacklistEntry: BlacklistEntry{
+			ID:      keyframe.ID,
+			Label:   keyframe.Label,
+			Stage:   stage,
+			Message: fmt.Sprint(rec),
+			Stack:   stack,
+			Time:    time.Now(),
+		},
+	}
+	r.enterFallback(keyframe, system)
+	r.publishBlacklist()
+}
+
+// enterFallback enters the fallback of a keyframe that was just blacklisted.
+func (r *EffectsManager) enterFallback(keyframe *Keyframe, system *System) {
+	defer r.recoverEffect(keyframe, "OnEnter", system)
+
+	fallback := keyframe.Fallback
+	if fallback == nil && r.fallback != nil {
+		fallback = r.fallback(keyframe)
+	}
+	if fallback == nil {
+		return
+	}
+
+	log.Printf("warn: %q will render its fallback", keyframe.Label)
+	entry := r.blacklist[keyframe]
+	entry.fallback = fallback
+	entry.Fallback = fmt.Sprintf("%T", fallback)
+
+	rng := r.keyframeRand(keyframe)
+	r.active[keyframe] = &keyframeState{rng: rng}
+	SeedEffect(fallback, rng)
+	r.withTarget(keyframe, system, fallback.OnEnter)
+}
+
+// publishBlacklist shares the blacklist with other goroutines and the hook.
+func (r *EffectsManager) publishBlacklist() {
+	entries := make([]BlacklistEntry, 0, len(r.blacklist))
+	for _, entry := range r.blacklist {
+		if !entry.clearOnExit {
+			entries = append(entries, entry.BlacklistEntry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Time.Equal(entries[j].Time) {
+			return entries[i].Time.Before(entries[j].Time)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+
+	r.index.mu.Lock()
+	r.index.blacklist = entries
+	r.index.mu.Unlock()
+
+	if r.blacklistHook != nil {
+		r.blacklistHook(append([]BlacklistEntry(nil), entries...))
+	}
+}
@@ -0,0 +1,250 @@
+package ledsim
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// flakyEffect paints everything one colour, panicking in OnEnter or Eval
+// while it's told to, and counts its hooks.
+type flakyEffect struct {
+	color        colorful.Color
+	panicOnEnter bool
+	panicOnEval  bool
+	enters       int
+	exits        int
+	seeks        []float64
+}
+
+func (e *flakyEffect) OnEnter(system *System) {
+	e.enters++
+	if e.panicOnEnter {
+		panic("enter failed")
+	}
+}
+
+func (e *flakyEffect) Eval(progress float64, system *System) {
+	if e.panicOnEval {
+		panic("eval failed")
+	}
+	for _, led := range system.LEDs {
+		led.Color = e.color
+	}
+}
+
+func (e *flakyEffect) OnExit(system *System) { e.exits++ }
+
+func (e *flakyEffect) Seek(progress float64, system *System) {
+	e.seeks = append(e.seeks, progress)
+}
+
+// blacklistShow is a blue background under a keyframe running effect from
+// 1s to 5s, of a show 10s long.
+func blacklistShow(effect, fallback Effect) *EffectsManager {
+	return NewEffectsManager([]*Keyframe{
+		{ID: "background", Label: "background", Duration: 10 * time.Second, Effect: &solidEffect{blue}},
+		{ID: "flaky", Label: "flaky", Offset: time.Second, Duration: 4 * time.Second, Layer: 1,
+			Effect: effect, Fallback: fallback},
+	})
+}
+
+func checkColor(t *testing.T, system *System, at time.Duration, want colorful.Color) {
+	t.Helper()
+
+	for _, led := range system.LEDs {
+		if led.Color != want {
+			t.Fatalf("at %v led %d is %v, want %v", at, led.ID, led.Color, want)
+		}
+	}
+}
+
+func TestBlacklistFallback(t *testing.T) {
+	green := colorful.Color{G: 1}
+
+	tests := []struct {
+		name     string
+		effect   *flakyEffect
+		fallback *flakyEffect
+		// managerFallback is set with SetFallback
+		managerFallback *flakyEffect
+		stage           string
+		// want is what renders while the keyframe runs after it panicked
+		want colorful.Color
+	}{
+		{
+			name:     "eval",
+			effect:   &flakyEffect{color: red, panicOnEval: true},
+			fallback: &flakyEffect{color: green},
+			stage:    "Eval",
+			want:     green,
+		},
+		{
+			name:     "enter",
+			effect:   &flakyEffect{color: red, panicOnEnter: true},
+			fallback: &flakyEffect{color: green},
+			stage:    "OnEnter",
+			want:     green,
+		},
+		{
+			name:            "manager's fallback",
+			effect:          &flakyEffect{color: red, panicOnEval: true},
+			managerFallback: &flakyEffect{color: green},
+			stage:           "Eval",
+			want:            green,
+		},
+		{
+			name:   "no fallback",
+			effect: &flakyEffect{color: red, panicOnEval: true},
+			stage:  "Eval",
+			want:   blue,
+		},
+		{
+			name:     "fallback panics too",
+			effect:   &flakyEffect{color: red, panicOnEval: true},
+			fallback: &flakyEffect{color: green, panicOnEval: true},
+			stage:    "Eval",
+			want:     blue,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fallback Effect
+			if test.fallback != nil {
+				fallback = test.fallback
+			}
+			manager := blacklistShow(test.effect, fallback)
+			if test.managerFallback != nil {
+				manager.SetFallback(func(keyframe *Keyframe) Effect { return test.managerFallback })
+			}
+
+			var published []BlacklistEntry
+			manager.OnBlacklistChange(func(entries []BlacklistEntry) { published = entries })
+
+			system := pairSystem()
+			for _, at := range []time.Duration{0, 1 * time.Second, 1500 * time.Millisecond, 2 * time.Second} {
+				manager.Evaluate(system, at)
+			}
+			checkColor(t, system, 2*time.Second, test.want)
+
+			entries := manager.Blacklist()
+			if len(entries) != 1 || entries[0].ID != "flaky" || entries[0].Label != "flaky" || entries[0].Stage != test.stage {
+				t.Fatalf("blacklist = %+v, want flaky for panicking in %s", entries, test.stage)
+			}
+			if len(published) != 1 || published[0].ID != "flaky" {
+				t.Errorf("hook was given %+v, want the blacklist", published)
+			}
+
+			entry := entries[0]
+			fallbackType := ""
+			if test.fallback != nil || test.managerFallback != nil {
+				fallbackType = "*ledsim.flakyEffect"
+			}
+			if entry.Fallback != fallbackType {
+				t.Errorf("fallback = %q, want %q", entry.Fallback, fallbackType)
+			}
+			if wantError := test.fallback != nil && test.fallback.panicOnEval; (entry.FallbackError != "") != wantError {
+				t.Errorf("fallback error = %q, want one: %v", entry.FallbackError, wantError)
+			}
+
+			// it stays blacklisted after it ends, and when it's entered
+			// again its fallback is entered instead
+			for _, at := range []time.Duration{6 * time.Second, 9 * time.Second, 11 * time.Second, 12 * time.Second} {
+				manager.Evaluate(system, at)
+			}
+			checkColor(t, system, 12*time.Second, test.want)
+			if test.effect.enters != 1 {
+				t.Errorf("the effect was entered %d times, want only the first", test.effect.enters)
+			}
+			if len(manager.Blacklist()) != 1 {
+				t.Errorf("blacklist = %+v after the keyframe ran again, want it kept", manager.Blacklist())
+			}
+		})
+	}
+}
+
+func TestBlacklistClear(t *testing.T) {
+	effect := &flakyEffect{color: red, panicOnEval: true}
+	fallback := &flakyEffect{color: colorful.Color{G: 1}}
+	manager := blacklistShow(effect, fallback)
+	system := pairSystem()
+
+	for _, at := range []time.Duration{0, 1 * time.Second, 1500 * time.Millisecond} {
+		manager.Evaluate(system, at)
+	}
+
+	cleared := manager.QueueClear("flaky")
+	manager.Evaluate(system, 2*time.Second)
+	if res := <-cleared; res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if entries := manager.Blacklist(); len(entries) != 0 {
+		t.Errorf("blacklist = %+v after clearing, want it empty", entries)
+	}
+	// it can't be cleared or retried again
+	again := manager.QueueRetry("flaky")
+	manager.Evaluate(system, 2500*time.Millisecond)
+	if res := <-again; !errors.Is(res.Err, ErrKeyframeNotFound) {
+		t.Errorf("retrying a cleared keyframe = %v, want ErrKeyframeNotFound", res.Err)
+	}
+
+	// the fallback carries on until the keyframe exits
+	checkColor(t, system, 2500*time.Millisecond, fallback.color)
+	manager.Evaluate(system, 6*time.Second)
+	if fallback.exits != 1 || effect.exits != 0 {
+		t.Errorf("exited the fallback %d times and the effect %d, want only the fallback once", fallback.exits, effect.exits)
+	}
+
+	// next time round it runs its own effect
+	effect.panicOnEval = false
+	manager.Evaluate(system, 9*time.Second)
+	manager.Evaluate(system, 11*time.Second)
+	checkColor(t, system, 11*time.Second, effect.color)
+	if effect.enters != 2 {
+		t.Errorf("the effect was entered %d times, want again after clearing", effect.enters)
+	}
+}
+
+func TestBlacklistRetry(t *testing.T) {
+	effect := &flakyEffect{color: red, panicOnEval: true}
+	fallback := &flakyEffect{color: colorful.Color{G: 1}}
+	manager := blacklistShow(effect, fallback)
+	system := pairSystem()
+
+	for _, at := range []time.Duration{0, 1 * time.Second, 1500 * time.Millisecond} {
+		manager.Evaluate(system, at)
+	}
+
+	// fixed, so retrying brings it back where it would be
+	effect.panicOnEval = false
+	retried := manager.QueueRetry("flaky")
+	manager.Evaluate(system, 2*time.Second)
+	if res := <-retried; res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	if entries := manager.Blacklist(); len(entries) != 0 {
+		t.Errorf("blacklist = %+v after retrying, want it empty", entries)
+	}
+	if fallback.exits != 1 || effect.enters != 2 {
+		t.Errorf("fallback exited %d times and effect entered %d, want 1 and 2", fallback.exits, effect.enters)
+	}
+	// 2s is a quarter of the way through the keyframe
+	if !closeFloats(effect.seeks, []float64{0.25}) {
+		t.Errorf("the effect was seeked to %v, want [0.25]", effect.seeks)
+	}
+	checkColor(t, system, 2*time.Second, effect.color)
+
+	// retrying a keyframe that isn't blacklisted fails
+	again := manager.QueueRetry("background")
+	missing := manager.QueueClear("nope")
+	manager.Evaluate(system, 2500*time.Millisecond)
+	for _, result := range []<-chan KeyframeEditResult{again, missing} {
+		if res := <-result; !errors.Is(res.Err, ErrKeyframeNotFound) {
+			t.Errorf("edit = %v, want ErrKeyframeNotFound", res.Err)
+		}
+	}
+}
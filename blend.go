@@ -1,6 +1,11 @@
 package ledsim
 
-import "github.com/lucasb-eyer/go-colorful"
+import (
+	"fmt"
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
 
 var (
 	BlendHcl Blending = func(from colorful.Color, to colorful.Color, t float64) colorful.Color {
@@ -25,3 +30,70 @@ var (
 		return from.Clamped()
 	}
 )
+
+// blendChannels builds a Blending that combines each RGB channel of from
+// and to with op, then fades from towards the result by t.
+func blendChannels(op func(from, to float64) float64) Blending {
+	return func(from colorful.Color, to colorful.Color, t float64) colorful.Color {
+		return from.BlendRgb(colorful.Color{
+			R: op(from.R, to.R),
+			G: op(from.G, to.G),
+			B: op(from.B, to.B),
+		}, t).Clamped()
+	}
+}
+
+var (
+	BlendMultiplyRgb = blendChannels(func(from, to float64) float64 {
+		return from * to
+	})
+	BlendScreenRgb = blendChannels(func(from, to float64) float64 {
+		return 1 - (1-from)*(1-to)
+	})
+	BlendMaxRgb      = blendChannels(math.Max)
+	BlendMinRgb      = blendChannels(math.Min)
+	BlendSubtractRgb = blendChannels(func(from, to float64) float64 {
+		return from - to
+	})
+)
+
+// BlendMode is how a keyframe's output is composited onto the layers below
+// it.
+type BlendMode string
+
+const (
+	// BlendNone is the default: the effect writes straight over the layers
+	// below and may read them, as effects always have.
+	BlendNone     BlendMode = ""
+	BlendNormal   BlendMode = "normal"
+	BlendAdd      BlendMode = "add"
+	BlendMultiply BlendMode = "multiply"
+	BlendScreen   BlendMode = "screen"
+	BlendMax      BlendMode = "max"
+	BlendMin      BlendMode = "min"
+	BlendSubtract BlendMode = "subtract"
+)
+
+var blendModes = map[BlendMode]Blending{
+	BlendNormal:   BlendRgb,
+	BlendAdd:      BlendAdditiveRgb,
+	BlendMultiply: BlendMultiplyRgb,
+	BlendScreen:   BlendScreenRgb,
+	BlendMax:      BlendMaxRgb,
+	BlendMin:      BlendMinRgb,
+	BlendSubtract: BlendSubtractRgb,
+}
+
+// Blending returns the function that composites a layer of this mode, with
+// from being the layers below, to being the layer and t its opacity.
+func (m BlendMode) Blending() (Blending, error) {
+	if m == BlendNone {
+		return BlendRgb, nil
+	}
+
+	blending, found := blendModes[m]
+	if !found {
+		return nil, fmt.Errorf("unknown blend mode %q", string(m))
+	}
+	return blending, nil
+}
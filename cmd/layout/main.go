@@ -0,0 +1,194 @@
+// Command layout works with sculpture layout files.
+//
+//	layout convert [-ledpos f] [-mapping f] [-teensy f] [-o layout.json]
+//	layout validate [-layout f | -ledpos f -mapping f -teensy f] [tolerances]
+//	layout import [-pitch p] [-ip a,b] [-chains-per-pin n] [-join d] [-o layout.json] model.obj|model.ply
+//
+// convert reads the legacy ledpos.txt, mapping.txt and teensy.txt trio (the
+// embedded copies by default) and writes the equivalent structured layout.
+//
+// validate reports every geometry and mapping problem in a layout and exits
+// with status 1 if it finds any.
+//
+// import places LEDs along the polylines of an OBJ or PLY model and writes the
+// resulting structured layout, one chain per polyline.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"ledsim"
+	"ledsim/modelimport"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: layout convert|validate|import [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "convert":
+		err = convert(os.Args[2:])
+	case "validate":
+		err = validate(os.Args[2:])
+	case "import":
+		err = importModel(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "layout:", err)
+		os.Exit(1)
+	}
+}
+
+func legacyFlags(fs *flag.FlagSet) *ledsim.LayoutPaths {
+	paths := new(ledsim.LayoutPaths)
+	fs.StringVar(&paths.LEDPos, "ledpos", "", "LED positions file (default: embedded ledpos.txt)")
+	fs.StringVar(&paths.Mapping, "mapping", "", "extra edges file (default: embedded mapping.txt)")
+	fs.StringVar(&paths.Teensy, "teensy", "", "Teensy/pin assignment file (default: embedded teensy.txt)")
+	return paths
+}
+
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	paths := legacyFlags(fs)
+	out := fs.String("o", "", "output file (default: stdout)")
+	fs.Parse(args)
+
+	src, err := paths.Open()
+	if err != nil {
+		return err
+	}
+
+	layout, err := ledsim.ConvertLegacyLayout(src)
+	if err != nil {
+		return err
+	}
+
+	return writeLayout(layout, *out)
+}
+
+func writeLayout(layout *ledsim.Layout, out string) error {
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return layout.Encode(w)
+}
+
+func validate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	paths := legacyFlags(fs)
+	fs.StringVar(&paths.Layout, "layout", "", "structured JSON layout, used instead of -ledpos, -mapping and -teensy")
+	opts := &ledsim.LayoutCheckOptions{}
+	fs.Float64Var(&opts.MaxSnapDistance, "snap", 50, "maximum distance between a mapping endpoint and the led it snaps to")
+	fs.Float64Var(&opts.DuplicateDistance, "duplicate", 0.5, "leds closer than this are reported as duplicates")
+	fs.IntVar(&opts.MaxLEDsPerPin, "max-per-pin", ledsim.DefaultMaxLEDsPerPin, "maximum leds driven by one teensy pin")
+	fs.IntVar(&opts.ExpectedLEDs, "leds", 0, "expected total led count, 0 to skip (default: the embedded layout's count)")
+	fs.Parse(args)
+
+	// counting the embedded layout means parsing it, so only do it when
+	// it's needed
+	ledsSet := false
+	fs.Visit(func(f *flag.Flag) {
+		ledsSet = ledsSet || f.Name == "leds"
+	})
+	if !ledsSet {
+		opts.ExpectedLEDs = ledsim.EmbeddedLEDCount()
+	}
+
+	var problems []ledsim.LayoutProblem
+	if paths.Layout != "" {
+		f, err := os.Open(paths.Layout)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		layout, err := ledsim.DecodeLayout(f)
+		if err != nil {
+			return err
+		}
+
+		problems, err = ledsim.CheckStructuredLayout(layout, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		src, err := paths.Open()
+		if err != nil {
+			return err
+		}
+
+		problems, err = ledsim.CheckLegacyLayout(src, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+
+	fmt.Println("layout ok")
+	return nil
+}
+
+func importModel(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	opts := &modelimport.Options{}
+	fs.Float64Var(&opts.Pitch, "pitch", 16.6667, "distance between leds in model units (default: 60 leds/m in millimetres)")
+	ips := fs.String("ip", "169.254.2.1", "comma separated controller IPs, filled in order")
+	fs.IntVar(&opts.PinsPerController, "pins", modelimport.DefaultPinsPerController, "output pins per controller")
+	fs.IntVar(&opts.ChainsPerPin, "chains-per-pin", 1, "chains daisy chained on each pin")
+	fs.Float64Var(&opts.JoinDistance, "join", 0, "join polyline ends to the nearest led on another polyline within this distance, 0 to disable")
+	out := fs.String("o", "", "output file (default: stdout)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("import takes exactly one model file")
+	}
+	opts.Controllers = strings.Split(*ips, ",")
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	polylines, err := modelimport.Read(fs.Arg(0), f)
+	if err != nil {
+		return err
+	}
+
+	layout, err := modelimport.BuildLayout(polylines, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "imported %d polylines as %d leds\n", len(layout.Chains), len(layout.LEDs))
+
+	return writeLayout(layout, *out)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -27,13 +28,64 @@ import (
 const frameRate = 30
 
 func main() {
+	configPath := flag.String("config", "", "JSON file naming the layout, ledpos, mapping, teensy and timings files to load")
+	layoutPath := flag.String("layout", "", "structured JSON layout, used instead of -ledpos, -mapping and -teensy")
+	ledposPath := flag.String("ledpos", "", "LED positions file (default: embedded ledpos.txt)")
+	mappingPath := flag.String("mapping", "", "extra edges file (default: embedded mapping.txt)")
+	teensyPath := flag.String("teensy", "", "Teensy/pin assignment file (default: embedded teensy.txt)")
+	timingsPath := flag.String("timings", "", "effect timings file (default: embedded timings.txt)")
+	keyframesPath := flag.String("keyframes", "", "JSON keyframes file, used instead of generating effects from the timings")
+	endMode := flag.String("end", "once", "what to do at the end of the timeline: loop, once (turn the LEDs off and quit), hold (keep the last frame) or handoff (play -idle)")
+	idlePath := flag.String("idle", "", "JSON keyframes file looped after the timeline ends, with -end handoff")
+	cuesPath := flag.String("cues", "", "JSON cues file, run by hand from the control panel instead of playing the timeline to timecode")
+	crossfade := flag.Duration("crossfade", 2*time.Second, "crossfade between cues that don't set their own")
+	fallback := flag.String("fallback", "", "effect to render in place of keyframes whose effects panic, built with its default params (default: none)")
+	seed := flag.Int64("seed", 0, "show seed, the same seed renders the same show (default: picked at random)")
+	normalizeMode := flag.String("normalize", "per-axis", "coordinate normalisation: per-axis (stretch each axis to 0..1) or uniform (keep proportions, centred)")
+	normalizeAxes := flag.String("axes", "xyz", "physical axes that become x, y and z, e.g. xzy to swap y and z")
+	normalizeFlip := flag.String("flip", "x", "normalised axes to mirror, e.g. x or xz")
+	flag.Parse()
+	args := flag.Args()
+
+	layoutPaths := new(ledsim.LayoutPaths)
+	if *configPath != "" {
+		var err error
+		layoutPaths, err = ledsim.ReadLayoutPaths(*configPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// flags take priority over the config file
+	for _, override := range []struct {
+		flag   string
+		target *string
+	}{
+		{*layoutPath, &layoutPaths.Layout},
+		{*ledposPath, &layoutPaths.LEDPos},
+		{*mappingPath, &layoutPaths.Mapping},
+		{*teensyPath, &layoutPaths.Teensy},
+		{*timingsPath, &layoutPaths.Timings},
+	} {
+		if override.flag != "" {
+			*override.target = override.flag
+		}
+	}
+
+	normalization, err := ledsim.ParseNormalizeOptions(*normalizeMode, *normalizeAxes, *normalizeFlip)
+	if err != nil {
+		panic(err)
+	}
+
 	sys := ledsim.NewSystem()
-	ledsim.LoadLEDs(sys)
+	sys.Normalization = normalization
+	if err := layoutPaths.Load(sys); err != nil {
+		panic(fmt.Errorf("load layout: %w", err))
+	}
 
 	var player *mpv.Player
-	var err error
-	if len(os.Args) >= 2 {
-		player, err = mpv.NewPlayer(os.Args[1], os.Getenv("MPV_ARGS"), len(os.Args) >= 3)
+	if len(args) >= 1 {
+		player, err = mpv.NewPlayer(args[0], os.Getenv("MPV_ARGS"), len(args) >= 2)
 		if err != nil {
 			panic(err)
 		}
@@ -42,20 +94,87 @@ func main() {
 		log.Println("warn: running without audio/mpv")
 	}
 
-	timings, err := generator.ParseTimings(bytes.NewReader(ledsim.TimingData))
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	log.Println("seed:", *seed)
+
+	var keyframes []*ledsim.Keyframe
+	if *keyframesPath != "" {
+		f, err := os.Open(*keyframesPath)
+		if err != nil {
+			panic(err)
+		}
+		keyframes, err = effects.LoadKeyframes(f, sys)
+		f.Close()
+		if err != nil {
+			panic(fmt.Errorf("load keyframes: %w", err))
+		}
+	} else {
+		timingData, err := layoutPaths.ReadTimings()
+		if err != nil {
+			panic(err)
+		}
+
+		timings, err := generator.ParseTimings(bytes.NewReader(timingData))
+		if err != nil {
+			panic(fmt.Errorf("parse timings: %w", err))
+		}
+
+		gen := generator.NewGenerator([]generator.GeneratableEffect{
+			effects.AvoidingSnakeGenerator,
+			effects.SparkleGenerator,
+			effects.ColourShiftGenerator,
+			effects.SegmentGenerator,
+			effects.PulseGenerator,
+			effects.FillUpGenerator,
+		})
+		keyframes = gen.Generate(timings, *seed) // generate some effects
+	}
+
+	manager := ledsim.NewEffectsManager(keyframes)
+	manager.SetSeed(*seed)
+
+	end, err := ledsim.ParseEndMode(*endMode)
 	if err != nil {
-		panic(fmt.Errorf("parse timings: %w", err))
+		panic(err)
 	}
+	if end == ledsim.EndHandoff {
+		if *idlePath == "" {
+			panic("-end handoff needs an -idle keyframes file")
+		}
 
-	gen := generator.NewGenerator([]generator.GeneratableEffect{
-		effects.AvoidingSnakeGenerator,
-		effects.SparkleGenerator,
-		effects.ColourShiftGenerator,
-		effects.SegmentGenerator,
-		effects.PulseGenerator,
-		effects.FillUpGenerator,
-	})
-	keyframes := gen.Generate(timings, time.Now().UnixNano()) // generate some effects
+		f, err := os.Open(*idlePath)
+		if err != nil {
+			panic(err)
+		}
+		idleKeyframes, err := effects.LoadKeyframes(f, sys)
+		f.Close()
+		if err != nil {
+			panic(fmt.Errorf("load idle keyframes: %w", err))
+		}
+
+		idle := ledsim.NewEffectsManager(idleKeyframes)
+		idle.SetSeed(*seed)
+		manager.SetEndMode(end, idle)
+	} else {
+		manager.SetEndMode(end)
+	}
+
+	if *fallback != "" {
+		if _, err := effects.Build(*fallback, sys, time.Second, nil); err != nil {
+			panic(fmt.Errorf("fallback: %w", err))
+		}
+
+		manager.SetFallback(func(keyframe *ledsim.Keyframe) ledsim.Effect {
+			effect, err := effects.Build(*fallback, sys, keyframe.Duration, nil)
+			if err != nil {
+				log.Println("warn: building fallback:", err)
+				return nil
+			}
+			return effect
+		})
+	}
 
 	e := echo.New()
 
@@ -85,7 +204,34 @@ func main() {
 	})
 
 	control_panel.InitControlPanel(e)
+	control_panel.InitTimeline(e, manager)
+	control_panel.InitBlacklist(e, manager)
+
+	var cueList *ledsim.CueList
+	if *cuesPath != "" {
+		f, err := os.Open(*cuesPath)
+		if err != nil {
+			panic(err)
+		}
+		// the show cue follows the audio, which only plays once it's gone to
+		var clock []ledsim.CueClock
+		if player != nil {
+			clock = append(clock, player)
+		}
+		cues, err := effects.LoadCues(f, sys, manager, *seed, clock...)
+		f.Close()
+		if err != nil {
+			panic(fmt.Errorf("load cues: %w", err))
+		}
+
+		cueList, err = ledsim.NewCueList(cues, *crossfade)
+		if err != nil {
+			panic(err)
+		}
+		control_panel.InitCues(e, cueList)
+	}
 	metrics.StartMetrics()
+	metrics.WatchBlacklist(manager)
 
 	mirage := outputs.NewMirage(e)
 
@@ -380,8 +526,13 @@ func main() {
 	_ = mainEffects
 	_ = testEffects
 
+	var runner ledsim.Middleware = ledsim.NewEffectsRunner(manager, getTimestamp)
+	if cueList != nil {
+		runner = cueList
+	}
+
 	pipeline := []ledsim.Middleware{
-		ledsim.NewEffectsRunner(ledsim.NewEffectsManager(keyframes), getTimestamp),
+		runner,
 		ledsim.NewOutput(mirage),
 	}
 
@@ -406,12 +557,7 @@ func main() {
 	executor := ledsim.NewExecutor(sys, frameRate, pipeline...) // ledsim.TimingStats{},
 	// ledsim.StallCheck{},
 
-	timeout := 650 * time.Second
-	if player == nil {
-		timeout = 643 * time.Second
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithCancel(context.Background())
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -430,7 +576,8 @@ func main() {
 		}
 	}()
 
-	if player != nil {
+	// with cues, the audio waits for the show cue
+	if player != nil && cueList == nil {
 		err = player.Play()
 		if err != nil {
 			panic(err)
@@ -439,19 +586,15 @@ func main() {
 
 	log.Println("running")
 
-	if player != nil {
+	// cues run until they're stopped by hand
+	if end == ledsim.EndOnce && cueList == nil {
 		go func() {
 			t := time.NewTicker(time.Millisecond * 500)
 			for {
 				select {
 				case <-t.C:
-					dur, err := player.GetTimestamp()
-					if err != nil {
-						continue
-					}
-
-					if dur >= 642*time.Second {
-						log.Println("reached end of file, quitting...")
+					if manager.Finished() {
+						log.Println("reached end of timeline, quitting...")
 						cancel()
 						return
 					}
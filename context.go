@@ -0,0 +1,154 @@
+package ledsim
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// EvalContext is what a ContextEffect is evaluated with.
+type EvalContext struct {
+	// Progress is how far through the effect it is, from 0 to 1.
+	Progress float64
+	// Duration is how long the effect lasts and Elapsed how far into it it
+	// is. They follow Progress, so an effect inside WithRepetition or a
+	// Sequence sees the length of its own repetition or step. Duration is 0
+	// if the effect is evaluated with only a progress.
+	Duration time.Duration
+	Elapsed  time.Duration
+	// Delta is the real time since the keyframe was last evaluated, or 0 on
+	// its first frame. Wrappers never change it, so physics can step by it.
+	Delta time.Duration
+	// ShowTime is the time the manager was evaluated at.
+	ShowTime time.Duration
+	// Frame counts the manager's evaluations, from 0.
+	Frame int
+	// Rand is the keyframe's seeded generator, see Randomized.
+	Rand *rand.Rand
+}
+
+// ProgressContext is the context for an effect evaluated with only a
+// progress, outside of a manager.
+func ProgressContext(progress float64) *EvalContext {
+	return &EvalContext{Progress: progress}
+}
+
+// sub returns the context for a child effect running at progress over
+// fraction of ctx's duration.
+func (ctx *EvalContext) sub(progress, fraction float64) *EvalContext {
+	child := *ctx
+	child.Progress = progress
+	child.Duration = time.Duration(math.Round(float64(ctx.Duration) * fraction))
+	child.Elapsed = time.Duration(math.Round(float64(child.Duration) * progress))
+	return &child
+}
+
+// ContextEffect is an effect that is evaluated with an EvalContext instead of
+// only a progress.
+type ContextEffect interface {
+	OnEnter(system *System)
+	EvalContext(ctx *EvalContext, system *System)
+	OnExit(system *System)
+}
+
+// contextEvaluator is implemented by ContextEffects and by every wrapper, so
+// contexts are passed through to the effects they wrap.
+type contextEvaluator interface {
+	EvalContext(ctx *EvalContext, system *System)
+}
+
+// EvalWith evaluates effect with ctx if it takes a context, or with
+// ctx.Progress if it doesn't. Effects that wrap others should use it to pass
+// their context on.
+func EvalWith(effect interface{}, ctx *EvalContext, system *System) {
+	switch e := effect.(type) {
+	case contextEvaluator:
+		e.EvalContext(ctx, system)
+	case Effect:
+		e.Eval(ctx.Progress, system)
+	}
+}
+
+type contextEffectWrapper struct {
+	effect ContextEffect
+	rng    *rand.Rand
+}
+
+func (w *contextEffectWrapper) OnEnter(system *System) {
+	w.effect.OnEnter(system)
+}
+
+func (w *contextEffectWrapper) OnExit(system *System) {
+	w.effect.OnExit(system)
+}
+
+func (w *contextEffectWrapper) SetRand(rng *rand.Rand) {
+	w.rng = rng
+	SeedEffect(w.effect, rng)
+}
+
+func (w *contextEffectWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, progress, system)
+}
+
+func (w *contextEffectWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
+func (w *contextEffectWrapper) Eval(progress float64, system *System) {
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *contextEffectWrapper) EvalContext(ctx *EvalContext, system *System) {
+	if ctx.Rand == nil {
+		if w.rng == nil {
+			w.rng = rand.New(rand.NewSource(rand.Int63()))
+		}
+		ctx.Rand = w.rng
+	}
+	w.effect.EvalContext(ctx, system)
+}
+
+// NewContextEffect adapts a ContextEffect so it can be used in a Keyframe or
+// with any of the WrappedEffect helpers.
+func NewContextEffect(effect ContextEffect) WrappedEffect {
+	return WrappedEffect{&contextEffectWrapper{
+		effect: effect,
+	}}
+}
+
+type effectContextWrapper struct {
+	effect Effect
+}
+
+func (w *effectContextWrapper) OnEnter(system *System) {
+	w.effect.OnEnter(system)
+}
+
+func (w *effectContextWrapper) OnExit(system *System) {
+	w.effect.OnExit(system)
+}
+
+func (w *effectContextWrapper) SetRand(rng *rand.Rand) {
+	SeedEffect(w.effect, rng)
+}
+
+func (w *effectContextWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, progress, system)
+}
+
+func (w *effectContextWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
+func (w *effectContextWrapper) EvalContext(ctx *EvalContext, system *System) {
+	EvalWith(w.effect, ctx, system)
+}
+
+// AsContextEffect adapts an ordinary Effect to a ContextEffect, which is
+// evaluated with the context's progress.
+func AsContextEffect(effect Effect) ContextEffect {
+	return &effectContextWrapper{
+		effect: effect,
+	}
+}
@@ -0,0 +1,150 @@
+package ledsim
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// contextRecorder records the context it was last evaluated with.
+type contextRecorder struct {
+	ctx *EvalContext
+}
+
+func (e *contextRecorder) OnEnter(system *System) {}
+func (e *contextRecorder) EvalContext(ctx *EvalContext, system *System) {
+	e.ctx = ctx
+}
+func (e *contextRecorder) OnExit(system *System) {}
+
+func TestEvalContextWrappers(t *testing.T) {
+	tests := []struct {
+		name string
+		// wrap builds the effect around a and b, the recorders
+		wrap     func(a, b Effect) Effect
+		progress float64
+		// want is what the recorder that runs is evaluated with
+		want EvalContext
+		// inB is whether it's b that runs
+		inB bool
+	}{
+		{
+			name:     "sequential",
+			wrap:     func(a, b Effect) Effect { return Sequential(a, b) },
+			progress: 0.75,
+			want:     EvalContext{Progress: 0.5, Duration: 5 * time.Second, Elapsed: 2500 * time.Millisecond},
+			inB:      true,
+		},
+		{
+			name:     "sequence",
+			wrap:     func(a, b Effect) Effect { return Sequence(Step(1, a), Step(3, b)) },
+			progress: 0.5,
+			want:     EvalContext{Progress: 1.0 / 3, Duration: 7500 * time.Millisecond, Elapsed: 2500 * time.Millisecond},
+			inB:      true,
+		},
+		{
+			name:     "repetition",
+			wrap:     func(a, b Effect) Effect { return WrappedEffect{a}.WithRepetition(4) },
+			progress: 0.3,
+			want:     EvalContext{Progress: 0.2, Duration: 2500 * time.Millisecond, Elapsed: 500 * time.Millisecond},
+		},
+		{
+			name:     "repetition reversed",
+			wrap:     func(a, b Effect) Effect { return WrappedEffect{a}.WithRepetition(2, true) },
+			progress: 0.3,
+			want:     EvalContext{Progress: 0.8, Duration: 2500 * time.Millisecond, Elapsed: 2 * time.Second},
+		},
+		{
+			name:     "reverse",
+			wrap:     func(a, b Effect) Effect { return WrappedEffect{a}.Reverse() },
+			progress: 0.25,
+			want:     EvalContext{Progress: 0.75, Duration: 10 * time.Second, Elapsed: 7500 * time.Millisecond},
+		},
+		{
+			name:     "crossfade",
+			wrap:     func(a, b Effect) Effect { return Crossfade(a, b, BlendRgb) },
+			progress: 0.3,
+			want:     EvalContext{Progress: 0.3, Duration: 10 * time.Second, Elapsed: 3 * time.Second},
+			inB:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := &contextRecorder{}, &contextRecorder{}
+			effect := test.wrap(NewContextEffect(a), NewContextEffect(b))
+
+			system := pairSystem()
+			effect.OnEnter(system)
+			EvalWith(effect, &EvalContext{
+				Progress: test.progress,
+				Duration: 10 * time.Second,
+				Elapsed:  time.Duration(test.progress * float64(10*time.Second)),
+				Delta:    40 * time.Millisecond,
+				ShowTime: time.Minute,
+				Frame:    7,
+			}, system)
+
+			got := a.ctx
+			if test.inB {
+				got = b.ctx
+			}
+			if got == nil {
+				t.Fatal("the effect wasn't evaluated with a context")
+			}
+
+			if math.Abs(got.Progress-test.want.Progress) > 1e-9 || got.Duration != test.want.Duration || got.Elapsed != test.want.Elapsed {
+				t.Errorf("evaluated at %v, %v of %v, want %v, %v of %v",
+					got.Progress, got.Elapsed, got.Duration, test.want.Progress, test.want.Elapsed, test.want.Duration)
+			}
+			// the real time between frames is never scaled
+			if got.Delta != 40*time.Millisecond || got.ShowTime != time.Minute || got.Frame != 7 {
+				t.Errorf("evaluated with delta %v, show time %v, frame %d, want them passed through unchanged",
+					got.Delta, got.ShowTime, got.Frame)
+			}
+		})
+	}
+}
+
+func TestManagerContext(t *testing.T) {
+	recorder := &contextRecorder{}
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "a", Offset: 500 * time.Millisecond, Duration: 4 * time.Second, Effect: NewContextEffect(recorder)},
+	})
+	system := pairSystem()
+
+	steps := []struct {
+		delta time.Duration
+		want  EvalContext
+	}{
+		// not running yet
+		{delta: 0},
+		// the first frame of a keyframe has no delta
+		{delta: 1500 * time.Millisecond, want: EvalContext{Progress: 0.25, Elapsed: time.Second, ShowTime: 1500 * time.Millisecond, Frame: 1}},
+		{delta: 1540 * time.Millisecond, want: EvalContext{Progress: 0.26, Elapsed: 1040 * time.Millisecond,
+			Delta: 40 * time.Millisecond, ShowTime: 1540 * time.Millisecond, Frame: 2}},
+	}
+
+	for _, step := range steps {
+		recorder.ctx = nil
+		manager.Evaluate(system, step.delta)
+		if step.want.ShowTime == 0 {
+			if recorder.ctx != nil {
+				t.Fatalf("at %v the keyframe was evaluated before it started", step.delta)
+			}
+			continue
+		}
+
+		got := recorder.ctx
+		if got == nil {
+			t.Fatalf("at %v the keyframe wasn't evaluated", step.delta)
+		}
+		if math.Abs(got.Progress-step.want.Progress) > 1e-9 || got.Duration != 4*time.Second || got.Elapsed != step.want.Elapsed ||
+			got.Delta != step.want.Delta || got.ShowTime != step.want.ShowTime || got.Frame != step.want.Frame {
+			t.Errorf("at %v the context is %+v, want %+v with a duration of 4s", step.delta, *got, step.want)
+		}
+		if got.Rand == nil {
+			t.Errorf("at %v the context has no generator", step.delta)
+		}
+	}
+}
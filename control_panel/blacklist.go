@@ -0,0 +1,25 @@
+package control_panel
+
+import (
+	"net/http"
+
+	"ledsim"
+
+	"github.com/labstack/echo/v4"
+)
+
+// InitBlacklist adds endpoints to list the keyframes whose effects panicked,
+// with the panic message and stack, and to clear or retry them.
+func InitBlacklist(e *echo.Echo, manager *ledsim.EffectsManager) {
+	e.GET(CONTROL_SUBDIRECTORY+"/blacklist", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, manager.Blacklist())
+	})
+
+	e.DELETE(CONTROL_SUBDIRECTORY+"/blacklist/:id", func(c echo.Context) error {
+		return waitForEdit(c, http.StatusNoContent, manager.QueueClear(c.Param("id")), false)
+	})
+
+	e.POST(CONTROL_SUBDIRECTORY+"/blacklist/:id/retry", func(c echo.Context) error {
+		return waitForEdit(c, http.StatusNoContent, manager.QueueRetry(c.Param("id")), false)
+	})
+}
@@ -0,0 +1,47 @@
+package control_panel
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ledsim"
+
+	"github.com/labstack/echo/v4"
+)
+
+// panicEffect panics whenever it's evaluated.
+type panicEffect struct{}
+
+func (e *panicEffect) OnEnter(system *ledsim.System)                {}
+func (e *panicEffect) Eval(progress float64, system *ledsim.System) { panic("broken") }
+func (e *panicEffect) OnExit(system *ledsim.System)                 {}
+
+func TestBlacklist(t *testing.T) {
+	manager := ledsim.NewEffectsManager([]*ledsim.Keyframe{
+		{ID: "a", Label: "broken a", Duration: time.Hour, Effect: &panicEffect{}},
+		{ID: "b", Label: "broken b", Duration: time.Hour, Effect: &panicEffect{}},
+	})
+	renderLoop(t, manager)
+
+	e := echo.New()
+	InitBlacklist(e, manager)
+
+	// wait for both to be blacklisted
+	for deadline := time.Now().Add(5 * time.Second); len(manager.Blacklist()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("blacklist = %+v, want a and b", manager.Blacklist())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	serve(t, e, []request{
+		{"GET", "/control/blacklist", "", http.StatusOK, `"label":"broken a","stage":"Eval","message":"broken"`},
+		// running keyframes are cleared when they end, but they leave
+		// the list straight away
+		{"DELETE", "/control/blacklist/a", "", http.StatusNoContent, ""},
+		{"DELETE", "/control/blacklist/a", "", http.StatusNotFound, "isn't blacklisted"},
+		{"POST", "/control/blacklist/nope/retry", "", http.StatusNotFound, "keyframe not found"},
+		{"GET", "/control/blacklist", "", http.StatusOK, `[{"id":"b"`},
+	})
+}
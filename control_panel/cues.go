@@ -0,0 +1,66 @@
+package control_panel
+
+import (
+	"net/http"
+
+	"ledsim"
+	"ledsim/effects"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CueInfo is how the state of the cue list is shown.
+type CueInfo struct {
+	Cues    []string         `json:"cues"`
+	Current string           `json:"current"`
+	Next    string           `json:"next"`
+	Fading  string           `json:"fading,omitempty"`
+	Held    bool             `json:"held"`
+	Elapsed effects.Duration `json:"elapsed"`
+}
+
+// InitCues adds endpoints to run cues by hand: GO, back, jump to a named cue,
+// hold and release. Each answers with the state of the cue list, which
+// catches up with the command on the next frame.
+func InitCues(e *echo.Echo, cues *ledsim.CueList) {
+	status := func(c echo.Context) error {
+		s := cues.Status()
+		return c.JSON(http.StatusOK, CueInfo{
+			Cues:    cues.Names(),
+			Current: s.Current,
+			Next:    s.Next,
+			Fading:  s.Fading,
+			Held:    s.Held,
+			Elapsed: effects.Duration(s.Elapsed),
+		})
+	}
+
+	e.GET(CONTROL_SUBDIRECTORY+"/cues", status)
+
+	e.POST(CONTROL_SUBDIRECTORY+"/cues/go", func(c echo.Context) error {
+		cues.Go()
+		return status(c)
+	})
+
+	e.POST(CONTROL_SUBDIRECTORY+"/cues/back", func(c echo.Context) error {
+		cues.Back()
+		return status(c)
+	})
+
+	e.POST(CONTROL_SUBDIRECTORY+"/cues/jump/:name", func(c echo.Context) error {
+		if err := cues.Jump(c.Param("name")); err != nil {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return status(c)
+	})
+
+	e.POST(CONTROL_SUBDIRECTORY+"/cues/hold", func(c echo.Context) error {
+		cues.Hold()
+		return status(c)
+	})
+
+	e.POST(CONTROL_SUBDIRECTORY+"/cues/release", func(c echo.Context) error {
+		cues.Release()
+		return status(c)
+	})
+}
@@ -0,0 +1,123 @@
+package control_panel
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ledsim"
+	"ledsim/effects"
+
+	"github.com/labstack/echo/v4"
+)
+
+// editTimeout is how long a request waits for the render loop to apply its
+// edit before answering that it's still queued.
+const editTimeout = 2 * time.Second
+
+// KeyframeInfo is how a keyframe in the running show is listed.
+type KeyframeInfo struct {
+	ID       string           `json:"id"`
+	Label    string           `json:"label"`
+	Offset   effects.Duration `json:"offset"`
+	Duration effects.Duration `json:"duration"`
+	Layer    int              `json:"layer"`
+	Target   string           `json:"target,omitempty"`
+	Opacity  *float64         `json:"opacity,omitempty"`
+	Blend    ledsim.BlendMode `json:"blend,omitempty"`
+	// Effect is the Go type of the keyframe's effect.
+	Effect string `json:"effect"`
+}
+
+func keyframeInfo(keyframe *ledsim.Keyframe) KeyframeInfo {
+	return KeyframeInfo{
+		ID:       keyframe.ID,
+		Label:    keyframe.Label,
+		Offset:   effects.Duration(keyframe.Offset),
+		Duration: effects.Duration(keyframe.Duration),
+		Layer:    keyframe.Layer,
+		Target:   keyframe.Target,
+		Opacity:  keyframe.Opacity,
+		Blend:    keyframe.Blend,
+		Effect:   fmt.Sprintf("%T", keyframe.Effect),
+	}
+}
+
+// InitTimeline adds endpoints to list, add, update and delete the keyframes
+// of the running show. New keyframes are described by an
+// effects.KeyframeSpec. Edits are applied by the render loop at the start of
+// its next frame.
+func InitTimeline(e *echo.Echo, manager *ledsim.EffectsManager) {
+	e.GET(CONTROL_SUBDIRECTORY+"/keyframes", func(c echo.Context) error {
+		keyframes := manager.Keyframes()
+		infos := make([]KeyframeInfo, 0, len(keyframes))
+		for _, keyframe := range keyframes {
+			infos = append(infos, keyframeInfo(keyframe))
+		}
+		return c.JSON(http.StatusOK, infos)
+	})
+
+	e.GET(CONTROL_SUBDIRECTORY+"/keyframes/:id", func(c echo.Context) error {
+		keyframe := manager.Keyframe(c.Param("id"))
+		if keyframe == nil {
+			return c.String(http.StatusNotFound, ledsim.ErrKeyframeNotFound.Error())
+		}
+		return c.JSON(http.StatusOK, keyframeInfo(keyframe))
+	})
+
+	e.POST(CONTROL_SUBDIRECTORY+"/keyframes", func(c echo.Context) error {
+		spec := new(effects.KeyframeSpec)
+		if err := c.Bind(spec); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		return waitForEdit(c, http.StatusCreated, manager.QueueEdit(ledsim.KeyframeEdit{
+			Build: spec.Build,
+		}), true)
+	})
+
+	e.PUT(CONTROL_SUBDIRECTORY+"/keyframes/:id", func(c echo.Context) error {
+		spec := new(effects.KeyframeSpec)
+		if err := c.Bind(spec); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		return waitForEdit(c, http.StatusOK, manager.QueueEdit(ledsim.KeyframeEdit{
+			Remove: c.Param("id"),
+			Build:  spec.Build,
+		}), true)
+	})
+
+	e.DELETE(CONTROL_SUBDIRECTORY+"/keyframes/:id", func(c echo.Context) error {
+		return waitForEdit(c, http.StatusNoContent, manager.QueueEdit(ledsim.KeyframeEdit{
+			Remove: c.Param("id"),
+		}), false)
+	})
+}
+
+// waitForEdit answers with the result of a queued edit once it's applied,
+// and the keyframe it added if withKeyframe is set. If the render loop
+// doesn't get to it in time, the edit stays queued and the answer says so.
+func waitForEdit(c echo.Context, status int, result <-chan ledsim.KeyframeEditResult, withKeyframe bool) error {
+	timeout := time.NewTimer(editTimeout)
+	defer timeout.Stop()
+
+	select {
+	case res := <-result:
+		if errors.Is(res.Err, ledsim.ErrKeyframeNotFound) {
+			return c.String(http.StatusNotFound, res.Err.Error())
+		} else if res.Err != nil {
+			return c.String(http.StatusBadRequest, res.Err.Error())
+		}
+
+		if !withKeyframe || res.Keyframe == nil {
+			return c.NoContent(status)
+		}
+		return c.JSON(status, keyframeInfo(res.Keyframe))
+	case <-timeout.C:
+		return c.String(http.StatusAccepted, "edit queued")
+	case <-c.Request().Context().Done():
+		return c.Request().Context().Err()
+	}
+}
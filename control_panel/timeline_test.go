@@ -0,0 +1,100 @@
+package control_panel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ledsim"
+	"ledsim/effects"
+
+	"github.com/labstack/echo/v4"
+)
+
+// renderLoop evaluates manager until the test ends, like the main loop, so
+// queued edits get applied.
+func renderLoop(t *testing.T, manager *ledsim.EffectsManager) {
+	sys := ledsim.NewSystem()
+	sys.AddLED(&ledsim.LED{})
+	sys.AddLED(&ledsim.LED{X: 1})
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		start := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				manager.Evaluate(sys, time.Since(start))
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+type request struct {
+	method, path, body string
+	status             int
+	// response is part of the response expected
+	response string
+}
+
+func serve(t *testing.T, e *echo.Echo, requests []request) {
+	t.Helper()
+
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != r.status || !strings.Contains(rec.Body.String(), r.response) {
+			t.Fatalf("%s %s = %d %q, want %d containing %q",
+				r.method, r.path, rec.Code, rec.Body.String(), r.status, r.response)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	base, err := effects.LoadKeyframes(strings.NewReader(
+		`[{"id": "base", "label": "base", "duration": 60, "effect": "monocolour"}]`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := ledsim.NewEffectsManager(base)
+	renderLoop(t, manager)
+
+	e := echo.New()
+	InitTimeline(e, manager)
+
+	serve(t, e, []request{
+		{"GET", "/control/keyframes", "", http.StatusOK, `"id":"base"`},
+		{"GET", "/control/keyframes/base", "", http.StatusOK, `"effect":"*effects.Monocolour"`},
+		{"GET", "/control/keyframes/nope", "", http.StatusNotFound, "keyframe not found"},
+
+		{"POST", "/control/keyframes", `{"label": "over", "offset": 1, "duration": 5, "layer": 1, "effect": "monocolour"}`,
+			http.StatusCreated, `"id":"1","label":"over","offset":"1s","duration":"5s","layer":1`},
+		{"POST", "/control/keyframes", `{"label": "bad", "duration": 5, "effect": "fireworks"}`,
+			http.StatusBadRequest, `unknown effect "fireworks"`},
+		{"POST", "/control/keyframes", `{"id": "base", "label": "again", "duration": 5, "effect": "monocolour"}`,
+			http.StatusBadRequest, `duplicate keyframe ID "base"`},
+
+		{"PUT", "/control/keyframes/base", `{"label": "new base", "duration": 30, "effect": "monocolour"}`,
+			http.StatusOK, `"id":"base","label":"new base"`},
+		{"PUT", "/control/keyframes/nope", `{"label": "nope", "duration": 30, "effect": "monocolour"}`,
+			http.StatusNotFound, "keyframe not found"},
+		{"GET", "/control/keyframes/base", "", http.StatusOK, `"label":"new base"`},
+
+		{"DELETE", "/control/keyframes/base", "", http.StatusNoContent, ""},
+		{"DELETE", "/control/keyframes/base", "", http.StatusNotFound, "keyframe not found"},
+		{"GET", "/control/keyframes", "", http.StatusOK, `[{"id":"1"`},
+	})
+}
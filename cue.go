@@ -0,0 +1,374 @@
+package ledsim
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Cue is a named part of a show that an operator starts by hand, such as a
+// speech, a reveal or the main show. Each cue plays its own manager, from the
+// start of its timeline, when it's gone to.
+type Cue struct {
+	Name    string
+	Manager *EffectsManager
+	// Crossfade is how long the cue fades in over the previous one. nil
+	// means the cue list's crossfade, and 0 cuts straight to it.
+	Crossfade *time.Duration
+	// Clock, if set, is played from the start when the cue is gone to and
+	// the cue follows it instead of the time since then, so a cue with
+	// audio stays in sync with it. It's paused when the cue is left or
+	// held.
+	Clock CueClock
+}
+
+// CueClock is a clock a cue can follow, such as the audio in mpv.Player.
+type CueClock interface {
+	Play() error
+	Pause() error
+	SeekTo(t time.Duration) error
+	GetTimestamp() (time.Duration, error)
+}
+
+// CueStatus is where a CueList is up to.
+type CueStatus struct {
+	// Current is the name of the cue playing, or empty before the first GO.
+	Current string
+	// Next is the cue GO goes to, or empty after the last cue.
+	Next string
+	// Fading is the cue being faded out from during a crossfade, or empty.
+	Fading string
+	Held   bool
+	// Elapsed is how long the current cue has played for, not counting
+	// while it was held.
+	Elapsed time.Duration
+}
+
+// CueList is a middleware that plays cues in place of an EffectsRunner. The
+// clock of each cue starts when it's gone to, or is the cue's own Clock if
+// it has one. Commands are queued and applied at the start of the next
+// frame, so they're safe to call from any goroutine.
+type CueList struct {
+	cues      []*Cue
+	crossfade time.Duration
+
+	// current and fading are indexes into cues, or -1
+	current        int
+	currentElapsed time.Duration
+	fading         int
+	fadingElapsed  time.Duration
+	fadeElapsed    time.Duration
+	fadeDuration   time.Duration
+	held           bool
+	last           time.Time
+
+	out, in Framebuffer
+
+	mu      sync.Mutex
+	pending []func(system *System)
+	status  CueStatus
+}
+
+// NewCueList creates a cue list that crossfades between cues over crossfade
+// unless they set their own. Nothing plays until the first GO. Every cue
+// needs a name and a manager, and no two cues can share either.
+func NewCueList(cues []*Cue, crossfade time.Duration) (*CueList, error) {
+	names := make(map[string]bool)
+	managers := make(map[*EffectsManager]bool)
+	for i, cue := range cues {
+		switch {
+		case cue.Name == "":
+			return nil, fmt.Errorf("cue %d has no name", i)
+		case names[cue.Name]:
+			return nil, fmt.Errorf("duplicate cue name %q", cue.Name)
+		case cue.Manager == nil:
+			return nil, fmt.Errorf("cue %q has no manager", cue.Name)
+		case managers[cue.Manager]:
+			return nil, fmt.Errorf("cue %q shares its manager with another cue", cue.Name)
+		}
+		names[cue.Name] = true
+		managers[cue.Manager] = true
+	}
+
+	l := &CueList{
+		cues:      cues,
+		crossfade: crossfade,
+		current:   -1,
+		fading:    -1,
+	}
+	l.updateStatus()
+	return l, nil
+}
+
+// Names returns the names of the cues, in order.
+func (l *CueList) Names() []string {
+	names := make([]string, len(l.cues))
+	for i, cue := range l.cues {
+		names[i] = cue.Name
+	}
+	return names
+}
+
+// Status returns where the cue list is up to, as of the latest frame.
+func (l *CueList) Status() CueStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
+
+// Go goes to the next cue, and releases a hold. After the last cue it does
+// nothing.
+func (l *CueList) Go() {
+	l.queue(func(system *System) {
+		l.release()
+		if l.current+1 < len(l.cues) {
+			l.goTo(l.current+1, system)
+		}
+	})
+}
+
+// Back goes to the cue before the current one, and releases a hold.
+func (l *CueList) Back() {
+	l.queue(func(system *System) {
+		l.release()
+		if l.current > 0 {
+			l.goTo(l.current-1, system)
+		}
+	})
+}
+
+// Jump goes to the cue with the given name, starting it again if it's the
+// current cue, and releases a hold.
+func (l *CueList) Jump(name string) error {
+	for i, cue := range l.cues {
+		if cue.Name == name {
+			l.queue(func(system *System) {
+				l.release()
+				l.goTo(i, system)
+			})
+			return nil
+		}
+	}
+	return fmt.Errorf("no cue named %q", name)
+}
+
+// Hold freezes the clock of the current cue, and any crossfade, until the
+// next Release or GO.
+func (l *CueList) Hold() {
+	l.queue(func(system *System) {
+		if l.held {
+			return
+		}
+		l.held = true
+		l.eachClock(func(clock CueClock) error {
+			return clock.Pause()
+		})
+	})
+}
+
+// Release lets a held cue play on.
+func (l *CueList) Release() {
+	l.queue(func(system *System) {
+		l.release()
+	})
+}
+
+func (l *CueList) release() {
+	if !l.held {
+		return
+	}
+	l.held = false
+	l.eachClock(func(clock CueClock) error {
+		return clock.Play()
+	})
+}
+
+// eachClock calls f with the clocks of the current and fading cues.
+func (l *CueList) eachClock(f func(clock CueClock) error) {
+	for _, i := range []int{l.current, l.fading} {
+		if i >= 0 && l.cues[i].Clock != nil {
+			if err := f(l.cues[i].Clock); err != nil {
+				log.Printf("warn: cue %q clock: %v", l.cues[i].Name, err)
+			}
+		}
+	}
+}
+
+// startClock plays the clock of cue i from the start, if it has one.
+func (l *CueList) startClock(i int) {
+	clock := l.cues[i].Clock
+	if clock == nil {
+		return
+	}
+	if err := clock.SeekTo(0); err != nil {
+		log.Printf("warn: cue %q clock: %v", l.cues[i].Name, err)
+	}
+	if err := clock.Play(); err != nil {
+		log.Printf("warn: cue %q clock: %v", l.cues[i].Name, err)
+	}
+}
+
+// stopClock pauses the clock of cue i, unless the current cue follows it
+// too.
+func (l *CueList) stopClock(i int) {
+	clock := l.cues[i].Clock
+	if clock == nil || (i != l.current && l.current >= 0 && l.cues[l.current].Clock == clock) {
+		return
+	}
+	if err := clock.Pause(); err != nil {
+		log.Printf("warn: cue %q clock: %v", l.cues[i].Name, err)
+	}
+}
+
+// clockTime returns the time of cue i's clock, or elapsed if it doesn't have
+// one or it can't be read.
+func (l *CueList) clockTime(i int, elapsed time.Duration) time.Duration {
+	clock := l.cues[i].Clock
+	if clock == nil {
+		return elapsed
+	}
+	t, err := clock.GetTimestamp()
+	if err != nil {
+		log.Printf("warn: error getting cue %q clock, falling back to wall clock: %v", l.cues[i].Name, err)
+		return elapsed
+	}
+	return t
+}
+
+func (l *CueList) queue(command func(system *System)) {
+	l.mu.Lock()
+	l.pending = append(l.pending, command)
+	l.mu.Unlock()
+}
+
+func (l *CueList) goTo(i int, system *System) {
+	if i == l.current {
+		// start it again without a fade
+		l.stopFading(system)
+		l.cues[i].Manager.Stop(system)
+		l.currentElapsed = 0
+		l.startClock(i)
+		return
+	}
+
+	// a cue that's still fading out is cut off
+	l.stopFading(system)
+
+	crossfade := l.crossfade
+	if l.cues[i].Crossfade != nil {
+		crossfade = *l.cues[i].Crossfade
+	}
+	if l.current >= 0 && crossfade > 0 {
+		l.fading = l.current
+		l.fadingElapsed = l.currentElapsed
+		l.fadeElapsed = 0
+		l.fadeDuration = crossfade
+	} else if l.current >= 0 {
+		l.cues[l.current].Manager.Stop(system)
+	}
+
+	previous := l.current
+	l.current = i
+	l.currentElapsed = 0
+	l.cues[i].Manager.Stop(system)
+	l.startClock(i)
+	if previous >= 0 && l.fading != previous {
+		l.stopClock(previous)
+	}
+}
+
+func (l *CueList) stopFading(system *System) {
+	if l.fading < 0 {
+		return
+	}
+	l.cues[l.fading].Manager.Stop(system)
+	fading := l.fading
+	l.fading = -1
+	l.stopClock(fading)
+}
+
+func (l *CueList) Execute(system *System, next func() error) error {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, command := range pending {
+		command(system)
+	}
+
+	now := time.Now()
+	if !l.last.IsZero() && !l.held && l.current >= 0 {
+		step := now.Sub(l.last)
+		l.currentElapsed += step
+		l.fadingElapsed += step
+		l.fadeElapsed += step
+	}
+	l.last = now
+
+	if l.current >= 0 {
+		l.currentElapsed = l.clockTime(l.current, l.currentElapsed)
+	}
+	if l.fading >= 0 {
+		l.fadingElapsed = l.clockTime(l.fading, l.fadingElapsed)
+	}
+
+	if l.fading >= 0 && l.fadeElapsed >= l.fadeDuration {
+		l.stopFading(system)
+	}
+
+	switch {
+	case l.current < 0:
+		for _, led := range system.LEDs {
+			led.Color = colorful.Color{}
+		}
+	case l.fading >= 0:
+		l.out = l.out.resized(system.IDCount())
+		l.in = l.in.resized(system.IDCount())
+
+		l.cues[l.fading].Manager.Evaluate(system, l.fadingElapsed)
+		l.out.Capture(system)
+		l.cues[l.current].Manager.Evaluate(system, l.currentElapsed)
+		l.in.Capture(system)
+
+		t := float64(l.fadeElapsed) / float64(l.fadeDuration)
+		for _, led := range system.LEDs {
+			led.Color = BlendRgb(l.out[led.ID], l.in[led.ID], t).Clamped()
+		}
+	default:
+		l.cues[l.current].Manager.Evaluate(system, l.currentElapsed)
+	}
+
+	l.updateStatus()
+	return next()
+}
+
+func (l *CueList) updateStatus() {
+	status := CueStatus{
+		Held:    l.held,
+		Elapsed: l.currentElapsed,
+	}
+	if l.current >= 0 {
+		status.Current = l.cues[l.current].Name
+	}
+	if l.current+1 < len(l.cues) {
+		status.Next = l.cues[l.current+1].Name
+	}
+	if l.fading >= 0 {
+		status.Fading = l.cues[l.fading].Name
+	}
+
+	l.mu.Lock()
+	l.status = status
+	l.mu.Unlock()
+}
+
+// Stop exits every running keyframe and puts the manager's clock back to the
+// start, so the next Evaluate starts the timeline afresh. Like Evaluate it
+// must only be called from the render goroutine.
+func (r *EffectsManager) Stop(system *System) {
+	r.rewind(system)
+}
@@ -0,0 +1,257 @@
+package ledsim
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// fakeClock is a CueClock that only moves when told to.
+type fakeClock struct {
+	t      time.Duration
+	paused bool
+	calls  []string
+}
+
+func (c *fakeClock) Play() error {
+	c.paused = false
+	c.calls = append(c.calls, "play")
+	return nil
+}
+
+func (c *fakeClock) Pause() error {
+	c.paused = true
+	c.calls = append(c.calls, "pause")
+	return nil
+}
+
+func (c *fakeClock) SeekTo(t time.Duration) error {
+	c.t = t
+	c.calls = append(c.calls, fmt.Sprint("seek ", t))
+	return nil
+}
+
+func (c *fakeClock) GetTimestamp() (time.Duration, error) {
+	return c.t, nil
+}
+
+func solidCue(name string, color colorful.Color) *Cue {
+	return &Cue{
+		Name: name,
+		Manager: NewEffectsManager([]*Keyframe{
+			{Label: name, Duration: time.Hour, Effect: &solidEffect{color}},
+		}),
+	}
+}
+
+func cueSystem() *System {
+	system := NewSystem()
+	system.AddLED(&LED{})
+	system.AddLED(&LED{X: 1})
+	return system
+}
+
+// frame renders a frame of l as if wait had passed since the last one.
+func frame(l *CueList, system *System, wait time.Duration) {
+	if !l.last.IsZero() {
+		l.last = l.last.Add(-wait)
+	}
+	l.Execute(system, func() error { return nil })
+}
+
+func TestNewCueList(t *testing.T) {
+	manager := NewEffectsManager(nil)
+	tests := []struct {
+		name string
+		cues []*Cue
+		err  string
+	}{
+		{"empty", nil, ""},
+		{"no name", []*Cue{{Manager: manager}}, "cue 0 has no name"},
+		{"duplicate name", []*Cue{{Name: "a", Manager: manager}, {Name: "a", Manager: NewEffectsManager(nil)}}, `duplicate cue name "a"`},
+		{"no manager", []*Cue{{Name: "a"}}, `cue "a" has no manager`},
+		{"shared manager", []*Cue{{Name: "a", Manager: manager}, {Name: "b", Manager: manager}}, `cue "b" shares its manager`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewCueList(test.cues, 0)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("NewCueList() = %v, want nil", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("NewCueList() = %v, want it to contain %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCueList(t *testing.T) {
+	red := colorful.Color{R: 1}
+	blue := colorful.Color{B: 1}
+	black := colorful.Color{}
+	half := BlendRgb(red, blue, 0.5)
+	s := time.Second
+
+	type step struct {
+		command func(l *CueList)
+		// wait is how long the frame lasts, commands apply at its start
+		wait time.Duration
+		// want is the status after the frame, ignoring Elapsed, and color
+		// the colour of every LED
+		want    CueStatus
+		color   colorful.Color
+		elapsed time.Duration
+	}
+	goCue := func(l *CueList) { l.Go() }
+	back := func(l *CueList) { l.Back() }
+	hold := func(l *CueList) { l.Hold() }
+	release := func(l *CueList) { l.Release() }
+	jump := func(name string) func(l *CueList) {
+		return func(l *CueList) { l.Jump(name) }
+	}
+
+	tests := []struct {
+		name      string
+		crossfade time.Duration
+		steps     []step
+	}{
+		{
+			name: "black until the first GO",
+			steps: []step{
+				{nil, 0, CueStatus{Next: "red"}, black, 0},
+				{nil, s, CueStatus{Next: "red"}, black, 0},
+				{goCue, s, CueStatus{Current: "red", Next: "blue"}, red, s},
+				{nil, s, CueStatus{Current: "red", Next: "blue"}, red, 2 * s},
+			},
+		},
+		{
+			name: "cut between cues",
+			steps: []step{
+				{goCue, 0, CueStatus{Current: "red", Next: "blue"}, red, 0},
+				{goCue, s, CueStatus{Current: "blue"}, blue, s},
+				// GO after the last cue does nothing
+				{goCue, s, CueStatus{Current: "blue"}, blue, 2 * s},
+				{back, s, CueStatus{Current: "red", Next: "blue"}, red, s},
+				{back, s, CueStatus{Current: "red", Next: "blue"}, red, 2 * s},
+			},
+		},
+		{
+			name:      "crossfade",
+			crossfade: 2 * s,
+			steps: []step{
+				{goCue, 0, CueStatus{Current: "red", Next: "blue"}, red, 0},
+				{goCue, 0, CueStatus{Current: "blue", Fading: "red"}, red, 0},
+				{nil, s, CueStatus{Current: "blue", Fading: "red"}, half, s},
+				{nil, s, CueStatus{Current: "blue"}, blue, 2 * s},
+			},
+		},
+		{
+			name:      "hold freezes a crossfade",
+			crossfade: 2 * s,
+			steps: []step{
+				{goCue, 0, CueStatus{Current: "red", Next: "blue"}, red, 0},
+				{goCue, 0, CueStatus{Current: "blue", Fading: "red"}, red, 0},
+				{nil, s, CueStatus{Current: "blue", Fading: "red"}, half, s},
+				{hold, s, CueStatus{Current: "blue", Fading: "red", Held: true}, half, s},
+				{nil, 10 * s, CueStatus{Current: "blue", Fading: "red", Held: true}, half, s},
+				{release, 0, CueStatus{Current: "blue", Fading: "red"}, half, s},
+				{nil, s, CueStatus{Current: "blue"}, blue, 2 * s},
+			},
+		},
+		{
+			name:      "jump restarts the current cue and cuts off a fade",
+			crossfade: 2 * s,
+			steps: []step{
+				{goCue, 0, CueStatus{Current: "red", Next: "blue"}, red, 0},
+				{goCue, 0, CueStatus{Current: "blue", Fading: "red"}, red, 0},
+				{jump("blue"), s, CueStatus{Current: "blue"}, blue, s},
+				{hold, s, CueStatus{Current: "blue", Held: true}, blue, s},
+				// a jump releases a hold, and fades from where it was
+				{jump("red"), 0, CueStatus{Current: "red", Next: "blue", Fading: "blue"}, blue, 0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			system := cueSystem()
+			l, err := NewCueList([]*Cue{solidCue("red", red), solidCue("blue", blue)}, test.crossfade)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, step := range test.steps {
+				if step.command != nil {
+					step.command(l)
+				}
+				frame(l, system, step.wait)
+
+				status := l.Status()
+				elapsed := status.Elapsed
+				status.Elapsed = 0
+				if status != step.want {
+					t.Fatalf("step %d: status %+v, want %+v", i, status, step.want)
+				}
+				// the real time between frames is added on top
+				if elapsed < step.elapsed || elapsed > step.elapsed+time.Second/10 {
+					t.Fatalf("step %d: elapsed %v, want %v", i, elapsed, step.elapsed)
+				}
+				for _, led := range system.LEDs {
+					if !led.Color.AlmostEqualRgb(step.color) {
+						t.Fatalf("step %d: led %d is %v, want %v", i, led.ID, led.Color, step.color)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCueListClock(t *testing.T) {
+	system := cueSystem()
+	clock := &fakeClock{paused: true}
+	show := solidCue("show", colorful.Color{G: 1})
+	show.Clock = clock
+	l, err := NewCueList([]*Cue{show, solidCue("red", colorful.Color{R: 1})}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame(l, system, 0)
+	if len(clock.calls) != 0 {
+		t.Fatalf("clock was used before the first GO: %v", clock.calls)
+	}
+
+	l.Go()
+	frame(l, system, 0)
+	clock.t = 42 * time.Second
+	frame(l, system, time.Second)
+	if l.Status().Elapsed != 42*time.Second {
+		t.Fatalf("show cue elapsed %v, want the clock's 42s", l.Status().Elapsed)
+	}
+
+	l.Hold()
+	frame(l, system, time.Second)
+	l.Release()
+	frame(l, system, 0)
+
+	// the clock keeps running while the show cue fades out, and is paused
+	// once it has
+	l.Go()
+	frame(l, system, 0)
+	if clock.paused {
+		t.Fatal("clock paused while the show cue was fading out")
+	}
+	frame(l, system, 2*time.Second)
+
+	l.Jump("show")
+	frame(l, system, 0)
+
+	want := []string{"seek 0s", "play", "pause", "play", "pause", "seek 0s", "play"}
+	if strings.Join(clock.calls, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("clock calls %v, want %v", clock.calls, want)
+	}
+}
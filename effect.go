@@ -2,6 +2,8 @@ package ledsim
 
 import (
 	"math"
+	"math/rand"
+	"sort"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
@@ -71,6 +73,18 @@ func (w *blendingWrapper) OnExit(system *System) {
 	w.effect.OnExit(system)
 }
 
+func (w *blendingWrapper) SetRand(rng *rand.Rand) {
+	SeedEffect(w.effect, rng)
+}
+
+func (w *blendingWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, progress, system)
+}
+
+func (w *blendingWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
 func (w *blendingWrapper) Eval(progress float64, system *System) {
 	for _, led := range system.LEDs {
 		c, blend := w.effect.BlendEval(progress, led)
@@ -98,14 +112,50 @@ func (w *easingWrapper) OnExit(system *System) {
 	w.effect.OnExit(system)
 }
 
+func (w *easingWrapper) SetRand(rng *rand.Rand) {
+	SeedEffect(w.effect, rng)
+}
+
+func (w *easingWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, w.easing(progress), system)
+}
+
+func (w *easingWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
 func (w *easingWrapper) Eval(progress float64, system *System) {
-	w.effect.Eval(w.easing(progress), system)
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *easingWrapper) EvalContext(ctx *EvalContext, system *System) {
+	EvalWith(w.effect, ctx.sub(w.easing(ctx.Progress), 1), system)
 }
 
 type WrappedEffect struct {
 	Effect
 }
 
+// SetRand forwards rng to the wrapped effect, see Randomized.
+func (e WrappedEffect) SetRand(rng *rand.Rand) {
+	SeedEffect(e.Effect, rng)
+}
+
+// EvalContext forwards ctx to the wrapped effect, see ContextEffect.
+func (e WrappedEffect) EvalContext(ctx *EvalContext, system *System) {
+	EvalWith(e.Effect, ctx, system)
+}
+
+// Seek forwards to the wrapped effect, see Seekable.
+func (e WrappedEffect) Seek(progress float64, system *System) {
+	SeekEffect(e.Effect, progress, system)
+}
+
+// OnIteration forwards to the wrapped effect, see Iterating.
+func (e WrappedEffect) OnIteration(index int, system *System) {
+	IterateEffect(e.Effect, index, system)
+}
+
 func (e WrappedEffect) WithEasing(easing func(progress float64) float64) WrappedEffect {
 	return WrappedEffect{&easingWrapper{
 		effect: e,
@@ -115,10 +165,22 @@ func (e WrappedEffect) WithEasing(easing func(progress float64) float64) Wrapped
 
 type repetitionWrapper struct {
 	effect Effect
-	count  int
+	// passes is the number of times the effect plays, twice the count if
+	// every other pass is reversed
+	passes    int
+	reverse   bool
+	reEnter   bool
+	iteration int
+	seed      int64
+	follower  seekFollower
 }
 
 func (w *repetitionWrapper) OnEnter(system *System) {
+	w.follower.reset()
+	w.iteration = 0
+	if w.reEnter {
+		SeedEffect(w.effect, w.iterationRand(0))
+	}
 	w.effect.OnEnter(system)
 }
 
@@ -126,30 +188,116 @@ func (w *repetitionWrapper) OnExit(system *System) {
 	w.effect.OnExit(system)
 }
 
+func (w *repetitionWrapper) SetRand(rng *rand.Rand) {
+	w.seed = rng.Int63()
+	SeedEffect(w.effect, rng)
+}
+
+func (w *repetitionWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
+// iterationRand returns the generator the effect is re-entered with for a
+// pass, the same every time that pass is reached.
+func (w *repetitionWrapper) iterationRand(index int) *rand.Rand {
+	return rand.New(rand.NewSource(w.seed ^ int64(index+1)*0x5851F42D4C957F2D))
+}
+
+// position returns which pass runs at progress, and the effect's progress
+// in it.
+func (w *repetitionWrapper) position(progress float64) (int, float64) {
+	pos := progress * float64(w.passes)
+	index := int(math.Floor(pos))
+	if index >= w.passes {
+		index = w.passes - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+
+	local := pos - float64(index)
+	if w.reverse && index%2 == 1 {
+		local = 1 - local
+	}
+	return index, local
+}
+
+// enterIteration moves the effect to pass index, re-entering it if asked
+// to and calling its OnIteration hook.
+func (w *repetitionWrapper) enterIteration(index int, system *System) {
+	if index == w.iteration {
+		return
+	}
+
+	if w.reEnter {
+		w.effect.OnExit(system)
+		SeedEffect(w.effect, w.iterationRand(index))
+		w.effect.OnEnter(system)
+		w.follower.reset()
+	}
+
+	w.iteration = index
+	IterateEffect(w.effect, index, system)
+}
+
+func (w *repetitionWrapper) Seek(progress float64, system *System) {
+	index, local := w.position(progress)
+	w.enterIteration(index, system)
+	w.follower.seek(w.effect, local, system)
+}
+
 func (w *repetitionWrapper) Eval(progress float64, system *System) {
-	w.effect.Eval(math.Mod(progress*float64(w.count), 1.0), system)
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *repetitionWrapper) EvalContext(ctx *EvalContext, system *System) {
+	index, local := w.position(ctx.Progress)
+	w.enterIteration(index, system)
+	w.follower.follow(w.effect, local, system)
+	EvalWith(w.effect, ctx.sub(local, 1/float64(w.passes)), system)
 }
 
+// RepetitionOptions change how WithRepetitionOptions repeats an effect.
+type RepetitionOptions struct {
+	// Reverse plays each repetition forwards and then backwards.
+	Reverse bool
+	// ReEnter exits and re-enters the effect at the start of every pass,
+	// rather than only calling OnIteration, so it starts each one fresh.
+	ReEnter bool
+}
+
+// WithRepetition plays the effect count times over its duration, forwards
+// and then backwards each time if reverse is given and true.
 func (e WrappedEffect) WithRepetition(count int, reverse ...bool) WrappedEffect {
-	if len(reverse) > 0 && reverse[0] {
-		return WrappedEffect{&repetitionWrapper{
-			effect: Sequential(e, e.Reverse()),
-			count:  count,
-		}}
+	return e.WithRepetitionOptions(count, RepetitionOptions{
+		Reverse: len(reverse) > 0 && reverse[0],
+	})
+}
+
+// WithRepetitionOptions is WithRepetition with more control. The effect is
+// told whenever it moves to a different pass through Iterating.
+func (e WrappedEffect) WithRepetitionOptions(count int, options RepetitionOptions) WrappedEffect {
+	passes := count
+	if options.Reverse {
+		passes *= 2
 	}
 
 	return WrappedEffect{&repetitionWrapper{
-		effect: e,
-		count:  count,
+		effect:  e,
+		passes:  passes,
+		reverse: options.Reverse,
+		reEnter: options.ReEnter,
 	}}
 }
 
 type reverseWrapper struct {
-	effect Effect
-	count  int
+	effect   Effect
+	count    int
+	follower seekFollower
 }
 
 func (w *reverseWrapper) OnEnter(system *System) {
+	w.follower.reset()
 	w.effect.OnEnter(system)
 }
 
@@ -157,8 +305,25 @@ func (w *reverseWrapper) OnExit(system *System) {
 	w.effect.OnExit(system)
 }
 
+func (w *reverseWrapper) SetRand(rng *rand.Rand) {
+	SeedEffect(w.effect, rng)
+}
+
+func (w *reverseWrapper) Seek(progress float64, system *System) {
+	w.follower.seek(w.effect, 1.0-progress, system)
+}
+
+func (w *reverseWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
 func (w *reverseWrapper) Eval(progress float64, system *System) {
-	w.effect.Eval(1.0-progress, system)
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *reverseWrapper) EvalContext(ctx *EvalContext, system *System) {
+	w.follower.follow(w.effect, 1.0-ctx.Progress, system)
+	EvalWith(w.effect, ctx.sub(1.0-ctx.Progress, 1), system)
 }
 
 func (e WrappedEffect) Reverse() WrappedEffect {
@@ -183,14 +348,41 @@ func (w *sequentialWrapper) OnExit(system *System) {
 	}
 }
 
-func (w *sequentialWrapper) Eval(progress float64, system *System) {
+func (w *sequentialWrapper) SetRand(rng *rand.Rand) {
+	for _, effect := range w.effects {
+		seedEach(rng, effect)
+	}
+}
+
+func (w *sequentialWrapper) Seek(progress float64, system *System) {
+	i, local := w.child(progress)
+	SeekEffect(w.effects[i], local, system)
+}
+
+func (w *sequentialWrapper) OnIteration(index int, system *System) {
+	for _, effect := range w.effects {
+		IterateEffect(effect, index, system)
+	}
+}
+
+// child returns which effect runs at progress, and its progress.
+func (w *sequentialWrapper) child(progress float64) (int, float64) {
 	i := int(math.Floor(progress * float64(len(w.effects))))
 
 	if i >= len(w.effects) {
 		i = len(w.effects) - 1
 	}
 
-	w.effects[i].Eval(math.Mod(progress*float64(len(w.effects)), 1.0), system)
+	return i, math.Mod(progress*float64(len(w.effects)), 1.0)
+}
+
+func (w *sequentialWrapper) Eval(progress float64, system *System) {
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *sequentialWrapper) EvalContext(ctx *EvalContext, system *System) {
+	i, local := w.child(ctx.Progress)
+	EvalWith(w.effects[i], ctx.sub(local, 1/float64(len(w.effects))), system)
 }
 
 func Sequential(effects ...Effect) WrappedEffect {
@@ -198,3 +390,315 @@ func Sequential(effects ...Effect) WrappedEffect {
 		effects: effects,
 	}}
 }
+
+type parallelWrapper struct {
+	effects []Effect
+}
+
+func (w *parallelWrapper) OnEnter(system *System) {
+	for _, effect := range w.effects {
+		effect.OnEnter(system)
+	}
+}
+
+func (w *parallelWrapper) OnExit(system *System) {
+	for _, effect := range w.effects {
+		effect.OnExit(system)
+	}
+}
+
+func (w *parallelWrapper) SetRand(rng *rand.Rand) {
+	for _, effect := range w.effects {
+		seedEach(rng, effect)
+	}
+}
+
+func (w *parallelWrapper) Seek(progress float64, system *System) {
+	for _, effect := range w.effects {
+		SeekEffect(effect, progress, system)
+	}
+}
+
+func (w *parallelWrapper) OnIteration(index int, system *System) {
+	for _, effect := range w.effects {
+		IterateEffect(effect, index, system)
+	}
+}
+
+func (w *parallelWrapper) Eval(progress float64, system *System) {
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *parallelWrapper) EvalContext(ctx *EvalContext, system *System) {
+	for _, effect := range w.effects {
+		EvalWith(effect, ctx, system)
+	}
+}
+
+// Parallel runs every effect over the whole duration, evaluated in order so
+// later effects draw over earlier ones.
+func Parallel(effects ...Effect) WrappedEffect {
+	return WrappedEffect{&parallelWrapper{
+		effects: effects,
+	}}
+}
+
+type crossfadeWrapper struct {
+	from, to Effect
+	blending Blending
+	base     Framebuffer
+	fromBuf  Framebuffer
+}
+
+func (w *crossfadeWrapper) OnEnter(system *System) {
+	w.from.OnEnter(system)
+	w.to.OnEnter(system)
+}
+
+func (w *crossfadeWrapper) OnExit(system *System) {
+	w.from.OnExit(system)
+	w.to.OnExit(system)
+}
+
+func (w *crossfadeWrapper) SetRand(rng *rand.Rand) {
+	seedEach(rng, w.from, w.to)
+}
+
+func (w *crossfadeWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.from, progress, system)
+	SeekEffect(w.to, progress, system)
+}
+
+func (w *crossfadeWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.from, index, system)
+	IterateEffect(w.to, index, system)
+}
+
+func (w *crossfadeWrapper) Eval(progress float64, system *System) {
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *crossfadeWrapper) EvalContext(ctx *EvalContext, system *System) {
+	w.base = w.base.resized(system.IDCount())
+	w.fromBuf = w.fromBuf.resized(system.IDCount())
+
+	// both effects start from what was below, so neither sees the other
+	w.base.Capture(system)
+	EvalWith(w.from, ctx, system)
+	w.fromBuf.Capture(system)
+
+	w.base.Apply(system)
+	EvalWith(w.to, ctx, system)
+
+	for _, led := range system.LEDs {
+		led.Color = w.blending(w.fromBuf[led.ID], led.Color, ctx.Progress).Clamped()
+	}
+}
+
+// Crossfade runs both effects over the whole duration and blends from the
+// output of from to the output of to as progress goes from 0 to 1.
+func Crossfade(from, to Effect, blending Blending) WrappedEffect {
+	return WrappedEffect{&crossfadeWrapper{
+		from:     from,
+		to:       to,
+		blending: blending,
+	}}
+}
+
+// SequenceStep is one child of a Sequence, lasting Weight relative to the
+// other steps.
+type SequenceStep struct {
+	Effect Effect
+	Weight float64
+}
+
+// Step is shorthand for a SequenceStep.
+func Step(weight float64, effect Effect) SequenceStep {
+	return SequenceStep{Effect: effect, Weight: weight}
+}
+
+type sequenceWrapper struct {
+	steps []SequenceStep
+	// ends are the cumulative end of each step, from 0 to 1
+	ends    []float64
+	current int
+}
+
+func (w *sequenceWrapper) OnEnter(system *System) {
+	w.current = -1
+}
+
+func (w *sequenceWrapper) OnExit(system *System) {
+	if w.current >= 0 {
+		w.steps[w.current].Effect.OnExit(system)
+		w.current = -1
+	}
+}
+
+func (w *sequenceWrapper) SetRand(rng *rand.Rand) {
+	for _, step := range w.steps {
+		seedEach(rng, step.Effect)
+	}
+}
+
+func (w *sequenceWrapper) Eval(progress float64, system *System) {
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *sequenceWrapper) EvalContext(ctx *EvalContext, system *System) {
+	if len(w.steps) == 0 {
+		return
+	}
+
+	i, local, share := w.enterStep(ctx.Progress, system)
+	EvalWith(w.steps[i].Effect, ctx.sub(local, share), system)
+}
+
+func (w *sequenceWrapper) Seek(progress float64, system *System) {
+	if len(w.steps) == 0 {
+		return
+	}
+
+	i, local, _ := w.enterStep(progress, system)
+	SeekEffect(w.steps[i].Effect, local, system)
+}
+
+// OnIteration is passed to the running step, the others start fresh when
+// they're entered.
+func (w *sequenceWrapper) OnIteration(index int, system *System) {
+	if w.current >= 0 {
+		IterateEffect(w.steps[w.current].Effect, index, system)
+	}
+}
+
+// enterStep switches to the step that runs at progress, and returns it, its
+// progress and its share of the duration.
+func (w *sequenceWrapper) enterStep(progress float64, system *System) (int, float64, float64) {
+	// progress exactly on a boundary belongs to the next step, and steps
+	// with no weight are skipped over
+	i := sort.SearchFloat64s(w.ends, progress)
+	for i < len(w.steps)-1 && w.ends[i] <= progress {
+		i++
+	}
+	if i >= len(w.steps) {
+		i = len(w.steps) - 1
+	}
+
+	if i != w.current {
+		if w.current >= 0 {
+			w.steps[w.current].Effect.OnExit(system)
+		}
+		w.current = i
+		w.steps[i].Effect.OnEnter(system)
+	}
+
+	start := 0.0
+	if i > 0 {
+		start = w.ends[i-1]
+	}
+
+	local := 1.0
+	if w.ends[i] > start {
+		local = (progress - start) / (w.ends[i] - start)
+	}
+	return i, math.Max(0, math.Min(1, local)), w.ends[i] - start
+}
+
+// Sequence runs steps one after the other, each taking a share of the
+// duration proportional to its weight. Unlike Sequential, each step is only
+// entered when it starts and exited when it ends. If no step has a positive
+// weight they share the duration equally.
+func Sequence(steps ...SequenceStep) WrappedEffect {
+	total := 0.0
+	for _, step := range steps {
+		total += math.Max(0, step.Weight)
+	}
+
+	ends := make([]float64, len(steps))
+	sum := 0.0
+	for i, step := range steps {
+		if total > 0 {
+			sum += math.Max(0, step.Weight) / total
+		} else {
+			sum += 1 / float64(len(steps))
+		}
+		ends[i] = sum
+	}
+	if len(ends) > 0 {
+		ends[len(ends)-1] = 1
+	}
+
+	return WrappedEffect{&sequenceWrapper{
+		steps:   steps,
+		ends:    ends,
+		current: -1,
+	}}
+}
+
+// Mask weights an effect per LED, from 0 (the layers below show through) to
+// 1 (the effect shows fully).
+type Mask interface {
+	OnEnter(system *System)
+	Weight(progress float64, led *LED) float64
+}
+
+type MaskFunc func(progress float64, led *LED) float64
+
+func (f MaskFunc) OnEnter(system *System) {
+}
+
+func (f MaskFunc) Weight(progress float64, led *LED) float64 {
+	return f(progress, led)
+}
+
+type maskWrapper struct {
+	effect Effect
+	mask   Mask
+	below  Framebuffer
+}
+
+func (w *maskWrapper) OnEnter(system *System) {
+	w.mask.OnEnter(system)
+	w.effect.OnEnter(system)
+}
+
+func (w *maskWrapper) OnExit(system *System) {
+	w.effect.OnExit(system)
+}
+
+func (w *maskWrapper) SetRand(rng *rand.Rand) {
+	seedEach(rng, w.effect, w.mask)
+}
+
+func (w *maskWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, progress, system)
+}
+
+func (w *maskWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
+func (w *maskWrapper) Eval(progress float64, system *System) {
+	w.EvalContext(ProgressContext(progress), system)
+}
+
+func (w *maskWrapper) EvalContext(ctx *EvalContext, system *System) {
+	w.below = w.below.resized(system.IDCount())
+	w.below.Capture(system)
+
+	EvalWith(w.effect, ctx, system)
+
+	for _, led := range system.LEDs {
+		weight := math.Max(0, math.Min(1, w.mask.Weight(ctx.Progress, led)))
+		led.Color = w.below[led.ID].BlendRgb(led.Color, weight).Clamped()
+	}
+}
+
+// WithMask blends the effect's output with what was below it by the mask's
+// weight for each LED.
+func (e WrappedEffect) WithMask(mask Mask) WrappedEffect {
+	return WrappedEffect{&maskWrapper{
+		effect: e,
+		mask:   mask,
+	}}
+}
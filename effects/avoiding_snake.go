@@ -8,25 +8,41 @@ import (
 
 	"ledsim"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type AvoidingSnakeInstance struct {
 	comps      []*ledsim.LED
 	color      colorful.Color
-	dur        time.Duration
-	speed      float64
-	curMove    int
 	head       int
 	searchDist int
+	rng        *rand.Rand
 }
 
 type AvoidingSnake struct {
-	snakes      []*AvoidingSnakeInstance
-	scoringDist int
+	seeded
+	snakes          []*AvoidingSnakeInstance
+	scoringDist     int
+	palette         []colorful.Color
+	randomizeColors bool
+	dur             time.Duration
+	speed           float64
+	curMove         int
+	// walk places the snakes and picks their turns, it is reseeded from
+	// walkSeed at the start and at every snapshot so the same paths replay
+	// when seeking
+	walk     *rand.Rand
+	walkSeed int64
+	// snapshots[i] is every snake's body before move
+	// i*avoidingSnakeSnapshotInterval, so seeking replays from the nearest
+	// one instead of from the start
+	snapshots [][][]*ledsim.LED
 }
 
+// avoidingSnakeSnapshotInterval is how many moves apart snapshots are. Every
+// move floods the scoring map, so seeking replays at most this many.
+const avoidingSnakeSnapshotInterval = 100
+
 type AvoidingSnakeConfig struct {
 	Duration        time.Duration
 	Speed           float64
@@ -47,53 +63,25 @@ func (m *ScoringMap) GetScore(led *ledsim.LED) int {
 	return m.scores[led]
 }
 
-func (a *AvoidingSnake) ComputeScoringMap(depth int) *ScoringMap {
+func (a *AvoidingSnake) ComputeScoringMap(sys *ledsim.System, depth int) *ScoringMap {
 	m := &ScoringMap{
 		scores: make(map[*ledsim.LED]int),
 	}
 
-	type queueEntry struct {
-		depth   int
-		prevLED *ledsim.LED
-		curLED  *ledsim.LED
-	}
-
 	for _, snake := range a.snakes {
 		if snake.comps[0] == nil {
 			continue
 		}
 
-		// flood fill from LED
-		seen := make(map[*ledsim.LED]bool)
-		queue := []queueEntry{
-			{
-				depth:   0,
-				curLED:  snake.comps[len(snake.comps)-1],
-				prevLED: snake.comps[len(snake.comps)-2],
-			},
-		}
-		seen[snake.comps[len(snake.comps)-1]] = true
-		seen[snake.comps[len(snake.comps)-2]] = true
-		for len(queue) > 0 {
-			top := queue[0]
-			queue = queue[1:]
-
-			for _, neigh := range top.curLED.Neighbours {
-				if !seen[neigh] && neigh != top.prevLED {
-					if top.depth >= depth {
-						continue
-					}
-
-					seen[neigh] = true
-					m.scores[neigh] += depth - top.depth
-					queue = append(queue, queueEntry{
-						depth:   top.depth + 1,
-						curLED:  neigh,
-						prevLED: top.curLED,
-					})
-				}
+		// flood fill from the head, away from the body
+		behind := snake.comps[len(snake.comps)-2]
+		sys.WalkBFS(snake.comps[len(snake.comps)-1:], depth, func(led *ledsim.LED) bool {
+			return led == behind
+		}, func(led *ledsim.LED, d int) {
+			if d > 0 {
+				m.scores[led] += depth - d + 1
 			}
-		}
+		})
 	}
 
 	return m
@@ -101,26 +89,21 @@ func (a *AvoidingSnake) ComputeScoringMap(depth int) *ScoringMap {
 
 func NewAvoidingSnake(config *AvoidingSnakeConfig) *AvoidingSnake {
 	snake := &AvoidingSnake{
-		snakes:      make([]*AvoidingSnakeInstance, config.NumSnakes),
-		scoringDist: config.ScoringDist,
+		snakes:          make([]*AvoidingSnakeInstance, config.NumSnakes),
+		scoringDist:     config.ScoringDist,
+		palette:         config.Palette,
+		randomizeColors: config.RandomizeColors,
+		dur:             config.Duration,
+		speed:           config.Speed,
 	}
 
 	for i := range snake.snakes {
 		snek := &AvoidingSnakeInstance{
 			comps:      make([]*ledsim.LED, config.SnakeLength),
-			dur:        config.Duration,
-			speed:      config.Speed,
-			curMove:    0,
 			head:       config.Head,
 			searchDist: config.SearchDist,
 		}
 
-		if config.RandomizeColors {
-			snek.color = config.Palette[rand.Intn(len(config.Palette))]
-		} else {
-			snek.color = config.Palette[i%len(config.Palette)]
-		}
-
 		snake.snakes[i] = snek
 	}
 
@@ -128,15 +111,54 @@ func NewAvoidingSnake(config *AvoidingSnakeConfig) *AvoidingSnake {
 }
 
 func (s *AvoidingSnake) OnEnter(sys *ledsim.System) {
-	for _, snake := range s.snakes {
+	if seed := s.rng().Int63(); seed != s.walkSeed || s.snapshots == nil {
+		// the snapshots are of another walk
+		s.walkSeed = seed
+		s.snapshots = nil
+	}
+	s.reset(sys)
+}
+
+// Seek replays the snakes' paths up to progress, from where they are if
+// that's on the way, otherwise from the nearest snapshot before it.
+func (s *AvoidingSnake) Seek(progress float64, sys *ledsim.System) {
+	target := s.moves(progress)
+	snapshot := target / avoidingSnakeSnapshotInterval
+	if snapshot >= len(s.snapshots) {
+		snapshot = len(s.snapshots) - 1
+	}
+
+	switch {
+	case snapshot < 0:
+		s.reset(sys)
+	case s.curMove > target || s.curMove < snapshot*avoidingSnakeSnapshotInterval:
+		s.restore(snapshot)
+	}
+	s.move(progress, sys)
+}
+
+// reset puts the snakes back where they start.
+func (s *AvoidingSnake) reset(sys *ledsim.System) {
+	s.walk = rand.New(rand.NewSource(s.walkSeed))
+	s.curMove = 0
+
+	rng := s.walk
+	for i, snake := range s.snakes {
 		snake.comps = make([]*ledsim.LED, len(snake.comps))
+		snake.rng = rng
+
+		if s.randomizeColors {
+			snake.color = s.palette[rng.Intn(len(s.palette))]
+		} else {
+			snake.color = s.palette[i%len(s.palette)]
+		}
 	}
 
 	for _, snake := range s.snakes {
-		m := s.ComputeScoringMap(100)
+		m := s.ComputeScoringMap(sys, 100)
 	candidateSearch:
 		for {
-			candidate := sys.LEDs[rand.Intn(len(sys.LEDs))]
+			candidate := sys.LEDs[rng.Intn(len(sys.LEDs))]
 
 			if m.GetScore(candidate) > 10 {
 				continue
@@ -166,6 +188,38 @@ func (s *AvoidingSnake) OnEnter(sys *ledsim.System) {
 	}
 }
 
+// checkpoint is called before every move. At each snapshot interval it
+// reseeds the walk, so what follows doesn't depend on what came before, and
+// takes a snapshot if there isn't one yet.
+func (s *AvoidingSnake) checkpoint() {
+	if s.curMove%avoidingSnakeSnapshotInterval != 0 {
+		return
+	}
+
+	index := s.curMove / avoidingSnakeSnapshotInterval
+	s.walk = rand.New(rand.NewSource(s.walkSeed ^ int64(index+1)*0x5851F42D4C957F2D))
+	for _, snake := range s.snakes {
+		snake.rng = s.walk
+	}
+
+	if index < len(s.snapshots) {
+		return
+	}
+	bodies := make([][]*ledsim.LED, len(s.snakes))
+	for i, snake := range s.snakes {
+		bodies[i] = append([]*ledsim.LED(nil), snake.comps...)
+	}
+	s.snapshots = append(s.snapshots, bodies)
+}
+
+// restore puts the snakes back to snapshot index.
+func (s *AvoidingSnake) restore(index int) {
+	for i, snake := range s.snakes {
+		snake.comps = append(snake.comps[:0], s.snapshots[index][i]...)
+	}
+	s.curMove = index * avoidingSnakeSnapshotInterval
+}
+
 // func (s *AvoidingSnake) populate(sys *ledsim.System, current *ledsim.LED, pos int, from *ledsim.LED) bool {
 // 	for _, near := range current.Neighbours {
 // 		if near == from {
@@ -212,12 +266,26 @@ func (m *ScoringMap) ScorePath(secondLast, last, to *ledsim.LED, searchDist int)
 
 func (a *AvoidingSnakeInstance) step(sys *ledsim.System, m *ScoringMap) bool {
 	current := a.comps[len(a.comps)-1]
-	sort.Slice(current.Neighbours, func(i, j int) bool {
-		return m.ScorePath(a.comps[len(a.comps)-2], current, current.Neighbours[i], a.searchDist)+rand.Intn(10) <
-			m.ScorePath(a.comps[len(a.comps)-2], current, current.Neighbours[j], a.searchDist)+rand.Intn(10)
+
+	// sort a copy, the order of Neighbours is shared by every effect and has
+	// to stay put for paths to replay the same way
+	type candidate struct {
+		led   *ledsim.LED
+		score int
+	}
+	candidates := make([]candidate, len(current.Neighbours))
+	for i, next := range current.Neighbours {
+		candidates[i] = candidate{
+			led:   next,
+			score: m.ScorePath(a.comps[len(a.comps)-2], current, next, a.searchDist) + a.rng.Intn(10),
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
 	})
 
-	for _, next := range current.Neighbours {
+	for _, c := range candidates {
+		next := c.led
 		if next == current || next == a.comps[len(a.comps)-2] ||
 			next == a.comps[len(a.comps)-3] || next == a.comps[len(a.comps)-4] {
 			continue
@@ -230,31 +298,44 @@ func (a *AvoidingSnakeInstance) step(sys *ledsim.System, m *ScoringMap) bool {
 	return false
 }
 
+// moves returns how many moves the snakes have made at progress.
+func (s *AvoidingSnake) moves(progress float64) int {
+	movement := ((progress * float64(s.dur)) / float64(time.Second)) * s.speed
+	intMov, _ := math.Modf(movement)
+	return int(intMov)
+}
+
+// move steps the snakes forward to where they are at progress. The scoring
+// map is recomputed before every step, so the paths don't depend on the frame
+// rate.
+func (s *AvoidingSnake) move(progress float64, sys *ledsim.System) {
+	for target := s.moves(progress); s.curMove < target; s.curMove++ {
+		s.checkpoint()
+		m := s.ComputeScoringMap(sys, s.scoringDist)
+		for _, snake := range s.snakes {
+			snake.move(sys, m)
+		}
+	}
+}
+
 func (s *AvoidingSnake) Eval(progress float64, sys *ledsim.System) {
-	m := s.ComputeScoringMap(s.scoringDist)
+	s.move(progress, sys)
 	for _, snake := range s.snakes {
-		snake.eval(progress, sys, m)
+		snake.draw()
 	}
 }
 
-func (a *AvoidingSnakeInstance) eval(progress float64, sys *ledsim.System, m *ScoringMap) {
-	movement := ((progress * float64(a.dur)) / float64(time.Second)) * a.speed
-
-	// move the snake
-	intMov, frac := math.Modf(movement)
-	_ = frac
-	for i := 0; i < int(intMov)-a.curMove; i++ {
-		if !a.step(sys, m) {
-			// reverse direction yolo
-			for i, j := 0, len(a.comps)-1; i < j; i, j = i+1, j-1 {
-				a.comps[i], a.comps[j] = a.comps[j], a.comps[i]
-			}
-			a.step(sys, m)
+func (a *AvoidingSnakeInstance) move(sys *ledsim.System, m *ScoringMap) {
+	if !a.step(sys, m) {
+		// reverse direction yolo
+		for i, j := 0, len(a.comps)-1; i < j; i, j = i+1, j-1 {
+			a.comps[i], a.comps[j] = a.comps[j], a.comps[i]
 		}
+		a.step(sys, m)
 	}
+}
 
-	a.curMove = int(intMov)
-
+func (a *AvoidingSnakeInstance) draw() {
 	for i := len(a.comps) - a.head; i >= 0; i-- {
 		led := a.comps[i]
 		// if i == len(a.comps)-a.head {
@@ -287,18 +368,19 @@ func (s *AvoidingSnake) OnExit(sys *ledsim.System) {
 }
 
 var _ ledsim.Effect = (*AvoidingSnake)(nil)
+var _ ledsim.Seekable = (*AvoidingSnake)(nil)
 
 func AvoidingSnakeGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*ledsim.Keyframe {
 	return []*ledsim.Keyframe{
 		{
-			Label:    "AvoidingSnake_FadeIn_" + uuid.New().String(),
+			Label:    "AvoidingSnake_FadeIn_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn,
 			Effect:   NewFadeTransition(FADE_IN),
 			Layer:    2,
 		},
 		{
-			Label:    "AvoidingSnake_Main_" + uuid.New().String(),
+			Label:    "AvoidingSnake_Main_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn + fadeOut + effect,
 			Effect: NewAvoidingSnake(&AvoidingSnakeConfig{
@@ -315,7 +397,7 @@ func AvoidingSnakeGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Ran
 			Layer: 1,
 		},
 		{
-			Label:    "AvoidingSnake_FadeOut_" + uuid.New().String(),
+			Label:    "AvoidingSnake_FadeOut_" + newID(rng),
 			Offset:   fadeIn + effect,
 			Duration: fadeOut,
 			Effect:   NewFadeTransition(FADE_OUT),
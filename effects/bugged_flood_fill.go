@@ -8,7 +8,7 @@ import (
 
 type BuggedFloodFill struct {
 	start     *ledsim.LED
-	distMap   map[*ledsim.LED]int
+	distMap   []int
 	maxGrowth float64
 	decayFunc func(v float64) float64
 	color     colorful.Color
@@ -20,7 +20,6 @@ func NewBuggedFloodFill(start *ledsim.LED, maxGrowth float64, color colorful.Col
 	fadeOut FadeOut, decayFunc func(v float64) float64) *BuggedFloodFill {
 	return &BuggedFloodFill{
 		start:     start,
-		distMap:   make(map[*ledsim.LED]int),
 		maxGrowth: maxGrowth,
 		decayFunc: decayFunc,
 		color:     color,
@@ -29,36 +28,7 @@ func NewBuggedFloodFill(start *ledsim.LED, maxGrowth float64, color colorful.Col
 }
 
 func (b *BuggedFloodFill) OnEnter(sys *ledsim.System) {
-	type queueEntry struct {
-		depth int
-		led   *ledsim.LED
-	}
-
-	queue := []queueEntry{
-		{
-			depth: 0,
-			led:   b.start,
-		},
-	}
-
-	b.distMap[b.start] = 0
-
-	for len(queue) > 0 {
-		top := queue[0]
-		queue = queue[1:]
-
-		for _, neighbor := range top.led.Neighbours {
-			if _, found := b.distMap[neighbor]; found {
-				continue
-			}
-
-			b.distMap[neighbor] = top.depth + 1
-			queue = append(queue, queueEntry{
-				depth: top.depth + 1,
-				led:   neighbor,
-			})
-		}
-	}
+	b.distMap = sys.HopDistances(b.start)
 }
 
 func (b *BuggedFloodFill) OnExit(sys *ledsim.System) {
@@ -70,8 +40,9 @@ func (b *BuggedFloodFill) Eval(progress float64, sys *ledsim.System) {
 		width = b.maxGrowth
 	}
 
-	for led, dist := range b.distMap {
-		if float64(dist) > width {
+	for _, led := range sys.LEDs {
+		dist := b.distMap[led.ID]
+		if dist < 0 || float64(dist) > width {
 			continue
 		}
 
@@ -6,7 +6,6 @@ import (
 
 	"ledsim"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
@@ -46,35 +45,35 @@ var _ ledsim.Effect = (*ColourShift)(nil)
 func ColourShiftGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*ledsim.Keyframe {
 	return []*ledsim.Keyframe{
 		{
-			Label:    "ColourShift_FadeIn_" + uuid.New().String(),
+			Label:    "ColourShift_FadeIn_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn,
 			Effect:   NewFadeTransition(FADE_IN),
 			Layer:    2,
 		},
 		{
-			Label:    "ColourShift_FadeIn_Background" + uuid.New().String(),
+			Label:    "ColourShift_FadeIn_Background" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn,
 			Effect:   NewMonocolour(Golds[0]),
 			Layer:    1,
 		},
 		{
-			Label:    "ColourShift_Main_" + uuid.New().String(),
+			Label:    "ColourShift_Main_" + newID(rng),
 			Offset:   fadeIn,
 			Duration: effect,
 			Effect:   NewColourShift(Golds),
 			Layer:    1,
 		},
 		{
-			Label:    "ColourShift_FadeOut_Background" + uuid.New().String(),
+			Label:    "ColourShift_FadeOut_Background" + newID(rng),
 			Offset:   fadeIn + effect,
 			Duration: fadeOut,
 			Effect:   NewMonocolour(Golds[len(Golds)-1]),
 			Layer:    1,
 		},
 		{
-			Label:    "ColourShift_FadeOut_" + uuid.New().String(),
+			Label:    "ColourShift_FadeOut_" + newID(rng),
 			Offset:   fadeIn + effect,
 			Duration: fadeOut,
 			Effect:   NewFadeTransition(FADE_OUT),
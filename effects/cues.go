@@ -0,0 +1,110 @@
+package effects
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"ledsim"
+)
+
+// CueSpec describes a cue in a cue file. A cue plays either its own
+// keyframes or, if Show is set, the show's main timeline.
+type CueSpec struct {
+	Name      string          `json:"name"`
+	Crossfade *Duration       `json:"crossfade,omitempty"`
+	Show      bool            `json:"show,omitempty"`
+	Keyframes []*KeyframeSpec `json:"keyframes,omitempty"`
+	// End is what the cue does at the end of its timeline, see
+	// ledsim.ParseEndMode. It defaults to hold.
+	End string `json:"end,omitempty"`
+}
+
+// LoadCues reads a JSON array of cue specs and builds their cues. show is
+// the manager played by cues with Show set, and its end mode is left alone.
+// The other cues' keyframes are seeded from seed, normally the show seed, so
+// they're as repeatable as the show. clock is optional, and is what show cues follow, normally the show's audio.
+// The error names every cue that couldn't be built.
+func LoadCues(r io.Reader, sys *ledsim.System, show *ledsim.EffectsManager, seed int64, clock ...ledsim.CueClock) ([]*ledsim.Cue, error) {
+	var specs []*CueSpec
+	if err := json.NewDecoder(r).Decode(&specs); err != nil {
+		return nil, fmt.Errorf("decode cues: %w", err)
+	}
+
+	var cues []*ledsim.Cue
+	var problems []string
+	for i, spec := range specs {
+		cue, err := spec.Build(sys, show, seed, clock...)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cue %d (%q): %v", i, spec.Name, err))
+			continue
+		}
+		cues = append(cues, cue)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid cues: %s", strings.Join(problems, "; "))
+	}
+
+	return cues, nil
+}
+
+// Build checks the spec and creates its cue. seed and clock are as for
+// LoadCues, and clock is optional.
+func (s *CueSpec) Build(sys *ledsim.System, show *ledsim.EffectsManager, seed int64, clock ...ledsim.CueClock) (*ledsim.Cue, error) {
+	if s.Crossfade != nil && *s.Crossfade < 0 {
+		return nil, fmt.Errorf("crossfade must not be negative")
+	}
+
+	cue := &ledsim.Cue{
+		Name: s.Name,
+	}
+	if s.Crossfade != nil {
+		crossfade := time.Duration(*s.Crossfade)
+		cue.Crossfade = &crossfade
+	}
+
+	if s.Show {
+		if len(s.Keyframes) > 0 || s.End != "" {
+			return nil, fmt.Errorf("a show cue can't have keyframes or an end mode")
+		}
+		cue.Manager = show
+		if len(clock) > 0 {
+			cue.Clock = clock[0]
+		}
+		return cue, nil
+	}
+
+	end := ledsim.EndHold
+	if s.End != "" {
+		var err error
+		end, err = ledsim.ParseEndMode(s.End)
+		if err != nil {
+			return nil, err
+		}
+		if end == ledsim.EndHandoff {
+			return nil, fmt.Errorf("cues can't hand off, use another cue instead")
+		}
+	}
+
+	var keyframes []*ledsim.Keyframe
+	var problems []string
+	for i, spec := range s.Keyframes {
+		keyframe, err := spec.Build(sys)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("keyframe %d (%q): %v", i, spec.Label, err))
+			continue
+		}
+		keyframes = append(keyframes, keyframe)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid keyframes: %s", strings.Join(problems, "; "))
+	}
+
+	cue.Manager = ledsim.NewEffectsManager(keyframes)
+	cue.Manager.SetEndMode(end)
+	cue.Manager.SetSeed(seed)
+	return cue, nil
+}
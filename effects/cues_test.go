@@ -0,0 +1,47 @@
+package effects
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+
+	"ledsim"
+)
+
+// renderCue loads a one cue list seeded with seed and returns its colours a
+// few seconds in.
+func renderCue(t *testing.T, sys *ledsim.System, seed int64) []colorful.Color {
+	t.Helper()
+
+	cues, err := LoadCues(strings.NewReader(`[
+		{"name": "sparkle", "keyframes": [{"label": "sparkle", "duration": 10, "effect": "sparkle"}]}
+	]`), sys, ledsim.NewEffectsManager(nil), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := cues[0].Manager
+	for delta := time.Duration(0); delta <= 3*time.Second; delta += 100 * time.Millisecond {
+		manager.Evaluate(sys, delta)
+	}
+
+	colours := make([]colorful.Color, len(sys.LEDs))
+	for i, led := range sys.LEDs {
+		colours[i] = led.Color
+	}
+	return colours
+}
+
+func TestLoadCuesSeed(t *testing.T) {
+	sys := testSystem(t)
+
+	first := renderCue(t, sys, 1)
+	if again := renderCue(t, sys, 1); !sameColours(first, again) {
+		t.Error("a cue rendered differently with the same seed")
+	}
+	if other := renderCue(t, sys, 2); sameColours(first, other) {
+		t.Error("a cue rendered the same with a different seed")
+	}
+}
@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"ledsim"
 	"math"
-	"math/rand"
 	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type Dissolve struct {
+	seeded
 	duration  time.Duration
 	closed    []int          // index of which leds have dissolved
 	currClust []int          // index of current cluster of LEDs we want to dissolve
@@ -20,6 +20,7 @@ type Dissolve struct {
 	remaining []int          // Index of LEDs that are remaining to be dissolved
 	remCount  int            // Counts number LEDs remaining to be dissolved
 	state     []colorful.Color
+	byID      []*ledsim.LED // LEDs of the system indexed by ID
 }
 
 func NewDissolve(duration time.Duration, reqColor colorful.Color, clustSize int, period float64) *Dissolve {
@@ -37,11 +38,15 @@ func (d *Dissolve) OnEnter(sys *ledsim.System) {
 	d.currClust = make([]int, 0)
 	d.remaining = make([]int, 0)
 	d.remCount = ledCount
-	d.state = make([]colorful.Color, ledCount+1)
+	// state is indexed by ID, which may be larger than ledCount if
+	// the effect is limited to a group
+	d.state = make([]colorful.Color, sys.IDCount())
+	d.byID = make([]*ledsim.LED, sys.IDCount())
 
 	for _, led := range sys.LEDs {
 		d.remaining = append(d.remaining, led.ID)
 		d.state[led.ID] = led.Color
+		d.byID[led.ID] = led
 	}
 
 }
@@ -113,15 +118,17 @@ func (d *Dissolve) Eval(progress float64, sys *ledsim.System) {
 				remove(d.remaining, randLedIndx)
 
 			} else {
-				randLedIndx = rand.Intn(ledCount)
+				randLedIndx = sys.LEDs[d.rng().Intn(ledCount)].ID
 				for contains(d.closed, randLedIndx) {
-					randLedIndx = rand.Intn(ledCount)
+					randLedIndx = sys.LEDs[d.rng().Intn(ledCount)].ID
 				}
 			}
 
 			d.currClust = append(d.currClust, randLedIndx)
-			for _, nbr := range sys.LEDs[randLedIndx].Neighbours {
-				d.currClust = append(d.currClust, nbr.ID)
+			for _, nbr := range d.byID[randLedIndx].Neighbours {
+				if sys.Contains(nbr) {
+					d.currClust = append(d.currClust, nbr.ID)
+				}
 			}
 		}
 		fmt.Println("Curr clust: ", len(d.currClust))
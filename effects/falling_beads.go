@@ -1,8 +1,8 @@
 package effects
 
 import (
-	"fmt"
 	"ledsim"
+	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
@@ -14,6 +14,13 @@ import (
 type FallingBeads struct {
 	Beads   []*Inertia
 	Visited map[*ledsim.LED]bool
+	// Dur is how long the effect lasts. It's only used when there's no real
+	// time between frames, such as when evaluated with only a progress, to
+	// step the beads by the change in progress instead.
+	Dur time.Duration
+	// lastProgress is the progress of the previous frame, or -1 before the
+	// first
+	lastProgress float64
 }
 
 // type Inertia struct {
@@ -25,22 +32,39 @@ type FallingBeads struct {
 // 	Gravity    float64
 // }
 
-// speed is in LEDs per second
-func NewFallingBeads() *FallingBeads {
-	return &FallingBeads{
-		Visited: make(map[*ledsim.LED]bool),
+// speed is in LEDs per second. dur is optional, see FallingBeads.Dur.
+func NewFallingBeads(dur ...time.Duration) *FallingBeads {
+	b := &FallingBeads{
+		Visited:      make(map[*ledsim.LED]bool),
+		lastProgress: -1,
 	}
+	if len(dur) > 0 {
+		b.Dur = dur[0]
+	}
+	return b
 }
 
 func (b *FallingBeads) OnEnter(sys *ledsim.System) {
-	fmt.Println("on enter")
-	start := sys.DebugGetLEDByCoord(0.5, 0.5, 1)
+	b.Beads = nil
+	b.lastProgress = -1
+
+	// an empty system has no nearest LED, and a bead needs somewhere to
+	// fall to
+	start := sys.Nearest(0.5, 0.5, 1)
+	if start == nil || len(start.Neighbours) == 0 {
+		return
+	}
+	forward := start.Neighbours[0]
+	if len(start.Neighbours) > 1 {
+		forward = start.Neighbours[1]
+	}
+
 	b.Visited[start] = true
-	b.Visited[start.Neighbours[1]] = true
+	b.Visited[forward] = true
 	b.Beads = []*Inertia{
 		{
 			LED:        start,
-			ForwardLED: start.Neighbours[1],
+			ForwardLED: forward,
 			Velocity:   0.1,
 			Progress:   0,
 			Fluid:      true,
@@ -55,9 +79,25 @@ func (b *FallingBeads) OnExit(sys *ledsim.System) {
 }
 
 func (b *FallingBeads) Eval(progress float64, sys *ledsim.System) {
+	b.EvalContext(ledsim.ProgressContext(progress), sys)
+}
+
+// EvalContext steps the beads by the real time since the last frame, or by
+// the change in progress when there's none.
+func (b *FallingBeads) EvalContext(ctx *ledsim.EvalContext, sys *ledsim.System) {
+	step := ctx.Delta
+	if step == 0 && b.lastProgress >= 0 && ctx.Progress > b.lastProgress {
+		dur := ctx.Duration
+		if dur == 0 {
+			dur = b.Dur
+		}
+		step = time.Duration(float64(dur) * (ctx.Progress - b.lastProgress))
+	}
+	b.lastProgress = ctx.Progress
+
 	outBeads := make([]*Inertia, 0, len(b.Beads))
 	for _, bead := range b.Beads {
-		outBeads = append(outBeads, bead.Evaluate(progress)...)
+		outBeads = append(outBeads, bead.Evaluate(step.Seconds())...)
 	}
 
 	b.Beads = outBeads
@@ -79,3 +119,4 @@ func (b *FallingBeads) Eval(progress float64, sys *ledsim.System) {
 }
 
 var _ ledsim.Effect = (*FallingBeads)(nil)
+var _ ledsim.ContextEffect = (*FallingBeads)(nil)
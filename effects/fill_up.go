@@ -8,7 +8,6 @@ import (
 
 	"ledsim"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
@@ -125,14 +124,14 @@ func FillUpGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*l
 
 	keyframes = append(keyframes,
 		&ledsim.Keyframe{
-			Label:    "FillUp_FadeIn_" + uuid.New().String(),
+			Label:    "FillUp_FadeIn_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn,
 			Effect:   NewFadeTransition(FADE_IN),
 			Layer:    2,
 		},
 		&ledsim.Keyframe{
-			Label:    "FillUp_FadeOut_" + uuid.New().String(),
+			Label:    "FillUp_FadeOut_" + newID(rng),
 			Offset:   fadeIn + effect,
 			Duration: fadeOut,
 			Effect:   NewFadeTransition(FADE_OUT),
@@ -148,7 +147,7 @@ func FillUpGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*l
 
 		keyframes = append(keyframes,
 			&ledsim.Keyframe{
-				Label:    "FillUp_Main_" + strconv.Itoa(i) + "_" + uuid.New().String(),
+				Label:    "FillUp_Main_" + strconv.Itoa(i) + "_" + newID(rng),
 				Offset:   time.Duration(i) * playTime,
 				Duration: playTime,
 				Effect:   NewFillUp(upDuration, downDuration, 0.2, col, distFuncs[rng.Intn(len(distFuncs))]),
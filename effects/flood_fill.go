@@ -12,7 +12,7 @@ import (
 
 type FloodFill struct {
 	start        *ledsim.LED
-	distMap      map[*ledsim.LED]int
+	distMap      []int
 	maxGrowth    float64
 	color        colorful.Color
 	fadeOut      FadeOut
@@ -43,7 +43,6 @@ func NewFloodFill(start *ledsim.LED, maxGrowth float64, color colorful.Color,
 	fadeOut FadeOut, fadeOutStart, fadeInEnd, tailLength float64, tailEaseFunc func(progress float64) float64) *FloodFill {
 	return &FloodFill{
 		start:        start,
-		distMap:      make(map[*ledsim.LED]int),
 		maxGrowth:    maxGrowth,
 		color:        color,
 		fadeOut:      fadeOut,
@@ -55,36 +54,7 @@ func NewFloodFill(start *ledsim.LED, maxGrowth float64, color colorful.Color,
 }
 
 func (b *FloodFill) OnEnter(sys *ledsim.System) {
-	type queueEntry struct {
-		depth int
-		led   *ledsim.LED
-	}
-
-	queue := []queueEntry{
-		{
-			depth: 0,
-			led:   b.start,
-		},
-	}
-
-	b.distMap[b.start] = 0
-
-	for len(queue) > 0 {
-		top := queue[0]
-		queue = queue[1:]
-
-		for _, neighbor := range top.led.Neighbours {
-			if _, found := b.distMap[neighbor]; found {
-				continue
-			}
-
-			b.distMap[neighbor] = top.depth + 1
-			queue = append(queue, queueEntry{
-				depth: top.depth + 1,
-				led:   neighbor,
-			})
-		}
-	}
+	b.distMap = sys.HopDistances(b.start)
 }
 
 func (b *FloodFill) OnExit(sys *ledsim.System) {
@@ -96,8 +66,9 @@ func (b *FloodFill) Eval(progress float64, sys *ledsim.System) {
 		width = b.maxGrowth
 	}
 
-	for led, dist := range b.distMap {
-		if float64(dist) > width {
+	for _, led := range sys.LEDs {
+		dist := b.distMap[led.ID]
+		if dist < 0 || float64(dist) > width {
 			continue
 		}
 
@@ -130,3 +101,44 @@ func (b *FloodFill) Eval(progress float64, sys *ledsim.System) {
 }
 
 var _ ledsim.Effect = (*FloodFill)(nil)
+
+var _ ledsim.Parameterized = (*FloodFill)(nil)
+
+func (b *FloodFill) Params() []ledsim.Param {
+	return []ledsim.Param{
+		{Name: "start", Kind: ledsim.ParamLED, Description: "led the fill grows from"},
+		{Name: "maxGrowth", Kind: ledsim.ParamFloat, Description: "how many hops the fill reaches", Min: 0, Max: 1000, Default: 200.0},
+		{Name: "colour", Kind: ledsim.ParamColour, Default: Golds[0]},
+		{Name: "fadeOut", Kind: ledsim.ParamInt, Description: "0 to ripple back out, 1 to fade", Max: 1, Default: FadeOutRipple},
+		{Name: "fadeOutStart", Kind: ledsim.ParamFloat, Description: "progress at which the fill starts to go", Max: 1, Default: 0.7},
+		{Name: "fadeInEnd", Kind: ledsim.ParamFloat, Description: "progress at which the fill is fully grown", Max: 1, Default: 0.5},
+		{Name: "tailLength", Kind: ledsim.ParamFloat, Description: "length of the soft edge, in hops", Max: 100, Default: 10.0},
+		{Name: "tailEase", Kind: ledsim.ParamEasing, Default: "linear"},
+	}
+}
+
+func (b *FloodFill) SetParam(name string, value interface{}) error {
+	if err := ledsim.CheckParam(b.Params(), name, value); err != nil {
+		return err
+	}
+
+	switch name {
+	case "start":
+		b.start = value.(*ledsim.LED)
+	case "maxGrowth":
+		b.maxGrowth = value.(float64)
+	case "colour":
+		b.color = value.(colorful.Color)
+	case "fadeOut":
+		b.fadeOut = FadeOut(value.(int))
+	case "fadeOutStart":
+		b.fadeOutStart = value.(float64)
+	case "fadeInEnd":
+		b.fadeInEnd = value.(float64)
+	case "tailLength":
+		b.tailLength = value.(float64)
+	case "tailEase":
+		b.tailEaseFunc, _ = ledsim.Easing(value.(string))
+	}
+	return nil
+}
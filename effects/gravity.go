@@ -68,6 +68,17 @@ func (v Vector) Unit() Vector {
 	return v.Mul(1.0 / v.Magnitude())
 }
 
+// PositionOf returns the normalised position of led as a Vector.
+func PositionOf(led *ledsim.LED) Vector {
+	return Vector{X: led.X, Y: led.Y, Z: led.Z}
+}
+
+// DirectionOf returns the unit vector led faces, or the zero vector if the
+// layout doesn't give one.
+func DirectionOf(led *ledsim.LED) Vector {
+	return Vector{X: led.Direction.X, Y: led.Direction.Y, Z: led.Direction.Z}
+}
+
 type Plane struct {
 	Normal Vector
 	Point  Vector
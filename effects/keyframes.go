@@ -0,0 +1,138 @@
+package effects
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"ledsim"
+)
+
+// Duration is a time.Duration in JSON, written as a number of seconds or a
+// string such as "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	value, err := ledsim.Param{Name: "duration", Kind: ledsim.ParamDuration}.Decode(data, nil)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value.(time.Duration))
+	return nil
+}
+
+// KeyframeSpec describes a keyframe whose effect is built from the registry,
+// so keyframes can be written in data files or sent over HTTP.
+type KeyframeSpec struct {
+	ID       string           `json:"id,omitempty"`
+	Label    string           `json:"label"`
+	Offset   Duration         `json:"offset"`
+	Duration Duration         `json:"duration"`
+	Layer    int              `json:"layer,omitempty"`
+	Target   string           `json:"target,omitempty"`
+	Opacity  *float64         `json:"opacity,omitempty"`
+	Blend    ledsim.BlendMode `json:"blend,omitempty"`
+	Effect   string           `json:"effect"`
+	Params   json.RawMessage  `json:"params,omitempty"`
+	// Fallback is rendered in place of the effect if it panics.
+	Fallback *EffectSpec `json:"fallback,omitempty"`
+}
+
+// EffectSpec names a registered effect and its parameters.
+type EffectSpec struct {
+	Effect string          `json:"effect"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Build creates the effect for a keyframe lasting duration.
+func (s *EffectSpec) Build(sys *ledsim.System, duration time.Duration) (ledsim.Effect, error) {
+	return Build(s.Effect, sys, duration, s.Params)
+}
+
+// Build checks the spec and creates its keyframe.
+func (s *KeyframeSpec) Build(sys *ledsim.System) (*ledsim.Keyframe, error) {
+	if s.Offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+	if s.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if s.Opacity != nil && (*s.Opacity < 0 || *s.Opacity > 1) {
+		return nil, fmt.Errorf("opacity must be between 0 and 1, got %v", *s.Opacity)
+	}
+	if _, err := s.Blend.Blending(); err != nil {
+		return nil, err
+	}
+	if s.Target != "" {
+		if _, err := sys.View(s.Target); err != nil {
+			return nil, err
+		}
+	}
+
+	effect, err := Build(s.Effect, sys, time.Duration(s.Duration), s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback ledsim.Effect
+	if s.Fallback != nil {
+		fallback, err = s.Fallback.Build(sys, time.Duration(s.Duration))
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+	}
+
+	return &ledsim.Keyframe{
+		ID:       s.ID,
+		Label:    s.Label,
+		Offset:   time.Duration(s.Offset),
+		Duration: time.Duration(s.Duration),
+		Effect:   effect,
+		Layer:    s.Layer,
+		Target:   s.Target,
+		Opacity:  s.Opacity,
+		Blend:    s.Blend,
+		Fallback: fallback,
+	}, nil
+}
+
+// LoadKeyframes reads a JSON array of keyframe specs and builds them all. The
+// error names every keyframe that couldn't be built.
+func LoadKeyframes(r io.Reader, sys *ledsim.System) ([]*ledsim.Keyframe, error) {
+	var specs []*KeyframeSpec
+	if err := json.NewDecoder(r).Decode(&specs); err != nil {
+		return nil, fmt.Errorf("decode keyframes: %w", err)
+	}
+
+	var keyframes []*ledsim.Keyframe
+	var problems []string
+	ids := make(map[string]bool)
+	for i, spec := range specs {
+		if spec.ID != "" {
+			if ids[spec.ID] {
+				problems = append(problems, fmt.Sprintf("keyframe %d (%q): duplicate ID %q", i, spec.Label, spec.ID))
+				continue
+			}
+			ids[spec.ID] = true
+		}
+
+		keyframe, err := spec.Build(sys)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("keyframe %d (%q): %v", i, spec.Label, err))
+			continue
+		}
+		keyframes = append(keyframes, keyframe)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid keyframes: %s", strings.Join(problems, "; "))
+	}
+
+	return keyframes, nil
+}
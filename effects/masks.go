@@ -0,0 +1,216 @@
+package effects
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"ledsim"
+)
+
+// softEdge maps a signed distance inside an edge (positive is inside) to a
+// weight, fading over softness. A softness of 0 gives a hard edge.
+func softEdge(inside, softness float64) float64 {
+	if softness <= 0 {
+		if inside >= 0 {
+			return 1
+		}
+		return 0
+	}
+	return math.Max(0, math.Min(1, inside/softness+0.5))
+}
+
+func lerpVector(from, to Vector, t float64) Vector {
+	return from.Add(to.Sub(from).Mul(t))
+}
+
+// PlaneMask shows the effect on the side of a plane its normal points
+// towards. The plane moves from From to To over the effect, so it can sweep
+// across the sculpture.
+type PlaneMask struct {
+	Normal   Vector
+	From, To Vector
+	Softness float64
+}
+
+var _ ledsim.Mask = (*PlaneMask)(nil)
+
+func NewPlaneMask(normal, from, to Vector, softness float64) *PlaneMask {
+	return &PlaneMask{
+		Normal:   normal,
+		From:     from,
+		To:       to,
+		Softness: softness,
+	}
+}
+
+func (m *PlaneMask) OnEnter(sys *ledsim.System) {}
+
+func (m *PlaneMask) Weight(progress float64, led *ledsim.LED) float64 {
+	plane := Plane{Normal: m.Normal, Point: lerpVector(m.From, m.To, progress)}
+	return softEdge(plane.DistanceToPlane(PositionOf(led)), m.Softness)
+}
+
+// RadialMask shows the effect inside a sphere around Center whose radius
+// grows (or shrinks) from From to To over the effect.
+type RadialMask struct {
+	Center   Vector
+	From, To float64
+	Softness float64
+}
+
+var _ ledsim.Mask = (*RadialMask)(nil)
+
+func NewRadialMask(center Vector, from, to, softness float64) *RadialMask {
+	return &RadialMask{
+		Center:   center,
+		From:     from,
+		To:       to,
+		Softness: softness,
+	}
+}
+
+func (m *RadialMask) OnEnter(sys *ledsim.System) {}
+
+func (m *RadialMask) Weight(progress float64, led *ledsim.LED) float64 {
+	radius := m.From + (m.To-m.From)*progress
+	dist := PositionOf(led).Sub(m.Center).Magnitude()
+	return softEdge(radius-dist, m.Softness)
+}
+
+// GroupMask shows the effect only on the LEDs of a named group.
+type GroupMask struct {
+	Name string
+	view *ledsim.System
+}
+
+var _ ledsim.Mask = (*GroupMask)(nil)
+
+// NewGroupMask returns a mask for the group called name, which must be one of
+// sys's groups.
+func NewGroupMask(sys *ledsim.System, name string) (*GroupMask, error) {
+	if _, err := sys.View(name); err != nil {
+		return nil, fmt.Errorf("group mask: %w", err)
+	}
+	return &GroupMask{Name: name}, nil
+}
+
+// OnEnter panics if the group doesn't exist, which NewGroupMask rules out
+// unless the groups change.
+func (m *GroupMask) OnEnter(sys *ledsim.System) {
+	view, err := sys.View(m.Name)
+	if err != nil {
+		panic(err)
+	}
+	m.view = view
+}
+
+func (m *GroupMask) Weight(progress float64, led *ledsim.LED) float64 {
+	if m.view.Contains(led) {
+		return 1
+	}
+	return 0
+}
+
+// NoiseMask weights LEDs by smooth 3D value noise that drifts through the
+// sculpture over the effect, for patchy, cloud-like reveals.
+type NoiseMask struct {
+	// Scale is how many noise cells span the sculpture.
+	Scale float64
+	// Speed is how many cells the noise drifts over the effect.
+	Speed float64
+	// Threshold is subtracted from the noise before Contrast is applied,
+	// raise it to show less of the effect.
+	Threshold float64
+	Contrast  float64
+	Seed      int64
+}
+
+var _ ledsim.Mask = (*NoiseMask)(nil)
+
+func NewNoiseMask(scale, speed float64, seed int64) *NoiseMask {
+	return &NoiseMask{
+		Scale:     scale,
+		Speed:     speed,
+		Threshold: 0.5,
+		Contrast:  4,
+		Seed:      seed,
+	}
+}
+
+func (m *NoiseMask) OnEnter(sys *ledsim.System) {}
+
+func (m *NoiseMask) Weight(progress float64, led *ledsim.LED) float64 {
+	drift := progress * m.Speed
+	n := valueNoise(led.X*m.Scale+drift, led.Y*m.Scale, led.Z*m.Scale+drift*0.5, m.Seed)
+	return (n-m.Threshold)*m.Contrast + 0.5
+}
+
+// latticeValue returns a pseudorandom value in [0, 1) for an integer lattice
+// point.
+func latticeValue(x, y, z int, seed int64) float64 {
+	h := uint64(seed)*0x9E3779B97F4A7C15 ^ uint64(x)*0xBF58476D1CE4E5B9 ^
+		uint64(y)*0x94D049BB133111EB ^ uint64(z)*0xD6E8FEB86659FD93
+	h ^= h >> 31
+	h *= 0x7FB5D329728EA185
+	h ^= h >> 27
+	return float64(h>>11) / float64(1<<53)
+}
+
+// valueNoise is trilinearly interpolated lattice noise with smoothstep
+// easing, in [0, 1).
+func valueNoise(x, y, z float64, seed int64) float64 {
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	ix, iy, iz := int(x0), int(y0), int(z0)
+	smooth := func(t float64) float64 { return t * t * (3 - 2*t) }
+	fx, fy, fz := smooth(x-x0), smooth(y-y0), smooth(z-z0)
+
+	lerp := func(a, b, t float64) float64 { return a + (b-a)*t }
+	corner := func(dx, dy, dz int) float64 {
+		return latticeValue(ix+dx, iy+dy, iz+dz, seed)
+	}
+
+	return lerp(
+		lerp(lerp(corner(0, 0, 0), corner(1, 0, 0), fx), lerp(corner(0, 1, 0), corner(1, 1, 0), fx), fy),
+		lerp(lerp(corner(0, 0, 1), corner(1, 0, 1), fx), lerp(corner(0, 1, 1), corner(1, 1, 1), fx), fy),
+		fz,
+	)
+}
+
+// GraphDistanceMask shows the effect on LEDs within a number of hops of
+// Source along the sculpture, with the reach growing from From to To over
+// the effect. LEDs that can't be reached from Source are never shown.
+type GraphDistanceMask struct {
+	Source   *ledsim.LED
+	From, To float64
+	Softness float64
+	dist     []int
+}
+
+var _ ledsim.Mask = (*GraphDistanceMask)(nil)
+
+func NewGraphDistanceMask(source *ledsim.LED, from, to, softness float64) (*GraphDistanceMask, error) {
+	if source == nil {
+		return nil, errors.New("graph distance mask: no source led")
+	}
+	return &GraphDistanceMask{
+		Source:   source,
+		From:     from,
+		To:       to,
+		Softness: softness,
+	}, nil
+}
+
+func (m *GraphDistanceMask) OnEnter(sys *ledsim.System) {
+	m.dist = sys.HopDistances(m.Source)
+}
+
+func (m *GraphDistanceMask) Weight(progress float64, led *ledsim.LED) float64 {
+	d := m.dist[led.ID]
+	if d < 0 {
+		return 0
+	}
+
+	reach := m.From + (m.To-m.From)*progress
+	return softEdge(reach-float64(d), m.Softness)
+}
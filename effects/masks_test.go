@@ -0,0 +1,55 @@
+package effects
+
+import (
+	"strings"
+	"testing"
+
+	"ledsim"
+)
+
+func TestMaskConstructors(t *testing.T) {
+	sys := ledsim.NewSystem()
+	sys.AddLED(&ledsim.LED{})
+	sys.SetGroup(&ledsim.Group{Name: "top", IDs: []int{0}})
+
+	tests := []struct {
+		name  string
+		build func() (ledsim.Mask, error)
+		// err is part of the error expected, or empty for none
+		err string
+	}{
+		{
+			name:  "group",
+			build: func() (ledsim.Mask, error) { return NewGroupMask(sys, "top") },
+		},
+		{
+			name:  "unknown group",
+			build: func() (ledsim.Mask, error) { return NewGroupMask(sys, "bottom") },
+			err:   `group mask: no group named "bottom"`,
+		},
+		{
+			name:  "graph distance",
+			build: func() (ledsim.Mask, error) { return NewGraphDistanceMask(sys.LEDs[0], 0, 3, 1) },
+		},
+		{
+			name:  "graph distance without a source",
+			build: func() (ledsim.Mask, error) { return NewGraphDistanceMask(nil, 0, 3, 1) },
+			err:   "graph distance mask: no source led",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mask, err := test.build()
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("error = %v, want nil", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("error = %v, want it to contain %q", err, test.err)
+			case test.err == "":
+				// a mask that was built can be entered
+				mask.OnEnter(sys)
+			}
+		})
+	}
+}
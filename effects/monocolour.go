@@ -27,3 +27,20 @@ func (s *Monocolour) Eval(progress float64, sys *ledsim.System) {
 
 func (s *Monocolour) OnExit(sys *ledsim.System) {
 }
+
+var _ ledsim.Parameterized = (*Monocolour)(nil)
+
+func (s *Monocolour) Params() []ledsim.Param {
+	return []ledsim.Param{
+		{Name: "colour", Kind: ledsim.ParamColour, Default: Golds[0]},
+	}
+}
+
+func (s *Monocolour) SetParam(name string, value interface{}) error {
+	if err := ledsim.CheckParam(s.Params(), name, value); err != nil {
+		return err
+	}
+
+	s.Color = value.(colorful.Color)
+	return nil
+}
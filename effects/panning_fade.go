@@ -68,3 +68,26 @@ func (p *PanningFade) Eval(progress float64, sys *ledsim.System) {
 func (p *PanningFade) diagonalTravel(x, y float64) float64 {
 	return x*math.Sin(1.57079) + y*math.Cos(1.57079)
 }
+
+var _ ledsim.Parameterized = (*PanningFade)(nil)
+
+func (p *PanningFade) Params() []ledsim.Param {
+	return []ledsim.Param{
+		{Name: "duration", Kind: ledsim.ParamDuration, Description: "length of the keyframe", Default: StandardPeriod},
+		{Name: "speed", Kind: ledsim.ParamFloat, Description: "how fast the bands pan", Max: 10, Default: 1.0},
+	}
+}
+
+func (p *PanningFade) SetParam(name string, value interface{}) error {
+	if err := ledsim.CheckParam(p.Params(), name, value); err != nil {
+		return err
+	}
+
+	switch name {
+	case "duration":
+		p.dur = value.(time.Duration)
+	case "speed":
+		p.speed = value.(float64)
+	}
+	return nil
+}
@@ -3,35 +3,70 @@ package effects
 import (
 	"ledsim"
 	"math"
-	"math/rand"
 	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
 
-const TOTAL_LEDS = 2162
+// coprimeStride returns a number coprime with n, useful in
+// iterating through all n LEDs without actually storing an
+// array that's n large. It is kept near sqrt(n) so that
+// consecutive LEDs land far apart on the sculpture.
+func coprimeStride(n int) int {
+	if n <= 2 {
+		return 1
+	}
+
+	stride := int(math.Sqrt(float64(n)))
+	for gcd(stride, n) != 1 {
+		stride++
+	}
+	return stride
+}
 
-// A number coprime with the total number of LEDs (2162),
-// useful in iterating through all LEDs without actually
-// storing an array that's 2162 large
-const INCREMENT = 45
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
 
-// 689 * 91 = 1 (mod 2162)
-const REVERSE = 1057
+// modInverse returns x such that a * x = 1 (mod n), a must
+// be coprime with n.
+func modInverse(a, n int) int {
+	// extended euclid, tracking only the coefficient of a
+	t, newT := 0, 1
+	r, newR := n, a%n
+	for newR != 0 {
+		q := r / newR
+		t, newT = newT, t-q*newT
+		r, newR = newR, r-q*newR
+	}
+
+	if t < 0 {
+		t += n
+	}
+	return t
+}
 
 type Pseudorandom struct {
+	seeded
 	initial  int
 	duration time.Duration
 	glow     time.Duration
 	start    colorful.Color
 	end      colorful.Color
+
+	total int
+	// reverse maps an LED index back to its place in the
+	// order, it is the inverse of the stride mod total
+	reverse int
 }
 
 // Create a new "random" effect that lights up random LEDs
 // across the sculpture
 func NewPseudorandom(duration, glow time.Duration, start, end colorful.Color) *Pseudorandom {
 	return &Pseudorandom{
-		initial:  rand.Intn(TOTAL_LEDS),
 		duration: duration,
 		glow:     glow,
 		start:    start,
@@ -40,12 +75,23 @@ func NewPseudorandom(duration, glow time.Duration, start, end colorful.Color) *P
 }
 
 func (e *Pseudorandom) OnEnter(system *ledsim.System) {
+	e.total = len(system.LEDs)
+	if e.total > 0 {
+		e.initial = e.rng().Intn(e.total)
+		e.reverse = modInverse(coprimeStride(e.total), e.total)
+	}
+
 	for _, led := range system.LEDs {
 		led.Color = e.start
 	}
 }
 
 func (e *Pseudorandom) Eval(progress float64, system *ledsim.System) {
+	if e.total == 0 {
+		return
+	}
+	total := float64(e.total)
+
 	// our real animation time
 	real_time := float64(e.duration - e.glow)
 
@@ -53,7 +99,7 @@ func (e *Pseudorandom) Eval(progress float64, system *ledsim.System) {
 	current_time := progress * float64(e.duration)
 
 	cycle_behind := current_time - float64(e.glow)
-	intpart, fraction := math.Modf(cycle_behind * TOTAL_LEDS / real_time)
+	intpart, fraction := math.Modf(cycle_behind * total / real_time)
 
 	// the least recent LED index we have to change
 	lower_bound := int(intpart)
@@ -66,20 +112,20 @@ func (e *Pseudorandom) Eval(progress float64, system *ledsim.System) {
 	}
 
 	// the most recent LED index we have to change
-	upper_bound := int(math.Floor(current_time * TOTAL_LEDS / real_time))
+	upper_bound := int(math.Floor(current_time * total / real_time))
 
-	if upper_bound > TOTAL_LEDS {
-		upper_bound = TOTAL_LEDS - 1
+	if upper_bound > e.total {
+		upper_bound = e.total - 1
 	}
 
 	for index, led := range system.LEDs {
 		reversed_index := index - e.initial
 
 		if reversed_index < 0 {
-			reversed_index += TOTAL_LEDS
+			reversed_index += e.total
 		}
 
-		reversed_index = (reversed_index * REVERSE) % TOTAL_LEDS
+		reversed_index = (reversed_index * e.reverse) % e.total
 
 		if reversed_index < lower_bound {
 			led.Color = e.end
@@ -90,7 +136,7 @@ func (e *Pseudorandom) Eval(progress float64, system *ledsim.System) {
 		}
 
 		relative_index := upper_bound - reversed_index
-		curr_frac := (fraction + float64(relative_index)) * real_time / (TOTAL_LEDS * float64(e.glow))
+		curr_frac := (fraction + float64(relative_index)) * real_time / (total * float64(e.glow))
 		led.Color = ledsim.BlendRgb(e.start, e.end, curr_frac)
 	}
 }
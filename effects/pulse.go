@@ -9,11 +9,12 @@ import (
 	"ledsim"
 
 	"github.com/fogleman/ease"
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type Pulse struct {
+	// Dur is the length of the pulse when it's evaluated with only a
+	// progress. With a context, the context's duration is used instead.
 	Dur         time.Duration
 	BaseBright  float64
 	MaxBright   float64
@@ -33,14 +34,66 @@ func (p *Pulse) OnExit(sys *ledsim.System) {
 
 }
 
+var _ ledsim.Parameterized = (*Pulse)(nil)
+var _ ledsim.ContextEffect = (*Pulse)(nil)
+
+func (p *Pulse) Params() []ledsim.Param {
+	return []ledsim.Param{
+		{Name: "duration", Kind: ledsim.ParamDuration, Description: "length of the keyframe", Default: StandardPeriod},
+		{Name: "baseBright", Kind: ledsim.ParamFloat, Description: "brightness between pulses", Max: 1, Default: 0.05},
+		{Name: "maxBright", Kind: ledsim.ParamFloat, Description: "brightness at the peak", Max: 1, Default: 0.9},
+		{Name: "colour", Kind: ledsim.ParamColour, Default: Golds[0]},
+		{Name: "loDur", Kind: ledsim.ParamDuration, Description: "time spent dim", Max: 60, Default: time.Duration(0)},
+		{Name: "hiDur", Kind: ledsim.ParamDuration, Description: "time spent bright", Max: 60, Default: time.Duration(0)},
+		{Name: "upDur", Kind: ledsim.ParamDuration, Description: "time to brighten", Max: 60, Default: StandardPeriod / 6},
+		{Name: "downDur", Kind: ledsim.ParamDuration, Description: "time to dim", Max: 60, Default: StandardPeriod / 6},
+		{Name: "ease", Kind: ledsim.ParamEasing, Default: "in-out-cubic"},
+	}
+}
+
+func (p *Pulse) SetParam(name string, value interface{}) error {
+	if err := ledsim.CheckParam(p.Params(), name, value); err != nil {
+		return err
+	}
+
+	switch name {
+	case "duration":
+		p.Dur = value.(time.Duration)
+	case "baseBright":
+		p.BaseBright = value.(float64)
+	case "maxBright":
+		p.MaxBright = value.(float64)
+	case "colour":
+		p.TargetColor = value.(colorful.Color)
+	case "loDur":
+		p.LoDur = value.(time.Duration)
+	case "hiDur":
+		p.HiDur = value.(time.Duration)
+	case "upDur":
+		p.UpDur = value.(time.Duration)
+	case "downDur":
+		p.DownDur = value.(time.Duration)
+	case "ease":
+		p.EaseFunc, _ = ledsim.Easing(value.(string))
+	}
+	return nil
+}
+
 func (p *Pulse) Eval(progress float64, sys *ledsim.System) {
+	p.EvalContext(ledsim.ProgressContext(progress), sys)
+}
+
+func (p *Pulse) EvalContext(ctx *ledsim.EvalContext, sys *ledsim.System) {
 	var lumin float64
 
 	leds := sys.LEDs
 
 	total := p.LoDur + p.HiDur + p.UpDur + p.DownDur
 
-	t := (float64(p.Dur) * progress / float64(time.Second))
+	t := ctx.Elapsed.Seconds()
+	if ctx.Duration == 0 {
+		t = float64(p.Dur) * ctx.Progress / float64(time.Second)
+	}
 
 	remainder := math.Mod(t, total.Seconds())
 
@@ -79,14 +132,14 @@ func PulseGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*le
 
 	keyframes = append(keyframes,
 		&ledsim.Keyframe{
-			Label:    "Pulse_FadeIn_" + uuid.New().String(),
+			Label:    "Pulse_FadeIn_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn,
 			Effect:   NewFadeTransition(FADE_IN),
 			Layer:    2,
 		},
 		&ledsim.Keyframe{
-			Label:    "Pulse_FadeOut_" + uuid.New().String(),
+			Label:    "Pulse_FadeOut_" + newID(rng),
 			Offset:   fadeIn + effect,
 			Duration: fadeOut,
 			Effect:   NewFadeTransition(FADE_OUT),
@@ -97,7 +150,7 @@ func PulseGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*le
 	for i := 0; i < int(repeats); i++ {
 		keyframes = append(keyframes,
 			&ledsim.Keyframe{
-				Label:    "Pulse_Main_" + strconv.Itoa(i) + "_" + uuid.New().String(),
+				Label:    "Pulse_Main_" + strconv.Itoa(i) + "_" + newID(rng),
 				Offset:   time.Duration(i) * playTime,
 				Duration: playTime,
 				Effect: &Pulse{
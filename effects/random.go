@@ -3,13 +3,13 @@ package effects
 import (
 	"ledsim"
 	"math"
-	"math/rand"
 	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type Random struct {
+	seeded
 	order    []int
 	duration time.Duration
 	glow     time.Duration
@@ -19,7 +19,6 @@ type Random struct {
 
 func NewRandom(duration, glow time.Duration, start, end colorful.Color) *Random {
 	return &Random{
-		order:    make([]int, TOTAL_LEDS),
 		duration: duration,
 		glow:     glow,
 		start:    start,
@@ -28,10 +27,12 @@ func NewRandom(duration, glow time.Duration, start, end colorful.Color) *Random
 }
 
 func (e *Random) OnEnter(system *ledsim.System) {
-	e.order = rand.Perm(TOTAL_LEDS)
+	e.order = e.rng().Perm(len(system.LEDs))
 }
 
 func (e *Random) Eval(progress float64, system *ledsim.System) {
+	total := float64(len(e.order))
+
 	// our real animation time
 	real_time := float64(e.duration - e.glow)
 
@@ -39,7 +40,7 @@ func (e *Random) Eval(progress float64, system *ledsim.System) {
 	current_time := progress * float64(e.duration)
 
 	cycle_behind := current_time - float64(e.glow)
-	intpart, fraction := math.Modf(cycle_behind * TOTAL_LEDS / real_time)
+	intpart, fraction := math.Modf(cycle_behind * total / real_time)
 
 	// the least recent LED index we have to change
 	lower_bound := int(intpart)
@@ -52,10 +53,10 @@ func (e *Random) Eval(progress float64, system *ledsim.System) {
 	}
 
 	// the most recent LED index we have to change
-	upper_bound := int(math.Floor(current_time * TOTAL_LEDS / real_time))
+	upper_bound := int(math.Floor(current_time * total / real_time))
 
-	if upper_bound > TOTAL_LEDS {
-		upper_bound = TOTAL_LEDS - 1
+	if upper_bound > len(e.order) {
+		upper_bound = len(e.order) - 1
 	}
 
 	for index, led := range e.order {
@@ -70,7 +71,7 @@ func (e *Random) Eval(progress float64, system *ledsim.System) {
 		}
 
 		relative_index := upper_bound - index
-		curr_frac := (fraction + float64(relative_index)) * real_time / (TOTAL_LEDS * float64(e.glow))
+		curr_frac := (fraction + float64(relative_index)) * real_time / (total * float64(e.glow))
 		current_led.Color = ledsim.BlendRgb(e.start, e.end, curr_frac)
 	}
 }
@@ -2,13 +2,13 @@ package effects
 
 import (
 	"ledsim"
-	"math/rand"
 	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type RandomGlow struct {
+	seeded
 	order     []int
 	glow_time []float64
 	real_dur  float64
@@ -21,8 +21,6 @@ type RandomGlow struct {
 
 func NewRandomGlow(duration, baseline, deviation time.Duration, start, end colorful.Color) *RandomGlow {
 	return &RandomGlow{
-		order:     make([]int, TOTAL_LEDS),
-		glow_time: make([]float64, TOTAL_LEDS),
 		real_dur:  float64(duration),
 		duration:  duration,
 		baseline:  baseline,
@@ -33,17 +31,20 @@ func NewRandomGlow(duration, baseline, deviation time.Duration, start, end color
 }
 
 func (rg *RandomGlow) OnEnter(sys *ledsim.System) {
-	rg.order = rand.Perm(TOTAL_LEDS)
+	total := len(sys.LEDs)
+	rg.order = rg.rng().Perm(total)
+	rg.glow_time = make([]float64, total)
+	rg.real_dur = float64(rg.duration)
 
-	for i := TOTAL_LEDS - 1; i >= 0; i-- {
-		glow_deviation := (rand.Float64() - 0.5) * float64(rg.deviation)
+	for i := total - 1; i >= 0; i-- {
+		glow_deviation := (rg.rng().Float64() - 0.5) * float64(rg.deviation)
 		glow_time := float64(rg.baseline) + glow_deviation
 
-		led_start := rg.real_dur * (float64(i) / float64(TOTAL_LEDS))
+		led_start := rg.real_dur * (float64(i) / float64(total))
 
 		if led_start+glow_time > float64(rg.duration) {
 			new_start := float64(rg.duration) - glow_time
-			rg.real_dur = new_start * (float64(TOTAL_LEDS) / float64(i))
+			rg.real_dur = new_start * (float64(total) / float64(i))
 		}
 
 		rg.glow_time[i] = glow_time
@@ -54,7 +55,7 @@ func (rg *RandomGlow) Eval(progress float64, sys *ledsim.System) {
 	current_time := progress * float64(rg.duration)
 
 	for index, led_n := range rg.order {
-		start_time := float64(rg.real_dur) * (float64(index) / float64(TOTAL_LEDS))
+		start_time := float64(rg.real_dur) * (float64(index) / float64(len(rg.order)))
 		current_glow := rg.glow_time[led_n]
 
 		if start_time > current_time {
@@ -0,0 +1,368 @@
+package effects
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"ledsim"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Factory builds an effect by name from JSON parameters, see Build.
+type Factory struct {
+	// Params are the parameters the factory accepts. A duration parameter
+	// named "duration" defaults to the keyframe's duration, otherwise a
+	// parameter with no default is required.
+	Params []ledsim.Param
+	Build  func(sys *ledsim.System, values ParamValues) (ledsim.Effect, error)
+}
+
+// ParamValues are decoded parameters, with defaults filled in, keyed by name.
+type ParamValues map[string]interface{}
+
+func (v ParamValues) Float(name string) float64          { return v[name].(float64) }
+func (v ParamValues) Int(name string) int                { return v[name].(int) }
+func (v ParamValues) Duration(name string) time.Duration { return v[name].(time.Duration) }
+func (v ParamValues) Colour(name string) colorful.Color  { return v[name].(colorful.Color) }
+func (v ParamValues) Palette(name string) []colorful.Color {
+	return v[name].([]colorful.Color)
+}
+func (v ParamValues) LED(name string) *ledsim.LED { return v[name].(*ledsim.LED) }
+
+func (v ParamValues) Easing(name string) func(t float64) float64 {
+	f, _ := ledsim.Easing(v[name].(string))
+	return f
+}
+
+var registry = make(map[string]*Factory)
+
+// Register adds a factory under name. It panics if the name is taken.
+func Register(name string, factory *Factory) {
+	if _, found := registry[name]; found {
+		panic(fmt.Sprintf("effect %q is already registered", name))
+	}
+	registry[name] = factory
+}
+
+// Names returns the names of every registered effect, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (*Factory, error) {
+	factory, found := registry[name]
+	if !found {
+		return nil, fmt.Errorf("unknown effect %q", name)
+	}
+	return factory, nil
+}
+
+// Build creates the effect registered under name for a keyframe lasting
+// duration. params is a JSON object of parameters, and may be empty.
+func Build(name string, sys *ledsim.System, duration time.Duration, params json.RawMessage) (ledsim.Effect, error) {
+	factory, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(params)) > 0 {
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return nil, fmt.Errorf("%s: params: %w", name, err)
+		}
+	}
+
+	values := make(ParamValues)
+	var problems []string
+	for _, p := range factory.Params {
+		value, found := raw[p.Name]
+		delete(raw, p.Name)
+
+		switch {
+		case found:
+			decoded, err := p.Decode(value, sys)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			values[p.Name] = decoded
+		case p.Name == "duration" && p.Kind == ledsim.ParamDuration:
+			values[p.Name] = duration
+		case p.Default != nil:
+			values[p.Name] = p.Default
+		default:
+			problems = append(problems, fmt.Sprintf("%s is required", p.Name))
+		}
+	}
+
+	for unknown := range raw {
+		problems = append(problems, fmt.Sprintf("%s: %s", ledsim.ErrUnknownParam, unknown))
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s: %w", name, errors.New(strings.Join(problems, ", ")))
+	}
+
+	effect, err := factory.Build(sys, values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return effect, nil
+}
+
+// randomFrom returns a palette function that picks from palette with the
+// effect's generator.
+func randomFrom(palette []colorful.Color, rng func() *rand.Rand) func() colorful.Color {
+	return func() colorful.Color {
+		return palette[rng().Intn(len(palette))]
+	}
+}
+
+// checkDeviation makes sure every period picked from baseline and deviation
+// is positive.
+func checkDeviation(v ParamValues) error {
+	if v.Duration("baseline") <= 0 || v.Duration("deviation") >= 2*v.Duration("baseline") {
+		return errors.New("baseline must be positive and deviation less than twice baseline")
+	}
+	return nil
+}
+
+func durationParam(description string) ledsim.Param {
+	return ledsim.Param{Name: "duration", Kind: ledsim.ParamDuration, Description: description}
+}
+
+func init() {
+	Register("monocolour", &Factory{
+		Params: (&Monocolour{}).Params(),
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewMonocolour(v.Colour("colour")), nil
+		},
+	})
+
+	Register("fade", &Factory{
+		Params: []ledsim.Param{
+			{Name: "direction", Kind: ledsim.ParamInt, Description: "0 to fade in, 1 to fade out", Max: 1, Default: int(FADE_IN)},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewFadeTransition(FADE_TYPE(v.Int("direction"))), nil
+		},
+	})
+
+	Register("pulse", &Factory{
+		Params: (&Pulse{}).Params(),
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return &Pulse{
+				Dur:         v.Duration("duration"),
+				BaseBright:  v.Float("baseBright"),
+				MaxBright:   v.Float("maxBright"),
+				TargetColor: v.Colour("colour"),
+				LoDur:       v.Duration("loDur"),
+				HiDur:       v.Duration("hiDur"),
+				UpDur:       v.Duration("upDur"),
+				DownDur:     v.Duration("downDur"),
+				EaseFunc:    v.Easing("ease"),
+			}, nil
+		},
+	})
+
+	Register("flood_fill", &Factory{
+		Params: (&FloodFill{}).Params(),
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewFloodFill(v.LED("start"), v.Float("maxGrowth"), v.Colour("colour"),
+				FadeOut(v.Int("fadeOut")), v.Float("fadeOutStart"), v.Float("fadeInEnd"),
+				v.Float("tailLength"), v.Easing("tailEase")), nil
+		},
+	})
+
+	Register("panning_fade", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "speed", Kind: ledsim.ParamFloat, Description: "how fast the bands pan", Max: 10, Default: 1.0},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewPanningFade(v.Duration("duration"), v.Float("speed")), nil
+		},
+	})
+
+	Register("spotlight", &Factory{
+		Params: (&Spotlight{}).Params(),
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			s := NewSpotlight(
+				Vector{X: v.Float("fromX"), Y: v.Float("fromY"), Z: v.Float("fromZ")},
+				Vector{X: v.Float("toX"), Y: v.Float("toY"), Z: v.Float("toZ")},
+				v.Colour("colour"))
+			s.Sharpness = v.Float("sharpness")
+			s.Falloff = v.Float("falloff")
+			return s, nil
+		},
+	})
+
+	Register("sparkle", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "baseline", Kind: ledsim.ParamDuration, Description: "average length of each phase of a sparkle", Max: 60, Default: 2 * time.Second},
+			{Name: "deviation", Kind: ledsim.ParamDuration, Description: "spread of phase lengths", Max: 60, Default: 1500 * time.Millisecond},
+			{Name: "palette", Kind: ledsim.ParamPalette, Default: Golds},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			if err := checkDeviation(v); err != nil {
+				return nil, err
+			}
+			s := NewSparkle(v.Duration("duration"), v.Duration("baseline"), v.Duration("deviation"), nil)
+			s.palette = randomFrom(v.Palette("palette"), s.rng)
+			return s, nil
+		},
+	})
+
+	Register("segment", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "baseline", Kind: ledsim.ParamDuration, Description: "average length of each phase of a chain", Max: 60, Default: time.Second},
+			{Name: "deviation", Kind: ledsim.ParamDuration, Description: "spread of phase lengths", Max: 60, Default: 750 * time.Millisecond},
+			{Name: "palette", Kind: ledsim.ParamPalette, Default: Golds},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			if err := checkDeviation(v); err != nil {
+				return nil, err
+			}
+			s := NewSegment(v.Duration("duration"), v.Duration("baseline"), v.Duration("deviation"), nil)
+			s.palette = randomFrom(v.Palette("palette"), s.rng)
+			return s, nil
+		},
+	})
+
+	Register("segment_shift", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "speed", Kind: ledsim.ParamFloat, Description: "leds per second", Max: 1000, Default: 50.0},
+			{Name: "onWidth", Kind: ledsim.ParamInt, Description: "length of lit segments, in hops", Min: 1, Max: 1000, Default: 30},
+			{Name: "offWidth", Kind: ledsim.ParamInt, Description: "length of gaps, in hops", Min: 1, Max: 1000, Default: 70},
+			{Name: "colour", Kind: ledsim.ParamColour, Default: Golds[0]},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewSegmentShift(v.Duration("duration"), v.Float("speed"), v.Int("onWidth"), v.Int("offWidth"),
+				v.Colour("colour")), nil
+		},
+	})
+
+	Register("snake", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "speed", Kind: ledsim.ParamFloat, Description: "leds per second", Max: 1000, Default: 50.0},
+			{Name: "colour", Kind: ledsim.ParamColour, Default: Golds[0]},
+			{Name: "tailLength", Kind: ledsim.ParamInt, Description: "length of the snake, in leds", Min: 1, Max: 1000, Default: 50},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewSnake(v.Duration("duration"), v.Float("speed"), v.Colour("colour"), v.Int("tailLength")), nil
+		},
+	})
+
+	Register("avoiding_snake", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "speed", Kind: ledsim.ParamFloat, Description: "leds per second", Max: 1000, Default: 20.0},
+			{Name: "palette", Kind: ledsim.ParamPalette, Default: Golds},
+			{Name: "randomizeColours", Kind: ledsim.ParamInt, Description: "1 to pick snake colours at random, 0 to cycle through the palette", Max: 1, Default: 1},
+			{Name: "head", Kind: ledsim.ParamInt, Description: "number of bright leds at the head", Max: 100, Default: 1},
+			{Name: "numSnakes", Kind: ledsim.ParamInt, Min: 1, Max: 200, Default: 25},
+			{Name: "snakeLength", Kind: ledsim.ParamInt, Description: "length of each snake, in leds", Min: 3, Max: 1000, Default: 70},
+			{Name: "searchDist", Kind: ledsim.ParamInt, Description: "how far ahead snakes look for each other", Max: 100, Default: 0},
+			{Name: "scoringDist", Kind: ledsim.ParamInt, Description: "how far snakes keep away from each other", Max: 100, Default: 0},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewAvoidingSnake(&AvoidingSnakeConfig{
+				Duration:        v.Duration("duration"),
+				Speed:           v.Float("speed"),
+				Palette:         v.Palette("palette"),
+				RandomizeColors: v.Int("randomizeColours") == 1,
+				Head:            v.Int("head"),
+				NumSnakes:       v.Int("numSnakes"),
+				SnakeLength:     v.Int("snakeLength"),
+				SearchDist:      v.Int("searchDist"),
+				ScoringDist:     v.Int("scoringDist"),
+			}), nil
+		},
+	})
+
+	Register("colour_shift", &Factory{
+		Params: []ledsim.Param{
+			{Name: "palette", Kind: ledsim.ParamPalette, Default: Golds},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewColourShift(v.Palette("palette")), nil
+		},
+	})
+
+	Register("dissolve", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "colour", Kind: ledsim.ParamColour, Description: "colour leds dissolve to", Default: colorful.Color{}},
+			{Name: "clusterSize", Kind: ledsim.ParamInt, Description: "clusters dissolved at a time", Min: 1, Max: 200, Default: 50},
+			{Name: "period", Kind: ledsim.ParamFloat, Description: "seconds for a cluster to dissolve", Min: 0.05, Max: 10, Default: 0.5},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewDissolve(v.Duration("duration"), v.Colour("colour"), v.Int("clusterSize"), v.Float("period")), nil
+		},
+	})
+
+	randomParams := []ledsim.Param{
+		durationParam("length of the keyframe"),
+		{Name: "glow", Kind: ledsim.ParamDuration, Description: "how long each led takes to change", Max: 60, Default: time.Second},
+		{Name: "start", Kind: ledsim.ParamColour, Default: colorful.Color{}},
+		{Name: "end", Kind: ledsim.ParamColour, Default: Golds[0]},
+	}
+	checkGlow := func(v ParamValues) error {
+		if v.Duration("glow") >= v.Duration("duration") {
+			return errors.New("glow must be shorter than duration")
+		}
+		return nil
+	}
+
+	Register("random", &Factory{
+		Params: randomParams,
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			if err := checkGlow(v); err != nil {
+				return nil, err
+			}
+			return NewRandom(v.Duration("duration"), v.Duration("glow"), v.Colour("start"), v.Colour("end")), nil
+		},
+	})
+
+	Register("pseudorandom", &Factory{
+		Params: randomParams,
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			if err := checkGlow(v); err != nil {
+				return nil, err
+			}
+			return NewPseudorandom(v.Duration("duration"), v.Duration("glow"), v.Colour("start"), v.Colour("end")), nil
+		},
+	})
+
+	Register("random_glow", &Factory{
+		Params: []ledsim.Param{
+			durationParam("length of the keyframe"),
+			{Name: "baseline", Kind: ledsim.ParamDuration, Description: "average time each led takes to change", Max: 60, Default: time.Second},
+			{Name: "deviation", Kind: ledsim.ParamDuration, Description: "spread of change times", Max: 60, Default: 500 * time.Millisecond},
+			{Name: "start", Kind: ledsim.ParamColour, Default: colorful.Color{}},
+			{Name: "end", Kind: ledsim.ParamColour, Default: Golds[0]},
+		},
+		Build: func(sys *ledsim.System, v ParamValues) (ledsim.Effect, error) {
+			return NewRandomGlow(v.Duration("duration"), v.Duration("baseline"), v.Duration("deviation"),
+				v.Colour("start"), v.Colour("end")), nil
+		},
+	})
+}
@@ -0,0 +1,166 @@
+package effects
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"ledsim"
+)
+
+// testSystem loads the embedded layout, which is what the show's effects are
+// written for.
+func testSystem(t *testing.T) *ledsim.System {
+	t.Helper()
+
+	sys := ledsim.NewSystem()
+	if err := ledsim.LoadLEDsFrom(sys, ledsim.EmbeddedLayout()); err != nil {
+		t.Fatal(err)
+	}
+	return sys
+}
+
+// checkErr checks err against the part of the error expected, or none if
+// want is empty.
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("error = %v, want nil", err)
+	case want != "" && err == nil:
+		t.Fatalf("error = nil, want %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Fatalf("error = %v, want it to contain %q", err, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	sys := testSystem(t)
+	tests := []struct {
+		name   string
+		effect string
+		params string
+		// err is part of the error expected, or empty for none
+		err string
+	}{
+		{name: "defaults", effect: "monocolour"},
+		{name: "every param", effect: "snake", params: `{"duration": 5, "speed": 10, "colour": "#ff0000", "tailLength": 20}`},
+		{name: "unknown effect", effect: "fireworks", err: `unknown effect "fireworks"`},
+		{name: "params not an object", effect: "monocolour", params: `["#ff0000"]`, err: "monocolour: params:"},
+		{name: "unknown param", effect: "monocolour", params: `{"color": "#ff0000"}`, err: "monocolour: unknown parameter: color"},
+		{name: "bad value", effect: "monocolour", params: `{"colour": "red"}`, err: "monocolour: colour:"},
+		{name: "out of range", effect: "snake", params: `{"speed": 2000}`, err: "snake: speed must be between 0 and 1000, got 2000"},
+		{name: "required param missing", effect: "flood_fill", err: "flood_fill: start is required"},
+		{name: "led out of range", effect: "flood_fill", params: `{"start": 100000}`, err: "flood_fill: start: led 100000 does not exist"},
+		{name: "led", effect: "flood_fill", params: `{"start": 10}`},
+		{name: "every problem at once", effect: "snake", params: `{"speed": -1, "size": 2}`,
+			err: "snake: speed must be between 0 and 1000, got -1, unknown parameter: size"},
+		{name: "rejected by the factory", effect: "sparkle", params: `{"baseline": 1, "deviation": 3}`,
+			err: "sparkle: baseline must be positive and deviation less than twice baseline"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			effect, err := Build(test.effect, sys, time.Minute, json.RawMessage(test.params))
+			checkErr(t, err, test.err)
+			if test.err == "" && effect == nil {
+				t.Fatal("Build() = nil, want an effect")
+			}
+		})
+	}
+}
+
+func TestBuildDefaultsDurationToKeyframe(t *testing.T) {
+	effect, err := Build("pulse", nil, 3*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dur := effect.(*Pulse).Dur; dur != 3*time.Second {
+		t.Errorf("pulse lasts %v, want the keyframe's 3s", dur)
+	}
+
+	effect, err = Build("pulse", nil, 3*time.Second, json.RawMessage(`{"duration": "1s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dur := effect.(*Pulse).Dur; dur != time.Second {
+		t.Errorf("pulse lasts %v, want the 1s given", dur)
+	}
+}
+
+func TestLoadKeyframes(t *testing.T) {
+	sys := testSystem(t)
+	sys.SetGroup(&ledsim.Group{Name: "first", IDs: []int{0, 1, 2}})
+
+	tests := []struct {
+		name string
+		json string
+		// err is part of the error expected, or empty for none
+		err string
+	}{
+		{
+			name: "valid",
+			json: `[
+				{"label": "a", "offset": 0, "duration": "10s", "effect": "monocolour", "params": {"colour": "#ff0000"}},
+				{"label": "b", "offset": 5, "duration": 5, "layer": 1, "target": "first", "opacity": 0.5, "blend": "add", "effect": "snake"}
+			]`,
+		},
+		{
+			name: "unknown effect",
+			json: `[{"label": "a", "duration": 1, "effect": "fireworks"}]`,
+			err:  `keyframe 0 ("a"): unknown effect "fireworks"`,
+		},
+		{
+			name: "bad param",
+			json: `[{"label": "a", "duration": 1, "effect": "monocolour"}, {"label": "b", "duration": 1, "effect": "snake", "params": {"speed": "fast"}}]`,
+			err:  `keyframe 1 ("b"): snake: speed:`,
+		},
+		{
+			name: "unknown param",
+			json: `[{"label": "a", "duration": 1, "effect": "monocolour", "params": {"color": "#ff0000"}}]`,
+			err:  `keyframe 0 ("a"): monocolour: unknown parameter: color`,
+		},
+		{
+			name: "negative offset",
+			json: `[{"label": "a", "offset": -1, "duration": 1, "effect": "monocolour"}]`,
+			err:  "offset must not be negative",
+		},
+		{
+			name: "no duration",
+			json: `[{"label": "a", "effect": "monocolour"}]`,
+			err:  "duration must be positive",
+		},
+		{
+			name: "opacity out of range",
+			json: `[{"label": "a", "duration": 1, "opacity": 1.5, "effect": "monocolour"}]`,
+			err:  "opacity must be between 0 and 1, got 1.5",
+		},
+		{
+			name: "unknown target",
+			json: `[{"label": "a", "duration": 1, "target": "last", "effect": "monocolour"}]`,
+			err:  `no group named "last"`,
+		},
+		{
+			name: "every bad keyframe is named",
+			json: `[{"label": "a", "effect": "monocolour"}, {"label": "b", "duration": 1, "effect": "monocolour"}, {"label": "c", "duration": 1, "effect": "fireworks"}]`,
+			err:  `invalid keyframes: keyframe 0 ("a"): duration must be positive; keyframe 2 ("c")`,
+		},
+		{
+			name: "not a list",
+			json: `{"label": "a"}`,
+			err:  "decode keyframes:",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyframes, err := LoadKeyframes(strings.NewReader(test.json), sys)
+			checkErr(t, err, test.err)
+			if test.err == "" && len(keyframes) != 2 {
+				t.Fatalf("LoadKeyframes() returned %d keyframes, want 2", len(keyframes))
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package effects
+
+import (
+	"math/rand"
+
+	"github.com/google/uuid"
+)
+
+// seeded is embedded by effects that use randomness. The manager hands each
+// keyframe a seeded generator through SetRand, effects used on their own
+// fall back to a randomly seeded one.
+type seeded struct {
+	r *rand.Rand
+	// base is drawn from the keyframe's generator to derive the generator
+	// of each iteration, see iterate
+	base    int64
+	hasBase bool
+}
+
+func (s *seeded) SetRand(rng *rand.Rand) {
+	s.r = rng
+	s.hasBase = false
+}
+
+// iterate switches to the generator for iteration index of a repeated
+// effect, which is the same whenever that iteration is reached.
+func (s *seeded) iterate(index int) {
+	if !s.hasBase {
+		s.base = s.rng().Int63()
+		s.hasBase = true
+	}
+	s.r = rand.New(rand.NewSource(s.base ^ int64(index+1)*0x5851F42D4C957F2D))
+}
+
+func (s *seeded) rng() *rand.Rand {
+	if s.r == nil {
+		s.r = rand.New(rand.NewSource(rand.Int63()))
+	}
+	return s.r
+}
+
+// newID returns a random UUID drawn from rng, so generated labels are the
+// same for the same seed.
+func newID(rng *rand.Rand) string {
+	return uuid.Must(uuid.NewRandomFromReader(rng)).String()
+}
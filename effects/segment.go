@@ -6,11 +6,11 @@ import (
 
 	"ledsim"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type Segment struct {
+	seeded
 	duration  time.Duration
 	baseline  time.Duration
 	deviation time.Duration
@@ -54,10 +54,24 @@ func (s *Segment) OnEnter(sys *ledsim.System) {
 		s.initialised = true
 	}
 
-	for _, chainToLed := range s.chainToLeds {
-		delta := time.Duration(rand.Float64() * float64(s.deviation))
+	s.iterate(0)
+	s.randomise()
+}
+
+// OnIteration picks new periods, delays and colours for every repetition.
+func (s *Segment) OnIteration(index int, sys *ledsim.System) {
+	s.iterate(index)
+	s.randomise()
+}
+
+func (s *Segment) randomise() {
+	// in chain order, maps iterate randomly and would give each chain
+	// different numbers every time
+	for _, id := range s.chainOrder {
+		chainToLed := s.chainToLeds[id]
+		delta := time.Duration(s.rng().Float64() * float64(s.deviation))
 		chainToLed.period = s.baseline + delta - (s.deviation / 2)
-		chainToLed.delay = time.Duration(rand.Float64() * float64(s.duration))
+		chainToLed.delay = time.Duration(s.rng().Float64() * float64(s.duration))
 		chainToLed.colour = s.palette()
 	}
 }
@@ -108,12 +122,13 @@ func (s *Segment) OnExit(sys *ledsim.System) {
 }
 
 var _ ledsim.Effect = (*Segment)(nil)
+var _ ledsim.Iterating = (*Segment)(nil)
 
 func SegmentGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*ledsim.Keyframe {
-	gold := Golds[rand.Intn(len(Golds))]
+	gold := Golds[rng.Intn(len(Golds))]
 	return []*ledsim.Keyframe{
 		{
-			Label:    "Segment_Main_" + uuid.New().String(),
+			Label:    "Segment_Main_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn + fadeOut + effect,
 			Effect: NewSegment(fadeIn+fadeOut+effect, 1*time.Second, 750*time.Millisecond,
@@ -37,37 +37,16 @@ func (s *SegmentShift) OnExit(sys *ledsim.System) {
 }
 
 func (s *SegmentShift) populate(sys *ledsim.System) {
-	type queueEntry struct {
-		led     *ledsim.LED
-		segment int
-	}
-
-	q := []queueEntry{
-		{
-			led:     sys.LEDs[0],
-			segment: 0,
-		},
-	}
-
-	seen := make(map[*ledsim.LED]bool)
-	seen[sys.LEDs[0]] = true
+	s.segments = make(map[int][]*ledsim.LED)
 
-	for len(q) > 0 {
-		top := q[0]
-		q = q[1:]
-
-		s.segments[top.segment] = append(s.segments[top.segment], top.led)
-
-		for _, led := range top.led.Neighbours {
-			if seen[led] {
-				continue
-			}
-			seen[led] = true
-			q = append(q, queueEntry{
-				led:     led,
-				segment: (top.segment + 1) % (s.onWidth + s.offWidth),
-			})
+	dist := sys.HopDistances(sys.LEDs[0])
+	for _, led := range sys.LEDs {
+		if dist[led.ID] < 0 {
+			continue
 		}
+
+		segment := dist[led.ID] % (s.onWidth + s.offWidth)
+		s.segments[segment] = append(s.segments[segment], led)
 	}
 }
 
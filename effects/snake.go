@@ -3,39 +3,61 @@ package effects
 import (
 	"ledsim"
 	"math"
-	"time"
-
 	"math/rand"
+	"time"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type Snake struct {
+	seeded
 	curMove int
 	snake   []*ledsim.LED
+	length  int
 	dur     time.Duration
 	speed   float64
 	col     colorful.Color
+	// walk picks the snake's turns, it is reseeded with walkSeed to replay
+	// the same path when seeking
+	walk     *rand.Rand
+	walkSeed int64
 }
 
 // speed is in LEDs per second
 func NewSnake(dur time.Duration, speed float64, col colorful.Color, tailLength int) *Snake {
 	return &Snake{
-		snake: make([]*ledsim.LED, tailLength),
-		dur:   dur,
-		speed: speed,
-		col:   col,
+		snake:  make([]*ledsim.LED, tailLength),
+		length: tailLength,
+		dur:    dur,
+		speed:  speed,
+		col:    col,
 	}
 }
 
 func (s *Snake) OnEnter(sys *ledsim.System) {
+	s.walkSeed = s.rng().Int63()
+	s.reset(sys)
+}
+
+// reset puts the snake back where it starts.
+func (s *Snake) reset(sys *ledsim.System) {
+	s.walk = rand.New(rand.NewSource(s.walkSeed))
+	s.snake = make([]*ledsim.LED, s.length)
+	s.curMove = 0
+
 	// pick a random LED to start from
-	start := sys.LEDs[rand.Intn(len(sys.LEDs))]
+	start := sys.LEDs[s.walk.Intn(len(sys.LEDs))]
 
 	s.snake[0] = start
 	s.populate(sys, start, 1, nil)
 }
 
+// Seek replays the snake's path from the start up to progress.
+func (s *Snake) Seek(progress float64, sys *ledsim.System) {
+	s.reset(sys)
+	s.move(progress, sys)
+}
+
 func (s *Snake) populate(sys *ledsim.System, current *ledsim.LED, pos int, from *ledsim.LED) bool {
 	for _, near := range current.Neighbours {
 		if near == from {
@@ -58,7 +80,7 @@ func (s *Snake) populate(sys *ledsim.System, current *ledsim.LED, pos int, from
 func (s *Snake) step(sys *ledsim.System) bool {
 	current := s.snake[len(s.snake)-1]
 	for attempts := 0; attempts < 100; attempts++ {
-		near := current.Neighbours[rand.Intn(len(current.Neighbours))]
+		near := current.Neighbours[s.walk.Intn(len(current.Neighbours))]
 
 		if near == s.snake[len(s.snake)-2] {
 			continue
@@ -76,7 +98,9 @@ func (s *Snake) step(sys *ledsim.System) bool {
 	return false
 }
 
-func (s *Snake) Eval(progress float64, sys *ledsim.System) {
+// move steps the snake forward to where it is at progress, and returns how
+// far it is towards the next LED.
+func (s *Snake) move(progress float64, sys *ledsim.System) float64 {
 	movement := ((progress * float64(s.dur)) / float64(time.Second)) * s.speed
 
 	// move the snake
@@ -93,6 +117,12 @@ func (s *Snake) Eval(progress float64, sys *ledsim.System) {
 
 	s.curMove = int(intMov)
 
+	return frac
+}
+
+func (s *Snake) Eval(progress float64, sys *ledsim.System) {
+	frac := s.move(progress, sys)
+
 	col := s.col
 
 	for i, led := range s.snake {
@@ -116,3 +146,4 @@ func (s *Snake) OnExit(sys *ledsim.System) {
 }
 
 var _ ledsim.Effect = (*Snake)(nil)
+var _ ledsim.Seekable = (*Snake)(nil)
@@ -0,0 +1,103 @@
+package effects
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+
+	"ledsim"
+)
+
+// render evaluates effect at progress on a black sculpture and returns the
+// colours.
+func render(effect ledsim.Effect, progress float64, sys *ledsim.System) []colorful.Color {
+	colours := make([]colorful.Color, len(sys.LEDs))
+	for _, led := range sys.LEDs {
+		led.Color = colorful.Color{}
+	}
+	effect.Eval(progress, sys)
+	for i, led := range sys.LEDs {
+		colours[i] = led.Color
+	}
+	return colours
+}
+
+func sameColours(a, b []colorful.Color) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSnakeSeek(t *testing.T) {
+	sys := testSystem(t)
+	const frames = 600
+
+	tests := []struct {
+		name  string
+		build func() ledsim.Effect
+	}{
+		{
+			name:  "snake",
+			build: func() ledsim.Effect { return NewSnake(time.Minute, 20, Golds[0], 30) },
+		},
+		{
+			// 20 moves a second for a minute passes several snapshots
+			name: "avoiding snake",
+			build: func() ledsim.Effect {
+				return NewAvoidingSnake(&AvoidingSnakeConfig{
+					Duration:        time.Minute,
+					Speed:           20,
+					Palette:         Golds,
+					RandomizeColors: true,
+					Head:            1,
+					NumSnakes:       5,
+					SnakeLength:     30,
+					ScoringDist:     5,
+				})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// played straight through, frame by frame
+			straight := test.build()
+			ledsim.SeedEffect(straight, rand.New(rand.NewSource(1)))
+			straight.OnEnter(sys)
+			want := make([][]colorful.Color, frames+1)
+			for frame := 0; frame <= frames; frame++ {
+				want[frame] = render(straight, float64(frame)/frames, sys)
+			}
+
+			seeked := test.build()
+			ledsim.SeedEffect(seeked, rand.New(rand.NewSource(1)))
+			seeked.OnEnter(sys)
+
+			// forwards from the start, then back, and forwards again
+			// from where it is
+			for _, frame := range []int{450, 90, 100, 590, 240, 0, 600} {
+				progress := float64(frame) / frames
+				ledsim.SeekEffect(seeked, progress, sys)
+				if !sameColours(render(seeked, progress, sys), want[frame]) {
+					t.Fatalf("seeking to frame %d rendered differently to playing to it", frame)
+				}
+			}
+
+			// entering again with the same seed starts the same walk
+			ledsim.SeedEffect(seeked, rand.New(rand.NewSource(1)))
+			seeked.OnEnter(sys)
+			ledsim.SeekEffect(seeked, 0.5, sys)
+			if !sameColours(render(seeked, 0.5, sys), want[frames/2]) {
+				t.Fatal("seeking after entering again rendered differently to playing")
+			}
+		})
+	}
+}
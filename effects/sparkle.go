@@ -6,11 +6,11 @@ import (
 
 	"ledsim"
 
-	"github.com/google/uuid"
 	"github.com/lucasb-eyer/go-colorful"
 )
 
 type Sparkle struct {
+	seeded
 	ledPeriods []time.Duration
 	delay      []time.Duration
 	colors     []colorful.Color
@@ -30,13 +30,24 @@ func NewSparkle(duration, baseline, deviation time.Duration, palette func() colo
 }
 
 func (s *Sparkle) OnEnter(sys *ledsim.System) {
+	s.iterate(0)
+	s.randomise(sys)
+}
+
+// OnIteration picks new periods, delays and colours for every repetition.
+func (s *Sparkle) OnIteration(index int, sys *ledsim.System) {
+	s.iterate(index)
+	s.randomise(sys)
+}
+
+func (s *Sparkle) randomise(sys *ledsim.System) {
 	s.ledPeriods = make([]time.Duration, len(sys.LEDs))
 	s.delay = make([]time.Duration, len(sys.LEDs))
 	s.colors = make([]colorful.Color, len(sys.LEDs))
 	for i := range sys.LEDs {
-		delta := time.Duration(rand.Float64() * float64(s.deviation))
+		delta := time.Duration(s.rng().Float64() * float64(s.deviation))
 		s.ledPeriods[i] = s.baseline + delta - (s.deviation / 2)
-		s.delay[i] = time.Duration(rand.Float64() * float64(s.duration))
+		s.delay[i] = time.Duration(s.rng().Float64() * float64(s.duration))
 		s.colors[i] = s.palette()
 	}
 }
@@ -85,12 +96,13 @@ func (s *Sparkle) OnExit(sys *ledsim.System) {
 }
 
 var _ ledsim.Effect = (*Sparkle)(nil)
+var _ ledsim.Iterating = (*Sparkle)(nil)
 
 func SparkleGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*ledsim.Keyframe {
-	gold := Golds[rand.Intn(len(Golds))]
+	gold := Golds[rng.Intn(len(Golds))]
 	return []*ledsim.Keyframe{
 		{
-			Label:    "Sparkle_Main_" + uuid.New().String(),
+			Label:    "Sparkle_Main_" + newID(rng),
 			Offset:   0,
 			Duration: fadeIn + fadeOut + effect,
 			Effect: NewSparkle(fadeIn+fadeOut+effect, 2*time.Second, 1500*time.Millisecond,
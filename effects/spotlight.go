@@ -0,0 +1,146 @@
+package effects
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"ledsim"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Spotlight lights LEDs by how directly they face a virtual light that moves
+// from From to To over the life of the effect. LEDs facing away from the light,
+// or whose facing isn't known, are left alone.
+type Spotlight struct {
+	From, To Vector
+	Color    colorful.Color
+	// Sharpness narrows the lit area, 1 is plain Lambert shading.
+	Sharpness float64
+	// Falloff dims LEDs further from the light, 0 disables it.
+	Falloff float64
+}
+
+var _ ledsim.Effect = (*Spotlight)(nil)
+
+func NewSpotlight(from, to Vector, color colorful.Color) *Spotlight {
+	return &Spotlight{
+		From:      from,
+		To:        to,
+		Color:     color,
+		Sharpness: 2,
+	}
+}
+
+func (s *Spotlight) OnEnter(sys *ledsim.System) {}
+
+func (s *Spotlight) OnExit(sys *ledsim.System) {}
+
+var _ ledsim.Parameterized = (*Spotlight)(nil)
+
+func (s *Spotlight) Params() []ledsim.Param {
+	return []ledsim.Param{
+		{Name: "fromX", Kind: ledsim.ParamFloat, Description: "where the light starts", Min: -2, Max: 3, Default: -0.5},
+		{Name: "fromY", Kind: ledsim.ParamFloat, Min: -2, Max: 3, Default: 0.5},
+		{Name: "fromZ", Kind: ledsim.ParamFloat, Min: -2, Max: 3, Default: 1.0},
+		{Name: "toX", Kind: ledsim.ParamFloat, Description: "where the light ends", Min: -2, Max: 3, Default: 1.5},
+		{Name: "toY", Kind: ledsim.ParamFloat, Min: -2, Max: 3, Default: 0.5},
+		{Name: "toZ", Kind: ledsim.ParamFloat, Min: -2, Max: 3, Default: 1.0},
+		{Name: "colour", Kind: ledsim.ParamColour, Default: Golds[0]},
+		{Name: "sharpness", Kind: ledsim.ParamFloat, Description: "narrows the lit area", Max: 32, Default: 2.0},
+		{Name: "falloff", Kind: ledsim.ParamFloat, Description: "dims leds further from the light", Max: 100, Default: 0.0},
+	}
+}
+
+func (s *Spotlight) SetParam(name string, value interface{}) error {
+	if err := ledsim.CheckParam(s.Params(), name, value); err != nil {
+		return err
+	}
+
+	switch name {
+	case "fromX":
+		s.From.X = value.(float64)
+	case "fromY":
+		s.From.Y = value.(float64)
+	case "fromZ":
+		s.From.Z = value.(float64)
+	case "toX":
+		s.To.X = value.(float64)
+	case "toY":
+		s.To.Y = value.(float64)
+	case "toZ":
+		s.To.Z = value.(float64)
+	case "colour":
+		s.Color = value.(colorful.Color)
+	case "sharpness":
+		s.Sharpness = value.(float64)
+	case "falloff":
+		s.Falloff = value.(float64)
+	}
+	return nil
+}
+
+func (s *Spotlight) Eval(progress float64, sys *ledsim.System) {
+	light := s.From.Add(s.To.Sub(s.From).Mul(progress))
+
+	for _, led := range sys.LEDs {
+		facing := DirectionOf(led)
+		if facing.Magnitude() == 0 {
+			continue
+		}
+
+		toLight := light.Sub(PositionOf(led))
+		dist := toLight.Magnitude()
+		if dist == 0 {
+			led.Color = s.Color
+			continue
+		}
+
+		lambert := facing.Dot(toLight.Mul(1 / dist))
+		if lambert <= 0 {
+			continue
+		}
+
+		intensity := math.Pow(lambert, s.Sharpness)
+		if s.Falloff > 0 {
+			intensity /= 1 + s.Falloff*dist*dist
+		}
+
+		led.Color = led.Color.BlendRgb(s.Color, intensity)
+	}
+}
+
+// SpotlightGenerator sweeps a gold spotlight across the sculpture from one
+// side to the other.
+func SpotlightGenerator(fadeIn, effect, fadeOut time.Duration, rng *rand.Rand) []*ledsim.Keyframe {
+	from := Vector{X: -0.5, Y: rng.Float64(), Z: 0.5 + rng.Float64()}
+	to := Vector{X: 1.5, Y: rng.Float64(), Z: 0.5 + rng.Float64()}
+	if rng.Intn(2) == 0 {
+		from, to = to, from
+	}
+
+	return []*ledsim.Keyframe{
+		{
+			Label:    "Spotlight_FadeIn_" + newID(rng),
+			Offset:   0,
+			Duration: fadeIn,
+			Effect:   NewFadeTransition(FADE_IN),
+			Layer:    2,
+		},
+		{
+			Label:    "Spotlight_Main_" + newID(rng),
+			Offset:   0,
+			Duration: fadeIn + effect + fadeOut,
+			Effect:   NewSpotlight(from, to, Golds[rng.Intn(len(Golds))]),
+			Layer:    1,
+		},
+		{
+			Label:    "Spotlight_FadeOut_" + newID(rng),
+			Offset:   fadeIn + effect,
+			Duration: fadeOut,
+			Effect:   NewFadeTransition(FADE_OUT),
+			Layer:    2,
+		},
+	}
+}
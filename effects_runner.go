@@ -1,7 +1,9 @@
 package ledsim
 
 import (
+	"fmt"
 	"log"
+	"math/rand"
 	"runtime/debug"
 	"sort"
 	"time"
@@ -10,75 +12,170 @@ import (
 )
 
 const (
-	bucketSize = time.Second
+	// seekThreshold is how far the show time can jump forward between
+	// frames before it's treated as a seek
+	seekThreshold = time.Second
 )
 
 type Keyframe struct {
+	// ID identifies the keyframe in the show. The manager gives keyframes
+	// without one a numeric ID, which doesn't change while it runs.
+	ID       string
 	Label    string
 	Offset   time.Duration
 	Duration time.Duration
 	Effect   Effect
 	Layer    int
+	// Target is the name of the group the effect is limited to, or empty
+	// for the whole sculpture. See System.View.
+	Target string
+	// Opacity is how strongly the effect is composited onto the layers
+	// below, from 0 to 1. nil means fully opaque.
+	Opacity *float64
+	// Blend is how the effect is composited onto the layers below. If
+	// both Blend and Opacity are unset the effect draws directly over the
+	// lower layers instead, and can read and modify them.
+	Blend BlendMode
+	// Fallback is rendered in place of Effect if it panics. If it's nil the
+	// manager's fallback is used, see EffectsManager.SetFallback.
+	Fallback Effect
 }
 
 func (k *Keyframe) EndOffset() time.Duration {
 	return k.Offset + k.Duration
 }
 
+// composited reports whether the keyframe is rendered on its own and then
+// composited, rather than drawn directly over the layers below.
+func (k *Keyframe) composited() bool {
+	return k.Opacity != nil || k.Blend != BlendNone
+}
+
+func (k *Keyframe) opacity() float64 {
+	if k.Opacity == nil {
+		return 1
+	}
+	return *k.Opacity
+}
+
 type EffectsManager struct {
-	keyframeBuckets  [][]*Keyframe // each bucket is 1 second
-	lastKeyframes    []*Keyframe
-	blacklist        map[*Keyframe]bool
-	lastLoopEnd      time.Duration
-	lastDelta        time.Duration
-	justFinishedLoop bool
+	timeline      *intervalTree
+	lastKeyframes []*Keyframe
+	blacklist     map[*Keyframe]*blacklistEntry
+	lastLoopEnd   time.Duration
+	lastDelta     time.Duration
+	// endMode is what happens at the end of the timeline, see SetEndMode.
+	// Once it has finished, endedAt is when it did and held is the frame
+	// EndHold shows.
+	endMode  EndMode
+	handoff  *EffectsManager
+	finished bool
+	endedAt  time.Duration
+	held     Framebuffer
+	// outside holds the colours of every LED while a targeted keyframe
+	// runs, so that anything it writes outside its group can be undone
+	outside []colorful.Color
+	// below holds the composite of the lower layers while a composited
+	// keyframe runs
+	below      []colorful.Color
+	compositor *compositor
+	// seed is the show seed, see SetSeed
+	seed int64
+	// active holds the state of each keyframe between OnEnter and OnExit
+	active map[*Keyframe]*keyframeState
+	frame  int
+	// ids maps each keyframe's ID to it
+	ids    map[string]*Keyframe
+	nextID int
+	index  keyframeIndex
+	// fallback and blacklistHook are set with SetFallback and
+	// OnBlacklistChange
+	fallback      func(keyframe *Keyframe) Effect
+	blacklistHook func(entries []BlacklistEntry)
+	// resume holds retried keyframes, which are seeked to where they are
+	// when they're entered again
+	resume map[*Keyframe]bool
 }
 
-var blackFrame = &Keyframe{
-	Effect: LEDEffect(func(p float64, led *LED) {
-		led.Color = colorful.Color{0, 0, 0}
-	}),
+// keyframeState is what the manager keeps for a running keyframe to build
+// its EvalContext.
+type keyframeState struct {
+	rng         *rand.Rand
+	lastElapsed time.Duration
+	evaluated   bool
 }
 
 func NewEffectsManager(keyframes []*Keyframe) *EffectsManager {
-	var keyframeBuckets [][]*Keyframe
-
-	for {
-		var bucket []*Keyframe
-		lower := time.Duration(len(keyframeBuckets)) * bucketSize
-		upper := time.Duration(len(keyframeBuckets)+1) * bucketSize
-
-		outOfBounds := true
-		// bucketizing algorithm runs in O(n^2), could optimize to run faster.
-		for _, keyframe := range keyframes {
-			if (keyframe.Offset < lower && keyframe.EndOffset() > lower) ||
-				(keyframe.Offset >= lower && keyframe.Offset < upper) {
-				bucket = append(bucket, keyframe)
-				outOfBounds = false
-			} else if keyframe.Offset > upper {
-				outOfBounds = false
-			}
-		}
+	r := &EffectsManager{
+		timeline:      newIntervalTree(nil),
+		lastKeyframes: []*Keyframe{},
+		blacklist:     make(map[*Keyframe]*blacklistEntry),
+		lastLoopEnd:   0,
+		lastDelta:     0,
+		compositor:    newCompositor(),
+		active:        make(map[*Keyframe]*keyframeState),
+		ids:           make(map[string]*Keyframe),
+		resume:        make(map[*Keyframe]bool),
+	}
 
-		if outOfBounds {
-			break
+	for _, keyframe := range keyframes {
+		if err := r.insert(keyframe); err != nil {
+			log.Printf("warn: %v, giving %q a new ID", err, keyframe.Label)
+			keyframe.ID = ""
+			r.insert(keyframe)
 		}
+	}
+	r.updateSnapshot()
+
+	return r
+}
 
-		sort.Slice(bucket, func(i, j int) bool {
-			return bucket[i].Layer < bucket[j].Layer
-		})
+// AddKeyframe adds keyframe to the show, giving it an ID if it doesn't have
+// one. It's entered on the next Evaluate if it's running by then. Keyframes
+// that don't last any time are rejected, as they'd never run. Like the rest
+// of the manager it must only be called from the goroutine running Evaluate,
+// use QueueEdit from anywhere else.
+func (r *EffectsManager) AddKeyframe(keyframe *Keyframe) error {
+	if keyframe.Duration <= 0 {
+		return fmt.Errorf("keyframe %q must last longer than 0s, got %v", keyframe.Label, keyframe.Duration)
+	}
+	if err := r.insert(keyframe); err != nil {
+		return err
+	}
+	r.updateSnapshot()
+	return nil
+}
 
-		keyframeBuckets = append(keyframeBuckets, bucket)
+func (r *EffectsManager) insert(keyframe *Keyframe) error {
+	if r.timeline.Contains(keyframe) {
+		return nil
+	}
+	if keyframe.ID != "" && r.ids[keyframe.ID] != nil {
+		return fmt.Errorf("duplicate keyframe ID %q", keyframe.ID)
 	}
 
-	return &EffectsManager{
-		keyframeBuckets:  keyframeBuckets,
-		lastKeyframes:    []*Keyframe{},
-		blacklist:        make(map[*Keyframe]bool),
-		lastLoopEnd:      0,
-		lastDelta:        0,
-		justFinishedLoop: false,
+	r.assignID(keyframe)
+	r.ids[keyframe.ID] = keyframe
+	r.timeline.Insert(keyframe)
+	return nil
+}
+
+// RemoveKeyframe removes keyframe from the show, and reports whether it was
+// in it. If it's running it's exited on the next Evaluate.
+func (r *EffectsManager) RemoveKeyframe(keyframe *Keyframe) bool {
+	if !r.timeline.Remove(keyframe) {
+		return false
 	}
+	delete(r.ids, keyframe.ID)
+	r.clear(keyframe)
+	r.updateSnapshot()
+	return true
+}
+
+// Length returns the length of one loop of the show, which is when its last
+// keyframe ends.
+func (r *EffectsManager) Length() time.Duration {
+	return r.timeline.End()
 }
 
 func isKeyframeIn(needle *Keyframe, haystack []*Keyframe) bool {
@@ -93,93 +190,179 @@ func isKeyframeIn(needle *Keyframe, haystack []*Keyframe) bool {
 var emptyKeyFrames = make([]*Keyframe, 1)
 
 func (r *EffectsManager) Evaluate(system *System, delta time.Duration) {
+	r.applyEdits(system)
 
-	var loopTime = delta - r.lastLoopEnd
-	bucketNum := int(loopTime / bucketSize)
+	seeked := r.frame > 0 && (delta < r.lastDelta || delta-r.lastDelta > seekThreshold)
 
-	if bucketNum == (len(r.keyframeBuckets)) {
-		for _, keyFrame := range r.lastKeyframes {
-			r.exitAnimations(keyFrame, system)
-		}
+	loopTime := r.advance(delta, system)
+	r.lastDelta = delta
 
-		// Recalculate the loopTime because we are in a new iteration of animation loop
-		r.lastLoopEnd = r.lastDelta
-		loopTime = delta - r.lastLoopEnd
-		bucketNum = 0
+	if r.finished {
+		r.renderEnd(system, delta)
+		r.frame++
+		return
 	}
-	r.lastDelta = delta
 
-	bucket := r.keyframeBuckets[bucketNum]
-	currentKeyframes := make([]*Keyframe, 0, len(bucket))
+	// blacklisted keyframes stay in even if they render nothing, so they
+	// still exit when they end
+	currentKeyframes := r.timeline.At(loopTime)
 
-	for _, keyframe := range bucket {
-		if loopTime >= keyframe.Offset && loopTime < keyframe.EndOffset() && !r.blacklist[keyframe] {
-			currentKeyframes = append(currentKeyframes, keyframe)
-		}
-	}
+	// keyframes come out ordered by offset, the compositor needs them by
+	// layer
+	sort.SliceStable(currentKeyframes, func(i, j int) bool {
+		return currentKeyframes[i].Layer < currentKeyframes[j].Layer
+	})
 
-	if !r.justFinishedLoop {
-		for _, lastKeyframe := range r.lastKeyframes {
-			if !isKeyframeIn(lastKeyframe, currentKeyframes) && !r.blacklist[lastKeyframe] {
-				r.exitAnimations(lastKeyframe, system)
-			}
+	for _, lastKeyframe := range r.lastKeyframes {
+		if !isKeyframeIn(lastKeyframe, currentKeyframes) {
+			r.exitAnimations(lastKeyframe, system)
 		}
 	}
 
 	for _, keyframe := range currentKeyframes {
-		if r.blacklist[keyframe] {
+		if r.effect(keyframe) == nil {
 			continue
 		}
 
-		if !isKeyframeIn(keyframe, r.lastKeyframes) || r.justFinishedLoop {
+		if !isKeyframeIn(keyframe, r.lastKeyframes) {
 			r.enterAnimation(keyframe, system)
 		}
 	}
 
-	// Clear canvas before running other animations
-	blackFrame.Effect.Eval(0, system)
-
 	for _, keyframe := range currentKeyframes {
-		if r.blacklist[keyframe] {
-			continue
+		if (seeked || r.resume[keyframe]) && r.effect(keyframe) != nil {
+			r.seekAnimation(keyframe, float64(loopTime-keyframe.Offset)/float64(keyframe.Duration), system)
 		}
+		delete(r.resume, keyframe)
+	}
 
-		progress := float64(loopTime-keyframe.Offset) / float64(keyframe.Duration)
+	// each layer starts from the composite of the layers below, on a
+	// black canvas
+	r.compositor.render(system, currentKeyframes, func(keyframe *Keyframe) {
+		if r.effect(keyframe) == nil {
+			return
+		}
 
-		r.runAnimation(keyframe, progress, system)
-	}
+		r.runAnimation(keyframe, r.context(keyframe, loopTime, delta), system)
+	})
 
 	r.lastKeyframes = currentKeyframes
-	r.justFinishedLoop = false
+	r.frame++
+}
+
+// context builds the EvalContext for keyframe at loopTime into the loop.
+func (r *EffectsManager) context(keyframe *Keyframe, loopTime, showTime time.Duration) *EvalContext {
+	state := r.active[keyframe]
+	if state == nil {
+		state = &keyframeState{rng: r.keyframeRand(keyframe)}
+		r.active[keyframe] = state
+	}
+
+	elapsed := loopTime - keyframe.Offset
+	ctx := &EvalContext{
+		Progress: float64(elapsed) / float64(keyframe.Duration),
+		Duration: keyframe.Duration,
+		Elapsed:  elapsed,
+		ShowTime: showTime,
+		Frame:    r.frame,
+		Rand:     state.rng,
+	}
+	if state.evaluated {
+		ctx.Delta = elapsed - state.lastElapsed
+	}
+	state.lastElapsed = elapsed
+	state.evaluated = true
+
+	return ctx
 }
 
 func (r *EffectsManager) enterAnimation(keyframe *Keyframe, system *System) {
-	defer func() {
-		if rec := recover(); rec != nil {
-			log.Printf("warn: panic OnEnter with effect %q: %v\n%s",
-				keyframe.Label, rec, string(debug.Stack()))
-			log.Printf("warn: %q will be blacklisted", keyframe.Label)
-			r.blacklist[keyframe] = true
-		}
-	}()
+	defer r.recoverEffect(keyframe, "OnEnter", system)
 	log.Println("entering:", keyframe.Label)
-	keyframe.Effect.OnEnter(system)
+	effect := r.effect(keyframe)
+	rng := r.keyframeRand(keyframe)
+	r.active[keyframe] = &keyframeState{rng: rng}
+	SeedEffect(effect, rng)
+	r.withTarget(keyframe, system, effect.OnEnter)
+}
+
+// seekAnimation rebuilds the state of keyframe's effect at progress after the
+// show time jumps, see Seekable.
+func (r *EffectsManager) seekAnimation(keyframe *Keyframe, progress float64, system *System) {
+	defer r.recoverEffect(keyframe, "Seek", system)
+
+	// a jump isn't a time step, so the next frame has no delta
+	if state := r.active[keyframe]; state != nil {
+		state.evaluated = false
+	}
+
+	r.withTarget(keyframe, system, func(target *System) {
+		SeekEffect(r.effect(keyframe), progress, target)
+	})
+}
+
+func (r *EffectsManager) runAnimation(keyframe *Keyframe, ctx *EvalContext, system *System) {
+	defer r.recoverEffect(keyframe, "Eval", system)
+
+	effect := r.effect(keyframe)
+	r.withTarget(keyframe, system, func(target *System) {
+		if !keyframe.composited() {
+			EvalWith(effect, ctx, target)
+			return
+		}
+
+		r.composite(keyframe, effect, ctx, target)
+	})
 }
 
-func (r *EffectsManager) runAnimation(keyframe *Keyframe, progress float64, system *System) {
+// composite renders keyframe's effect onto a black canvas and blends the result onto
+// the snapshot of the layers below with the keyframe's blend mode and
+// opacity.
+func (r *EffectsManager) composite(keyframe *Keyframe, effect Effect, ctx *EvalContext, system *System) {
+	blending, err := keyframe.Blend.Blending()
+	if err != nil {
+		panic(err)
+	}
+
+	if len(r.below) != system.IDCount() {
+		r.below = make([]colorful.Color, system.IDCount())
+	}
+	for _, led := range system.LEDs {
+		r.below[led.ID] = led.Color
+		led.Color = colorful.Color{}
+	}
+
+	// a panicking effect leaves the layers below as they were
+	blended := false
 	defer func() {
-		if rec := recover(); rec != nil {
-			log.Printf("warn: panic Eval with effect %q: %v\n%s",
-				keyframe.Label, rec, string(debug.Stack()))
-			log.Printf("warn: %q will be blacklisted", keyframe.Label)
-			r.blacklist[keyframe] = true
+		if blended {
+			return
+		}
+		for _, led := range system.LEDs {
+			led.Color = r.below[led.ID]
 		}
 	}()
 
-	keyframe.Effect.Eval(progress, system)
+	EvalWith(effect, ctx, system)
+
+	opacity := keyframe.opacity()
+	for _, led := range system.LEDs {
+		led.Color = blending(r.below[led.ID], led.Color, opacity).Clamped()
+	}
+	blended = true
 }
 
 func (r *EffectsManager) exitAnimations(keyframe *Keyframe, system *System) {
+	effect := r.effect(keyframe)
+	if entry := r.blacklist[keyframe]; entry != nil && entry.clearOnExit {
+		delete(r.blacklist, keyframe)
+		r.publishBlacklist()
+	}
+	if effect == nil {
+		delete(r.active, keyframe)
+		return
+	}
+
 	defer func() {
 		if rec := recover(); rec != nil {
 			// get stack trace
@@ -188,7 +371,42 @@ func (r *EffectsManager) exitAnimations(keyframe *Keyframe, system *System) {
 		}
 	}()
 	log.Println("exiting:", keyframe.Label)
-	keyframe.Effect.OnExit(system)
+	delete(r.active, keyframe)
+	r.withTarget(keyframe, system, effect.OnExit)
+}
+
+// withTarget calls f with the part of system keyframe targets. Effects that
+// reach outside their group, such as through Neighbours, have those writes
+// undone. It panics if the target group doesn't exist, which blacklists the
+// keyframe like any other failing effect.
+func (r *EffectsManager) withTarget(keyframe *Keyframe, system *System, f func(target *System)) {
+	if keyframe.Target == "" {
+		f(system)
+		return
+	}
+
+	view, err := system.View(keyframe.Target)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(r.outside) != system.IDCount() {
+		r.outside = make([]colorful.Color, system.IDCount())
+	}
+	for _, led := range system.LEDs {
+		r.outside[led.ID] = led.Color
+	}
+
+	// undo the writes outside the group even if f panics
+	defer func() {
+		for _, led := range system.LEDs {
+			if !view.Contains(led) {
+				led.Color = r.outside[led.ID]
+			}
+		}
+	}()
+
+	f(view)
 }
 
 type EffectsRunner struct {
@@ -0,0 +1,165 @@
+package ledsim
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// EndMode is what the manager does when the show time reaches the end of the
+// timeline, which is when its last keyframe ends.
+type EndMode int
+
+const (
+	// EndLoop plays the timeline again from the start.
+	EndLoop EndMode = iota
+	// EndOnce turns every LED off.
+	EndOnce
+	// EndHold keeps showing the last frame.
+	EndHold
+	// EndHandoff hands off to another manager, such as an idle playlist,
+	// which starts from its own beginning.
+	EndHandoff
+)
+
+var endModeNames = []string{"loop", "once", "hold", "handoff"}
+
+func (m EndMode) String() string {
+	if m < 0 || int(m) >= len(endModeNames) {
+		return fmt.Sprintf("EndMode(%d)", int(m))
+	}
+	return endModeNames[m]
+}
+
+// ParseEndMode parses the name of an end mode: loop, once, hold or handoff.
+func ParseEndMode(name string) (EndMode, error) {
+	for i, n := range endModeNames {
+		if n == name {
+			return EndMode(i), nil
+		}
+	}
+	return EndLoop, fmt.Errorf("unknown end mode %q, must be one of loop, once, hold or handoff", name)
+}
+
+// SetEndMode sets what happens at the end of the timeline. EndHandoff takes
+// the manager to hand off to, and turns the LEDs off if there isn't one.
+func (r *EffectsManager) SetEndMode(mode EndMode, handoff ...*EffectsManager) {
+	r.endMode = mode
+	r.handoff = nil
+	if len(handoff) > 0 {
+		r.handoff = handoff[0]
+	}
+}
+
+// Finished reports whether the show time has passed the end of the timeline
+// and the manager isn't looping. It's safe to call from any goroutine.
+func (r *EffectsManager) Finished() bool {
+	r.index.mu.Lock()
+	defer r.index.mu.Unlock()
+
+	return r.index.finished
+}
+
+func (r *EffectsManager) setFinished(finished bool) {
+	r.finished = finished
+
+	r.index.mu.Lock()
+	r.index.finished = finished
+	r.index.mu.Unlock()
+}
+
+// advance works out where in the timeline delta is. When the end is reached
+// it loops or finishes, and when the clock goes back to before the current
+// pass started, such as mpv playing the file again, the timeline restarts.
+func (r *EffectsManager) advance(delta time.Duration, system *System) time.Duration {
+	length := r.timeline.End()
+
+	if delta < r.lastLoopEnd || (r.finished && delta < r.endedAt) {
+		log.Println("clock went back to", delta, "restarting timeline")
+		r.rewind(system)
+
+		switch {
+		case delta < 0:
+			r.lastLoopEnd = delta
+		case r.endMode == EndLoop && length > 0:
+			r.lastLoopEnd = delta - delta%length
+		}
+	}
+
+	loopTime := delta - r.lastLoopEnd
+	// a timeline with no keyframes never ends, so keyframes can be added
+	// to it
+	if r.finished || length == 0 || loopTime < length {
+		return loopTime
+	}
+
+	if r.endMode != EndLoop {
+		r.finish(system, length)
+		return loopTime
+	}
+
+	intoNext := (loopTime - length) % length
+	r.exitAll(system)
+
+	// Recalculate the loopTime because we are in a new iteration of animation
+	// loop, which started exactly where the last one ended so the loops don't
+	// drift by the frame that crossed the end
+	r.lastLoopEnd += length
+	loopTime = delta - r.lastLoopEnd
+	if loopTime >= length {
+		// the show time jumped past the end of the loop
+		loopTime = intoNext
+		r.lastLoopEnd = delta - loopTime
+	}
+
+	return loopTime
+}
+
+func (r *EffectsManager) finish(system *System, length time.Duration) {
+	log.Println("timeline ended, end mode:", r.endMode)
+
+	r.endedAt = r.lastLoopEnd + length
+	if r.endMode == EndHold {
+		// the LEDs still show the last frame
+		r.held = r.held.resized(system.IDCount())
+		r.held.Capture(system)
+	}
+
+	r.exitAll(system)
+	r.setFinished(true)
+}
+
+// renderEnd renders a frame after the timeline has finished.
+func (r *EffectsManager) renderEnd(system *System, delta time.Duration) {
+	switch {
+	case r.endMode == EndHold:
+		r.held.Apply(system)
+	case r.endMode == EndHandoff && r.handoff != nil:
+		r.handoff.Evaluate(system, delta-r.endedAt)
+	default:
+		r.compositor.render(system, nil, nil)
+	}
+}
+
+// exitAll exits every running keyframe, so the next frame enters whatever is
+// running then afresh.
+func (r *EffectsManager) exitAll(system *System) {
+	for _, keyframe := range r.lastKeyframes {
+		r.exitAnimations(keyframe, system)
+	}
+	r.lastKeyframes = nil
+}
+
+// rewind stops the manager, and whatever it handed off to, and puts its clock
+// back to the start.
+func (r *EffectsManager) rewind(system *System) {
+	r.exitAll(system)
+	if r.finished && r.endMode == EndHandoff && r.handoff != nil {
+		r.handoff.rewind(system)
+	}
+
+	r.lastLoopEnd = 0
+	r.lastDelta = 0
+	r.endedAt = 0
+	r.setFinished(false)
+}
@@ -0,0 +1,165 @@
+package ledsim
+
+import (
+	"testing"
+	"time"
+)
+
+// countingEffect counts how often it's entered and exited.
+type countingEffect struct {
+	enters, exits int
+}
+
+func (e *countingEffect) OnEnter(system *System)                { e.enters++ }
+func (e *countingEffect) Eval(progress float64, system *System) {}
+func (e *countingEffect) OnExit(system *System)                 { e.exits++ }
+
+func TestEndModeAdvance(t *testing.T) {
+	ms := time.Millisecond
+	s := time.Second
+
+	type step struct {
+		delta    time.Duration
+		loopTime time.Duration
+		finished bool
+	}
+	tests := []struct {
+		name  string
+		mode  EndMode
+		steps []step
+	}{
+		{
+			name: "loop wraps without drifting",
+			mode: EndLoop,
+			steps: []step{
+				{0, 0, false},
+				{9980 * ms, 9980 * ms, false},
+				// the pass started at 10s, not at the frame before it
+				{10013 * ms, 13 * ms, false},
+				{19990 * ms, 9990 * ms, false},
+				{20020 * ms, 20 * ms, false},
+				{30001 * ms, 1 * ms, false},
+			},
+		},
+		{
+			name: "loop skips ahead after a forward seek",
+			mode: EndLoop,
+			steps: []step{
+				{0, 0, false},
+				{5 * s, 5 * s, false},
+				{47 * s, 7 * s, false},
+				{49 * s, 9 * s, false},
+				{51 * s, 1 * s, false},
+			},
+		},
+		{
+			name: "loop restarts when the clock goes back",
+			mode: EndLoop,
+			steps: []step{
+				{0, 0, false},
+				{25 * s, 5 * s, false},
+				// back within the pass is a seek, not a restart
+				{22 * s, 2 * s, false},
+				// back before the pass started restarts at the right pass
+				{13 * s, 3 * s, false},
+				{2 * s, 2 * s, false},
+			},
+		},
+		{
+			name: "once finishes and restarts when the clock goes back",
+			mode: EndOnce,
+			steps: []step{
+				{0, 0, false},
+				{9 * s, 9 * s, false},
+				{11 * s, 11 * s, true},
+				{30 * s, 30 * s, true},
+				{4 * s, 4 * s, false},
+			},
+		},
+		{
+			name: "hold finishes after a forward seek",
+			mode: EndHold,
+			steps: []step{
+				{0, 0, false},
+				{25 * s, 25 * s, true},
+				{26 * s, 26 * s, true},
+				{9 * s, 9 * s, false},
+			},
+		},
+		{
+			name: "negative time",
+			mode: EndLoop,
+			steps: []step{
+				{0, 0, false},
+				{-2 * s, 0, false},
+				{-1 * s, 1 * s, false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			system := NewSystem()
+			manager := NewEffectsManager([]*Keyframe{
+				{Label: "test", Duration: 10 * time.Second, Effect: &countingEffect{}},
+			})
+			manager.SetEndMode(test.mode)
+
+			for i, step := range test.steps {
+				// as Evaluate does
+				loopTime := manager.advance(step.delta, system)
+				manager.lastDelta = step.delta
+
+				if loopTime != step.loopTime || manager.finished != step.finished {
+					t.Fatalf("step %d: advance(%v) = %v, finished %v, want %v, finished %v",
+						i, step.delta, loopTime, manager.finished, step.loopTime, step.finished)
+				}
+			}
+		})
+	}
+}
+
+func TestEndModeLoopReentersKeyframes(t *testing.T) {
+	system := NewSystem()
+	effect := &countingEffect{}
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "test", Duration: time.Second, Effect: effect},
+	})
+	manager.SetEndMode(EndLoop)
+
+	frame := time.Second / 30
+	for delta := time.Duration(0); delta < 3*time.Second; delta += frame {
+		manager.Evaluate(system, delta)
+	}
+
+	if effect.enters != 3 || effect.exits != 2 {
+		t.Fatalf("keyframe entered %d times and exited %d times over 3 loops, want 3 and 2",
+			effect.enters, effect.exits)
+	}
+}
+
+func TestEndModeHandoff(t *testing.T) {
+	system := NewSystem()
+	idle := &countingEffect{}
+	handoff := NewEffectsManager([]*Keyframe{
+		{Label: "idle", Duration: time.Second, Effect: idle},
+	})
+	handoff.SetEndMode(EndLoop)
+
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "show", Duration: time.Second, Effect: &countingEffect{}},
+	})
+	manager.SetEndMode(EndHandoff, handoff)
+
+	manager.Evaluate(system, 0)
+	manager.Evaluate(system, 1500*time.Millisecond)
+	if !manager.Finished() || idle.enters != 1 {
+		t.Fatalf("after the end, finished %v and idle entered %d times, want true and 1", manager.Finished(), idle.enters)
+	}
+
+	// the clock going back restarts the show and stops the idle timeline
+	manager.Evaluate(system, 0)
+	if manager.Finished() || idle.exits != 1 {
+		t.Fatalf("after restarting, finished %v and idle exited %d times, want false and 1", manager.Finished(), idle.exits)
+	}
+}
@@ -0,0 +1,273 @@
+package ledsim
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Framebuffer is an off-screen colour for every LED, indexed by LED.ID.
+type Framebuffer []colorful.Color
+
+// NewFramebuffer returns a black framebuffer large enough for sys.
+func NewFramebuffer(sys *System) Framebuffer {
+	return make(Framebuffer, sys.IDCount())
+}
+
+// resized returns f if it already holds n colours, or a new black
+// framebuffer that does.
+func (f Framebuffer) resized(n int) Framebuffer {
+	if len(f) != n {
+		return make(Framebuffer, n)
+	}
+	return f
+}
+
+// Get returns the colour of led in the buffer.
+func (f Framebuffer) Get(led *LED) colorful.Color {
+	return f[led.ID]
+}
+
+// Set sets the colour of led in the buffer.
+func (f Framebuffer) Set(led *LED, c colorful.Color) {
+	f[led.ID] = c
+}
+
+// Fill sets every colour in the buffer to c.
+func (f Framebuffer) Fill(c colorful.Color) {
+	for i := range f {
+		f[i] = c
+	}
+}
+
+// Capture copies the colours of the LEDs in sys into the buffer.
+func (f Framebuffer) Capture(sys *System) {
+	for _, led := range sys.LEDs {
+		f[led.ID] = led.Color
+	}
+}
+
+// Apply copies the buffer onto the colours of the LEDs in sys.
+func (f Framebuffer) Apply(sys *System) {
+	for _, led := range sys.LEDs {
+		led.Color = f[led.ID]
+	}
+}
+
+// BufferEffect is an effect that renders into a framebuffer rather than into
+// the LEDs' colours. The buffer holds the layers below when EvalBuffer is
+// called, and only colours of LEDs in sys should be written.
+type BufferEffect interface {
+	OnEnter(system *System)
+	EvalBuffer(progress float64, system *System, fb Framebuffer)
+	OnExit(system *System)
+}
+
+type bufferEffectWrapper struct {
+	effect BufferEffect
+	fb     Framebuffer
+}
+
+func (w *bufferEffectWrapper) OnEnter(system *System) {
+	w.effect.OnEnter(system)
+}
+
+func (w *bufferEffectWrapper) OnExit(system *System) {
+	w.effect.OnExit(system)
+}
+
+func (w *bufferEffectWrapper) SetRand(rng *rand.Rand) {
+	SeedEffect(w.effect, rng)
+}
+
+func (w *bufferEffectWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, progress, system)
+}
+
+func (w *bufferEffectWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
+func (w *bufferEffectWrapper) Eval(progress float64, system *System) {
+	w.fb = w.fb.resized(system.IDCount())
+	w.fb.Capture(system)
+	w.effect.EvalBuffer(progress, system, w.fb)
+	w.fb.Apply(system)
+}
+
+// NewBufferEffect adapts a BufferEffect so it can be used in a Keyframe or
+// with any of the WrappedEffect helpers.
+func NewBufferEffect(effect BufferEffect) WrappedEffect {
+	return WrappedEffect{&bufferEffectWrapper{
+		effect: effect,
+	}}
+}
+
+type effectBufferWrapper struct {
+	effect Effect
+}
+
+func (w *effectBufferWrapper) OnEnter(system *System) {
+	w.effect.OnEnter(system)
+}
+
+func (w *effectBufferWrapper) OnExit(system *System) {
+	w.effect.OnExit(system)
+}
+
+func (w *effectBufferWrapper) SetRand(rng *rand.Rand) {
+	SeedEffect(w.effect, rng)
+}
+
+func (w *effectBufferWrapper) Seek(progress float64, system *System) {
+	SeekEffect(w.effect, progress, system)
+}
+
+func (w *effectBufferWrapper) OnIteration(index int, system *System) {
+	IterateEffect(w.effect, index, system)
+}
+
+func (w *effectBufferWrapper) EvalBuffer(progress float64, system *System, fb Framebuffer) {
+	fb.Apply(system)
+	w.effect.Eval(progress, system)
+	fb.Capture(system)
+}
+
+// AsBufferEffect adapts an ordinary Effect so it renders into a framebuffer.
+// The LEDs' colours are used as scratch space while it runs.
+func AsBufferEffect(effect Effect) BufferEffect {
+	return &effectBufferWrapper{
+		effect: effect,
+	}
+}
+
+// LayerSettings control how a layer of keyframes is composited.
+type LayerSettings struct {
+	// Mute hides the layer.
+	Mute bool
+	// Solo hides every layer that isn't also soloed.
+	Solo bool
+	// Opacity fades the whole layer onto the layers below, from 0 to 1.
+	// nil means fully opaque.
+	Opacity *float64
+	// PostProcess is called with the layer's buffer after all of its
+	// keyframes have rendered and before it is composited. The buffer
+	// includes the layers below, which the keyframes drew over.
+	PostProcess func(fb Framebuffer, system *System)
+}
+
+// compositor renders each layer into its own framebuffer and merges them
+// into the system.
+type compositor struct {
+	mutex    sync.Mutex
+	settings map[int]LayerSettings
+	// buffers hold the output of each layer from the latest frame, spare
+	// the one before
+	buffers   map[int]Framebuffer
+	spare     map[int]Framebuffer
+	composite Framebuffer
+}
+
+func newCompositor() *compositor {
+	return &compositor{
+		settings: make(map[int]LayerSettings),
+		buffers:  make(map[int]Framebuffer),
+		spare:    make(map[int]Framebuffer),
+	}
+}
+
+// render evaluates keyframes, which must be sorted by layer, layer by layer.
+// Each layer's buffer starts as the composite of the layers below, so
+// effects that read or modify the lower layers keep working, and then
+// replaces that composite according to the layer's settings.
+func (c *compositor) render(system *System, keyframes []*Keyframe, eval func(keyframe *Keyframe)) {
+	// the lock isn't held while effects run, so they can read LayerOutput
+	c.mutex.Lock()
+	layerSettings := make(map[int]LayerSettings, len(c.settings))
+	solo := false
+	for layer, settings := range c.settings {
+		layerSettings[layer] = settings
+		solo = solo || settings.Solo
+	}
+	c.mutex.Unlock()
+
+	c.composite = c.composite.resized(system.IDCount())
+	c.composite.Fill(colorful.Color{})
+
+	for start := 0; start < len(keyframes); {
+		layer := keyframes[start].Layer
+		end := start
+		for end < len(keyframes) && keyframes[end].Layer == layer {
+			end++
+		}
+		group := keyframes[start:end]
+		start = end
+
+		settings := layerSettings[layer]
+		if settings.Mute || (solo && !settings.Solo) {
+			continue
+		}
+
+		c.composite.Apply(system)
+		for _, keyframe := range group {
+			eval(keyframe)
+		}
+
+		// render into the spare buffer and swap it in, so LayerOutput never
+		// sees a half finished frame
+		buffer := c.spare[layer].resized(system.IDCount())
+		buffer.Capture(system)
+		if settings.PostProcess != nil {
+			settings.PostProcess(buffer, system)
+		}
+
+		c.mutex.Lock()
+		c.spare[layer] = c.buffers[layer]
+		c.buffers[layer] = buffer
+		c.mutex.Unlock()
+
+		if settings.Opacity == nil {
+			copy(c.composite, buffer)
+			continue
+		}
+
+		for i := range c.composite {
+			c.composite[i] = BlendRgb(c.composite[i], buffer[i], *settings.Opacity).Clamped()
+		}
+	}
+
+	c.composite.Apply(system)
+}
+
+// SetLayerSettings sets how a layer is composited. It is safe to call while
+// the manager is running.
+func (r *EffectsManager) SetLayerSettings(layer int, settings LayerSettings) {
+	r.compositor.mutex.Lock()
+	defer r.compositor.mutex.Unlock()
+	r.compositor.settings[layer] = settings
+}
+
+// LayerSettings returns how a layer is composited.
+func (r *EffectsManager) LayerSettings(layer int) LayerSettings {
+	r.compositor.mutex.Lock()
+	defer r.compositor.mutex.Unlock()
+	return r.compositor.settings[layer]
+}
+
+// LayerOutput returns a copy of a layer's buffer from the latest frame, after
+// its post-processing but before its opacity was applied, or nil if the layer
+// hasn't rendered. The buffer starts as the composite of the layers below, so
+// the output is cumulative: it's the lower layers with this one drawn over
+// them, not this layer on its own. It can be used for feedback effects or to
+// read one layer from another.
+func (r *EffectsManager) LayerOutput(layer int) Framebuffer {
+	r.compositor.mutex.Lock()
+	defer r.compositor.mutex.Unlock()
+
+	buffer, found := r.compositor.buffers[layer]
+	if !found {
+		return nil
+	}
+	return append(Framebuffer{}, buffer...)
+}
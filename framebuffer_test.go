@@ -0,0 +1,45 @@
+package ledsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestCompositeKeepsLayersBelowWhenEffectPanics(t *testing.T) {
+	half := 0.5
+	system := pairSystem()
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "background", Duration: time.Hour, Effect: &solidEffect{red}},
+		{Label: "panics", Duration: time.Hour, Layer: 1, Opacity: &half,
+			Effect: &spillEffect{color: blue, panic: true}},
+	})
+	manager.Evaluate(system, 0)
+
+	for _, led := range system.LEDs {
+		if led.Color != red {
+			t.Errorf("led %d is %v, want the layer below, %v", led.ID, led.Color, red)
+		}
+	}
+	if got := manager.LayerOutput(1).Get(system.LEDs[0]); got != red {
+		t.Errorf("layer 1 output is %v, want %v", got, red)
+	}
+}
+
+func TestCompositeOpacity(t *testing.T) {
+	half := 0.5
+	system := pairSystem()
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "background", Duration: time.Hour, Effect: &solidEffect{red}},
+		{Label: "over", Duration: time.Hour, Layer: 1, Opacity: &half, Effect: &solidEffect{blue}},
+	})
+	manager.Evaluate(system, 0)
+
+	want := colorful.Color{R: 0.5, B: 0.5}
+	for _, led := range system.LEDs {
+		if !led.Color.AlmostEqualRgb(want) {
+			t.Errorf("led %d is %v, want %v", led.ID, led.Color, want)
+		}
+	}
+}
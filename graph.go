@@ -2,12 +2,12 @@ package ledsim
 
 import (
 	"bufio"
-	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,6 +17,29 @@ import (
 type undirectedGraph struct {
 	vertices []*LED
 	edges    map[*LED][]*LED
+	// index over vertices, built once all the chains have been read
+	index *SpatialIndex
+	// every edge in the order it was added, so the graph can be replayed
+	// with the same neighbour ordering
+	edgeList [][2]*LED
+
+	// problems found while parsing, and how far each mapping endpoint was
+	// from the LED it was snapped to
+	problems []LayoutProblem
+	snaps    []mappingSnap
+}
+
+type mappingSnap struct {
+	line     int
+	led      *LED
+	distance float64
+}
+
+func (g *undirectedGraph) addProblem(kind LayoutProblemKind, format string, args ...interface{}) {
+	g.problems = append(g.problems, LayoutProblem{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
 }
 
 func newGraph() *undirectedGraph {
@@ -39,8 +62,16 @@ func (g *undirectedGraph) addEdge(u *LED, v *LED) {
 		return
 		// g.edges[u] = append(g.edges[u], v)
 	} else { // general case
+		// mapping.txt can repeat an edge that's already been inferred, which
+		// would otherwise make the LEDs neighbours twice
+		for _, existing := range g.edges[u] {
+			if existing == v {
+				return
+			}
+		}
 		g.edges[u] = append(g.edges[u], v)
 		g.edges[v] = append(g.edges[v], u)
+		g.edgeList = append(g.edgeList, [2]*LED{u, v})
 	}
 }
 
@@ -56,32 +87,57 @@ func (g *undirectedGraph) removeVertex(X float64, Y float64, Z float64) {
 		if v.X == X && v.Y == Y && v.Z == Z {
 			g.vertices = removeVertexFromSlice(i, g.vertices)
 			delete(g.edges, v)
+			g.index = nil
 		}
 	}
 }
 
+// logs every problem found while parsing, and returns an error if the layout
+// cannot be driven at all
+func (g *undirectedGraph) err() error {
+	var unwired []string
+	for _, problem := range g.problems {
+		log.Println("warn: layout:", problem)
+		if problem.Kind == ProblemUnwiredChain {
+			unwired = append(unwired, problem.Message)
+		}
+	}
+
+	if len(unwired) > 0 {
+		return errors.New("layout has chains with no teensy:\n\t" + strings.Join(unwired, "\n\t"))
+	}
+
+	return nil
+}
+
 func getDistance(x0 float64, y0 float64, z0 float64, x1 float64, y1 float64, z1 float64) float64 {
 	return math.Sqrt(math.Pow(x1-x0, 2) + math.Pow(y1-y0, 2) + math.Pow(z1-z0, 2))
 }
 
-func (g *undirectedGraph) getVertexByCoord(X float64, Y float64, Z float64) *LED {
-	min_dist := 10000.0
-	var curr_vertex *LED
-	for _, v := range g.vertices {
-		dist := getDistance(X, Y, Z, v.X, v.Y, v.Z)
-		if dist < min_dist {
-			min_dist = dist
-			curr_vertex = v
-		}
+// returns the nearest vertex within 10000 units and its distance, or nil if
+// there is none
+func (g *undirectedGraph) getVertexByCoord(X float64, Y float64, Z float64) (*LED, float64) {
+	if g.index == nil || g.index.Len() != len(g.vertices) {
+		g.index = NewSpatialIndex(g.vertices)
 	}
+
+	curr_vertex := g.index.Nearest(X, Y, Z)
 	if curr_vertex == nil {
-		panic("get vertex by coord failed")
+		return nil, 10000.0
+	}
+
+	dist := getDistance(X, Y, Z, curr_vertex.X, curr_vertex.Y, curr_vertex.Z)
+	if dist >= 10000.0 {
+		return nil, dist
 	}
-	return curr_vertex
+	return curr_vertex, dist
 }
 
 func (g *undirectedGraph) removeEdge(x0 float64, y0 float64, z0 float64, x1 float64, y1 float64, z1 float64) {
-	u := g.getVertexByCoord(x0, y0, z0)
+	u, _ := g.getVertexByCoord(x0, y0, z0)
+	if u == nil {
+		return
+	}
 	for i, v := range g.edges[u] {
 		if v.X == x1 && v.Y == y1 && v.Z == z1 {
 			g.edges[u] = removeVertexFromSlice(i, g.edges[u])
@@ -114,16 +170,22 @@ var mappingFile []byte
 //go:embed teensy.txt
 var teensyFile []byte
 
-func (g *undirectedGraph) loadTeensys() (map[string]*Teensy, map[int]string) {
+func (g *undirectedGraph) loadTeensys(r io.Reader) (map[string]*Teensy, map[int]string, error) {
 	ip := regexp.MustCompile(`(?:[0-9]{1,3}\.){3}[0-9]{1,3}`)
-	teensyScanner := bufio.NewScanner(bytes.NewReader(teensyFile))
+	teensyScanner := bufio.NewScanner(r)
 
 	teensys := make(map[string]*Teensy)
 	chainToIpMap := make(map[int]string)
 	var currentIp string
 	var currentPin int
 	var currentChainPosOnPin int
+	line := 0
 	for teensyScanner.Scan() {
+		line++
+		if strings.TrimSpace(teensyScanner.Text()) == "" {
+			continue
+		}
+
 		if ip.MatchString(teensyScanner.Text()) {
 			newTeensy := Teensy{
 				IP:     teensyScanner.Text(),
@@ -132,15 +194,17 @@ func (g *undirectedGraph) loadTeensys() (map[string]*Teensy, map[int]string) {
 			teensys[newTeensy.IP] = &newTeensy
 			currentIp = newTeensy.IP
 			currentPin = 0
+		} else if currentIp == "" {
+			g.addProblem(ProblemSyntax, "teensy.txt:%d: pin line before any IP address", line)
 		} else {
 			chainIds := strings.Split(teensyScanner.Text(), ",")
 			for _, chainId := range chainIds {
-				isReversed := chainId[len(chainId)-1] == '\''
-				var chainIdNum int
-				if isReversed {
-					chainIdNum, _ = strconv.Atoi(chainId[0 : len(chainId)-1])
-				} else {
-					chainIdNum, _ = strconv.Atoi(chainId)
+				chainId = strings.TrimSpace(chainId)
+				isReversed := strings.HasSuffix(chainId, "'")
+				chainIdNum, err := strconv.Atoi(strings.TrimSuffix(chainId, "'"))
+				if err != nil {
+					g.addProblem(ProblemSyntax, "teensy.txt:%d: bad chain id %q", line, chainId)
+					continue
 				}
 				teensys[currentIp].Chains[chainIdNum] = &Chain{Id: chainIdNum, Pin: currentPin, PosOnPin: currentChainPosOnPin, Length: 0, Reversed: isReversed}
 				currentChainPosOnPin += 1
@@ -151,11 +215,15 @@ func (g *undirectedGraph) loadTeensys() (map[string]*Teensy, map[int]string) {
 		}
 	}
 
-	return teensys, chainToIpMap
+	if err := teensyScanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("read teensy layout: %w", err)
+	}
+
+	return teensys, chainToIpMap, nil
 }
 
-// uses the ledpos and mapping text to build static graph
-func (g *undirectedGraph) populateGraph(sys *System) {
+// uses the ledpos, mapping and teensy text to build static graph
+func (g *undirectedGraph) populateGraph(sys *System, src *LayoutSource) error {
 
 	// aka chainId
 	crack := regexp.MustCompile(`\s{12}\{\d*\}`)
@@ -164,42 +232,80 @@ func (g *undirectedGraph) populateGraph(sys *System) {
 	coordPos := regexp.MustCompile(`\d*\.\s*\{`)
 	coordSection := regexp.MustCompile(`\{-?\d*\.\d*,\s-?\d*\.\d*,\s-?\d*\.\d*\}`)
 	coord := regexp.MustCompile(`-?\d*\.\d*`)
+	// the facing of the LED, the second {dx,dy,dz} on the line
+	directionSection := regexp.MustCompile(`\},\s*\{\s*([-+.\deE]+)\s*,\s*([-+.\deE]+)\s*,\s*([-+.\deE]+)\s*\}`)
 
 	vertexPair := regexp.MustCompile(`-?\d*\.\d*`)
 
-	ledposScanner := bufio.NewScanner(bytes.NewReader(ledposFile))
-	mappingScanner := bufio.NewScanner(bytes.NewReader(mappingFile))
+	ledposScanner := bufio.NewScanner(src.LEDPos)
+	mappingScanner := bufio.NewScanner(src.Mapping)
 
-	teensys, ledToIpMap := g.loadTeensys()
+	teensys, ledToIpMap, err := g.loadTeensys(src.Teensy)
+	if err != nil {
+		return err
+	}
 	sys.Teensys = teensys
 
 	currLedRun := make([]*LED, 0)
+	// parse through list and make edges
+	flushLedRun := func() {
+		g.vertices = append(g.vertices, currLedRun...)
+		for i := 1; i < len(currLedRun); i++ {
+			g.addEdge(currLedRun[i-1], currLedRun[i])
+		}
+		currLedRun = make([]*LED, 0)
+	}
+
+	parseFloat := func(file string, line int, s string) float64 {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			g.addProblem(ProblemSyntax, "%s:%d: bad number %q", file, line, s)
+		}
+		return v
+	}
+
 	var chainIdNum int
+	unwired := make(map[int]bool)
+	line := 0
 	for ledposScanner.Scan() {
+		line++
 		if crack.MatchString(ledposScanner.Text()) {
 			chainIdWithBrackets := strings.TrimSpace(ledposScanner.Text())
-			chainIdNum, _ = strconv.Atoi(strings.Trim(chainIdWithBrackets, "{}"))
-
-			// parse through list and make edges
-			// make new list
-			g.vertices = append(g.vertices, currLedRun...)
-			for i := 1; i < len(currLedRun); i++ {
-				g.addEdge(currLedRun[i-1], currLedRun[i])
+			chainIdNum, err = strconv.Atoi(strings.Trim(chainIdWithBrackets, "{}"))
+			if err != nil {
+				g.addProblem(ProblemSyntax, "ledpos.txt:%d: bad chain id %q", line, chainIdWithBrackets)
 			}
-			currLedRun = make([]*LED, 0)
+
+			flushLedRun()
 		} else if coordSection.MatchString(ledposScanner.Text()) {
 			coordStr := coordSection.FindAllString(ledposScanner.Text(), 1)
 			coords := coord.FindAllStringSubmatch(coordStr[0], 3)
-			X, _ := strconv.ParseFloat(coords[0][0], 64)
-			Y, _ := strconv.ParseFloat(coords[1][0], 64)
-			Z, _ := strconv.ParseFloat(coords[2][0], 64)
-			IP, _ := ledToIpMap[chainIdNum]
-			coordPosId, _ := strconv.Atoi(strings.Split(coordPos.FindAllString(ledposScanner.Text(), 1)[0], ".")[0])
+			X := parseFloat("ledpos.txt", line, coords[0][0])
+			Y := parseFloat("ledpos.txt", line, coords[1][0])
+			Z := parseFloat("ledpos.txt", line, coords[2][0])
+			IP, wired := ledToIpMap[chainIdNum]
+
+			var coordPosId int
+			if pos := coordPos.FindAllString(ledposScanner.Text(), 1); len(pos) == 0 {
+				g.addProblem(ProblemSyntax, "ledpos.txt:%d: missing position on chain", line)
+			} else if coordPosId, err = strconv.Atoi(strings.Split(pos[0], ".")[0]); err != nil {
+				g.addProblem(ProblemSyntax, "ledpos.txt:%d: bad position on chain %q", line, pos[0])
+			}
+
+			var direction Vec3
+			if dir := directionSection.FindStringSubmatch(ledposScanner.Text()); dir != nil {
+				direction = Vec3{
+					X: parseFloat("ledpos.txt", line, dir[1]),
+					Y: parseFloat("ledpos.txt", line, dir[2]),
+					Z: parseFloat("ledpos.txt", line, dir[3]),
+				}
+			}
 
 			led := &LED{
-				X: X,
-				Y: Y,
-				Z: Z,
+				X:         X,
+				Y:         Y,
+				Z:         Z,
+				Direction: direction,
 				PhysicalLEDPosition: PhysicalLEDPosition{
 					TeensyIp:        IP,
 					Chain:           chainIdNum,
@@ -207,32 +313,55 @@ func (g *undirectedGraph) populateGraph(sys *System) {
 				},
 				RawLine: ledposScanner.Text(),
 			}
-			teensys[led.TeensyIp].Chains[chainIdNum].Length += 1
+			if wired {
+				teensys[led.TeensyIp].Chains[chainIdNum].Length += 1
+			} else if !unwired[chainIdNum] {
+				unwired[chainIdNum] = true
+				g.addProblem(ProblemUnwiredChain, "ledpos.txt:%d: chain %d is not mentioned in teensy.txt", line, chainIdNum)
+			}
 			sys.AddLED(led)
 
 			currLedRun = append(currLedRun, led)
-		} else {
-			fmt.Fprintln(os.Stdout, "no coord found")
+		} else if strings.TrimSpace(ledposScanner.Text()) != "" {
+			g.addProblem(ProblemSyntax, "ledpos.txt:%d: no coord found in %q", line, ledposScanner.Text())
 		}
 	}
+	// the last chain has no header after it
+	flushLedRun()
 
+	line = 0
 	for mappingScanner.Scan() {
+		line++
 		if vertexPair.MatchString(mappingScanner.Text()) {
 			pairs := vertexPair.FindAllStringSubmatch(mappingScanner.Text(), 6)
-			X0, _ := strconv.ParseFloat(pairs[0][0], 64)
-			Y0, _ := strconv.ParseFloat(pairs[1][0], 64)
-			Z0, _ := strconv.ParseFloat(pairs[2][0], 64)
-			X1, _ := strconv.ParseFloat(pairs[3][0], 64)
-			Y1, _ := strconv.ParseFloat(pairs[4][0], 64)
-			Z1, _ := strconv.ParseFloat(pairs[5][0], 64)
-			g.addEdge(g.getVertexByCoord(X0, Y0, Z0), g.getVertexByCoord(X1, Y1, Z1))
+			if len(pairs) < 6 {
+				g.addProblem(ProblemSyntax, "mapping.txt:%d: expected 6 coordinates, found %d", line, len(pairs))
+				continue
+			}
+			X0 := parseFloat("mapping.txt", line, pairs[0][0])
+			Y0 := parseFloat("mapping.txt", line, pairs[1][0])
+			Z0 := parseFloat("mapping.txt", line, pairs[2][0])
+			X1 := parseFloat("mapping.txt", line, pairs[3][0])
+			Y1 := parseFloat("mapping.txt", line, pairs[4][0])
+			Z1 := parseFloat("mapping.txt", line, pairs[5][0])
+
+			u, uDist := g.getVertexByCoord(X0, Y0, Z0)
+			v, vDist := g.getVertexByCoord(X1, Y1, Z1)
+			if u == nil || v == nil {
+				g.addProblem(ProblemSnappedEdge, "mapping.txt:%d: no led within 10000 units of an endpoint", line)
+				continue
+			}
+
+			g.snaps = append(g.snaps, mappingSnap{line, u, uDist}, mappingSnap{line, v, vDist})
+			g.addEdge(u, v)
 		}
 	}
 
-	if err0 := ledposScanner.Err(); err0 != nil {
-		log.Fatal(err0)
-	} else if err1 := mappingScanner.Err(); err1 != nil {
-		log.Fatal(err1)
+	if err := ledposScanner.Err(); err != nil {
+		return fmt.Errorf("read led positions: %w", err)
+	} else if err := mappingScanner.Err(); err != nil {
+		return fmt.Errorf("read mapping: %w", err)
 	}
 
+	return nil
 }
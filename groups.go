@@ -0,0 +1,173 @@
+package ledsim
+
+import (
+	"fmt"
+)
+
+// Group is a named set of LEDs that keyframes can target. An LED is in the
+// group if any of the selectors match it. Box and Sphere are in normalised
+// coordinates, so they are independent of the layout's units.
+type Group struct {
+	Name    string       `json:"name"`
+	Chains  []int        `json:"chains,omitempty"`
+	Teensys []string     `json:"teensys,omitempty"`
+	Box     *GroupBox    `json:"box,omitempty"`
+	Sphere  *GroupSphere `json:"sphere,omitempty"`
+	IDs     []int        `json:"ids,omitempty"`
+}
+
+// GroupBox selects LEDs inside an axis aligned box, inclusive.
+type GroupBox struct {
+	Min [3]float64 `json:"min"`
+	Max [3]float64 `json:"max"`
+}
+
+// GroupSphere selects LEDs within Radius of Center.
+type GroupSphere struct {
+	Center [3]float64 `json:"center"`
+	Radius float64    `json:"radius"`
+}
+
+func (g *Group) empty() bool {
+	return len(g.Chains) == 0 && len(g.Teensys) == 0 && g.Box == nil && g.Sphere == nil && len(g.IDs) == 0
+}
+
+// Select returns the LEDs of sys in the group, in ID order.
+func (g *Group) Select(sys *System) []*LED {
+	selected := make([]bool, sys.IDCount())
+
+	chains := make(map[int]bool)
+	for _, chain := range g.Chains {
+		chains[chain] = true
+	}
+	teensys := make(map[string]bool)
+	for _, ip := range g.Teensys {
+		teensys[ip] = true
+	}
+
+	for _, led := range sys.LEDs {
+		if chains[led.Chain] || teensys[led.TeensyIp] {
+			selected[led.ID] = true
+		}
+	}
+
+	if g.Box != nil {
+		for _, led := range sys.WithinBox(g.Box.Min[0], g.Box.Min[1], g.Box.Min[2], g.Box.Max[0], g.Box.Max[1], g.Box.Max[2]) {
+			selected[led.ID] = true
+		}
+	}
+
+	if g.Sphere != nil {
+		for _, led := range sys.WithinRadius(g.Sphere.Center[0], g.Sphere.Center[1], g.Sphere.Center[2], g.Sphere.Radius) {
+			selected[led.ID] = true
+		}
+	}
+
+	for _, id := range g.IDs {
+		if id >= 0 && id < len(selected) {
+			selected[id] = true
+		}
+	}
+
+	var leds []*LED
+	for _, led := range sys.LEDs {
+		if selected[led.ID] {
+			leds = append(leds, led)
+		}
+	}
+	return leds
+}
+
+// validate reports problems with g against the chains, teensys and LED count
+// of a layout.
+func (g *Group) validate(chains map[int]bool, ips map[string]bool, ledCount int, addProblem func(format string, args ...interface{})) {
+	if g.Name == "" {
+		addProblem("group has no name")
+	}
+	if g.empty() {
+		addProblem("group %q has no selectors", g.Name)
+	}
+	for _, chain := range g.Chains {
+		if !chains[chain] {
+			addProblem("group %q references undeclared chain %d", g.Name, chain)
+		}
+	}
+	for _, ip := range g.Teensys {
+		if !ips[ip] {
+			addProblem("group %q references undeclared controller %q", g.Name, ip)
+		}
+	}
+	if g.Sphere != nil && g.Sphere.Radius <= 0 {
+		addProblem("group %q has a sphere with non-positive radius", g.Name)
+	}
+	for _, id := range g.IDs {
+		if id < 0 || id >= ledCount {
+			addProblem("group %q references led %d which does not exist", g.Name, id)
+		}
+	}
+}
+
+// SetGroup adds or replaces the group with g's name.
+func (s *System) SetGroup(g *Group) {
+	if s.Groups == nil {
+		s.Groups = make(map[string]*Group)
+	}
+	s.Groups[g.Name] = g
+	delete(s.views, g.Name)
+}
+
+// View returns a System containing only the LEDs in the named group. The
+// LEDs are shared with s, so writing their colours writes s's colours, and
+// IDs are unchanged, so slices indexed by ID must still be sized for s (see
+// IDCount). Graph walks and spatial queries on the view stay inside the
+// group. Views are cached until the group changes or s is renormalised.
+func (s *System) View(name string) (*System, error) {
+	if view, found := s.views[name]; found {
+		return view, nil
+	}
+
+	g, found := s.Groups[name]
+	if !found {
+		return nil, fmt.Errorf("no group named %q", name)
+	}
+
+	leds := g.Select(s)
+	view := &System{
+		LEDs:          leds,
+		Teensys:       s.Teensys,
+		Normalization: s.Normalization,
+		XStats:        s.XStats,
+		YStats:        s.YStats,
+		ZStats:        s.ZStats,
+		Spatial:       NewSpatialIndex(leds),
+		Groups:        s.Groups,
+		topo:          &topology{},
+		parent:        s,
+		members:       make([]bool, s.IDCount()),
+	}
+	for _, led := range leds {
+		view.members[led.ID] = true
+	}
+
+	if s.views == nil {
+		s.views = make(map[string]*System)
+	}
+	s.views[name] = view
+
+	return view, nil
+}
+
+// Contains reports whether led is part of s, which is only ever false for
+// views.
+func (s *System) Contains(led *LED) bool {
+	return s.members == nil || s.members[led.ID]
+}
+
+// IDCount is one more than the largest LED ID that can appear in s or as a
+// neighbour of one of its LEDs. It is len(s.LEDs) except for views.
+func (s *System) IDCount() int {
+	if s.parent != nil {
+		return s.parent.IDCount()
+	}
+	return len(s.LEDs)
+}
@@ -0,0 +1,118 @@
+package ledsim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+var (
+	red  = colorful.Color{R: 1}
+	blue = colorful.Color{B: 1}
+)
+
+// solidEffect paints every LED one colour.
+type solidEffect struct {
+	color colorful.Color
+}
+
+func (e *solidEffect) OnEnter(system *System) {}
+func (e *solidEffect) Eval(progress float64, system *System) {
+	for _, led := range system.LEDs {
+		led.Color = e.color
+	}
+}
+func (e *solidEffect) OnExit(system *System) {}
+
+// spillEffect paints its LEDs and their neighbours, which can be outside
+// its group, and then panics if it's told to.
+type spillEffect struct {
+	color colorful.Color
+	panic bool
+}
+
+func (e *spillEffect) OnEnter(system *System) {}
+func (e *spillEffect) Eval(progress float64, system *System) {
+	for _, led := range system.LEDs {
+		led.Color = e.color
+		for _, neighbour := range led.Neighbours {
+			neighbour.Color = e.color
+		}
+	}
+	if e.panic {
+		panic("spilt")
+	}
+}
+func (e *spillEffect) OnExit(system *System) {}
+
+// pairSystem is two neighbouring LEDs, each in a group of its own.
+func pairSystem() *System {
+	system := NewSystem()
+	system.AddLED(&LED{})
+	system.AddLED(&LED{X: 1})
+	system.LEDs[0].Neighbours = []*LED{system.LEDs[1]}
+	system.LEDs[1].Neighbours = []*LED{system.LEDs[0]}
+	system.SetGroup(&Group{Name: "first", IDs: []int{0}})
+	system.SetGroup(&Group{Name: "second", IDs: []int{1}})
+	return system
+}
+
+func TestTargetUndoesWritesOutsideGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		panic bool
+		// view is the group the manager renders, or empty for the whole
+		// sculpture
+		view string
+		// target is the group the spilling keyframe targets
+		target string
+		// want is the colour of each LED rendered
+		want []colorful.Color
+	}{
+		{
+			name:   "whole sculpture",
+			target: "first",
+			want:   []colorful.Color{red, blue},
+		},
+		{
+			name:   "effect panics",
+			panic:  true,
+			target: "first",
+			want:   []colorful.Color{red, blue},
+		},
+		{
+			// the view's LED IDs run past its length
+			name:   "inside a view",
+			view:   "second",
+			target: "second",
+			want:   []colorful.Color{red},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			system := pairSystem()
+			if test.view != "" {
+				view, err := system.View(test.view)
+				if err != nil {
+					t.Fatal(err)
+				}
+				system = view
+			}
+
+			manager := NewEffectsManager([]*Keyframe{
+				{Label: "background", Duration: time.Hour, Effect: &solidEffect{blue}},
+				{Label: "spill", Duration: time.Hour, Layer: 1, Target: test.target,
+					Effect: &spillEffect{color: red, panic: test.panic}},
+			})
+			manager.Evaluate(system, 0)
+
+			for i, led := range system.LEDs {
+				if led.Color != test.want[i] {
+					t.Errorf("led %d is %v, want %v", led.ID, led.Color, test.want[i])
+				}
+			}
+		})
+	}
+}
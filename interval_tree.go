@@ -0,0 +1,238 @@
+package ledsim
+
+import (
+	"time"
+)
+
+// intervalTree indexes keyframes by the time they run, [Offset, EndOffset),
+// so the keyframes active at any time can be found in logarithmic time. It
+// is a treap ordered by offset, with each node also holding the latest end
+// in its subtree so whole subtrees can be skipped.
+type intervalTree struct {
+	root  *intervalNode
+	nodes map[*Keyframe]*intervalNode
+	// seq breaks ties between keyframes with the same offset, in the order
+	// they were inserted
+	seq uint64
+	// rng is a xorshift state for node priorities, it only needs to be
+	// well mixed, not seeded
+	rng uint64
+}
+
+type intervalNode struct {
+	keyframe    *Keyframe
+	start, end  time.Duration
+	maxEnd      time.Duration
+	seq         uint64
+	priority    uint64
+	left, right *intervalNode
+}
+
+func newIntervalTree(keyframes []*Keyframe) *intervalTree {
+	t := &intervalTree{
+		nodes: make(map[*Keyframe]*intervalNode),
+		rng:   0x9E3779B97F4A7C15,
+	}
+	for _, keyframe := range keyframes {
+		t.Insert(keyframe)
+	}
+	return t
+}
+
+func (n *intervalNode) less(other *intervalNode) bool {
+	if n.start != other.start {
+		return n.start < other.start
+	}
+	return n.seq < other.seq
+}
+
+func (n *intervalNode) update() {
+	n.maxEnd = n.end
+	if n.left != nil && n.left.maxEnd > n.maxEnd {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd > n.maxEnd {
+		n.maxEnd = n.right.maxEnd
+	}
+}
+
+func (t *intervalTree) priority() uint64 {
+	t.rng ^= t.rng << 13
+	t.rng ^= t.rng >> 7
+	t.rng ^= t.rng << 17
+	return t.rng
+}
+
+// Len returns the number of keyframes in the tree.
+func (t *intervalTree) Len() int {
+	return len(t.nodes)
+}
+
+// Contains reports whether keyframe is in the tree.
+func (t *intervalTree) Contains(keyframe *Keyframe) bool {
+	_, found := t.nodes[keyframe]
+	return found
+}
+
+// Insert adds keyframe to the tree. Its offset and duration must not change
+// while it's in the tree; remove it, change it and insert it again instead.
+// Inserting a keyframe that's already in the tree does nothing.
+func (t *intervalTree) Insert(keyframe *Keyframe) {
+	if t.Contains(keyframe) {
+		return
+	}
+
+	t.seq++
+	n := &intervalNode{
+		keyframe: keyframe,
+		start:    keyframe.Offset,
+		end:      keyframe.EndOffset(),
+		seq:      t.seq,
+		priority: t.priority(),
+	}
+	n.update()
+
+	t.nodes[keyframe] = n
+	t.root = insertNode(t.root, n)
+}
+
+func insertNode(root, n *intervalNode) *intervalNode {
+	if root == nil {
+		return n
+	}
+
+	if n.priority > root.priority {
+		n.left, n.right = splitNodes(root, n)
+		n.update()
+		return n
+	}
+
+	if n.less(root) {
+		root.left = insertNode(root.left, n)
+	} else {
+		root.right = insertNode(root.right, n)
+	}
+	root.update()
+	return root
+}
+
+// splitNodes splits root into the nodes ordered before key and those after.
+func splitNodes(root, key *intervalNode) (*intervalNode, *intervalNode) {
+	if root == nil {
+		return nil, nil
+	}
+
+	if root.less(key) {
+		left, right := splitNodes(root.right, key)
+		root.right = left
+		root.update()
+		return root, right
+	}
+
+	left, right := splitNodes(root.left, key)
+	root.left = right
+	root.update()
+	return left, root
+}
+
+// mergeNodes joins two treaps where every node of left is ordered before
+// every node of right.
+func mergeNodes(left, right *intervalNode) *intervalNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+
+	if left.priority > right.priority {
+		left.right = mergeNodes(left.right, right)
+		left.update()
+		return left
+	}
+
+	right.left = mergeNodes(left, right.left)
+	right.update()
+	return right
+}
+
+// Remove removes keyframe from the tree, and reports whether it was there.
+func (t *intervalTree) Remove(keyframe *Keyframe) bool {
+	n, found := t.nodes[keyframe]
+	if !found {
+		return false
+	}
+
+	delete(t.nodes, keyframe)
+	t.root = removeNode(t.root, n)
+	return true
+}
+
+func removeNode(root, n *intervalNode) *intervalNode {
+	if root == nil {
+		return nil
+	}
+
+	if root == n {
+		return mergeNodes(root.left, root.right)
+	}
+
+	if n.less(root) {
+		root.left = removeNode(root.left, n)
+	} else {
+		root.right = removeNode(root.right, n)
+	}
+	root.update()
+	return root
+}
+
+// At returns the keyframes running at time at, that is with
+// Offset <= at < EndOffset(), ordered by offset.
+func (t *intervalTree) At(at time.Duration) []*Keyframe {
+	var keyframes []*Keyframe
+	var visit func(n *intervalNode)
+	visit = func(n *intervalNode) {
+		// nothing in this subtree has ended after at
+		if n == nil || n.maxEnd <= at {
+			return
+		}
+
+		visit(n.left)
+		// everything to the right starts after at
+		if n.start > at {
+			return
+		}
+		if at < n.end {
+			keyframes = append(keyframes, n.keyframe)
+		}
+		visit(n.right)
+	}
+	visit(t.root)
+
+	return keyframes
+}
+
+// End returns the latest end of any keyframe, or 0 if the tree is empty.
+func (t *intervalTree) End() time.Duration {
+	if t.root == nil {
+		return 0
+	}
+	return t.root.maxEnd
+}
+
+// All returns every keyframe, ordered by offset.
+func (t *intervalTree) All() []*Keyframe {
+	keyframes := make([]*Keyframe, 0, len(t.nodes))
+	var visit func(n *intervalNode)
+	visit = func(n *intervalNode) {
+		if n == nil {
+			return
+		}
+		visit(n.left)
+		keyframes = append(keyframes, n.keyframe)
+		visit(n.right)
+	}
+	visit(t.root)
+
+	return keyframes
+}
@@ -0,0 +1,137 @@
+package ledsim
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// bruteAt is what intervalTree.At should return: the keyframes running at
+// at, ordered by offset and then by the order they were inserted.
+func bruteAt(keyframes []*Keyframe, at time.Duration) []*Keyframe {
+	var running []*Keyframe
+	for _, keyframe := range keyframes {
+		if keyframe.Offset <= at && at < keyframe.EndOffset() {
+			running = append(running, keyframe)
+		}
+	}
+	sort.SliceStable(running, func(i, j int) bool {
+		return running[i].Offset < running[j].Offset
+	})
+	return running
+}
+
+func sameKeyframes(a, b []*Keyframe) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIntervalTreeAt(t *testing.T) {
+	second := time.Second
+	tests := []struct {
+		name      string
+		keyframes [][2]time.Duration
+		at        []time.Duration
+	}{
+		{
+			name: "empty",
+			at:   []time.Duration{-second, 0, second},
+		},
+		{
+			name:      "end is exclusive",
+			keyframes: [][2]time.Duration{{0, second}},
+			at:        []time.Duration{-1, 0, second - 1, second},
+		},
+		{
+			name:      "same offset keeps insertion order",
+			keyframes: [][2]time.Duration{{second, second}, {second, 3 * second}, {second, 2 * second}},
+			at:        []time.Duration{second, 2 * second, 3 * second},
+		},
+		{
+			name:      "nested and overlapping",
+			keyframes: [][2]time.Duration{{0, 10 * second}, {2 * second, second}, {5 * second, 10 * second}, {9 * second, 0}},
+			at:        []time.Duration{0, 2 * second, 5 * second, 9 * second, 10 * second, 15 * second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var keyframes []*Keyframe
+			for _, k := range test.keyframes {
+				keyframes = append(keyframes, &Keyframe{Offset: k[0], Duration: k[1]})
+			}
+			tree := newIntervalTree(keyframes)
+
+			for _, at := range test.at {
+				if got, want := tree.At(at), bruteAt(keyframes, at); !sameKeyframes(got, want) {
+					t.Errorf("At(%v) = %v, want %v", at, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIntervalTreeRandomEdits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tree := newIntervalTree(nil)
+	var keyframes []*Keyframe
+
+	for step := 0; step < 2000; step++ {
+		if len(keyframes) > 0 && rng.Intn(3) == 0 {
+			i := rng.Intn(len(keyframes))
+			if !tree.Remove(keyframes[i]) {
+				t.Fatalf("step %d: Remove of a keyframe in the tree returned false", step)
+			}
+			if tree.Remove(keyframes[i]) {
+				t.Fatalf("step %d: second Remove returned true", step)
+			}
+			keyframes = append(keyframes[:i], keyframes[i+1:]...)
+		} else {
+			keyframe := &Keyframe{
+				// few distinct offsets, so there are plenty of ties
+				Offset:   time.Duration(rng.Intn(50)) * time.Second,
+				Duration: time.Duration(rng.Intn(20)) * time.Second,
+			}
+			tree.Insert(keyframe)
+			tree.Insert(keyframe)
+			keyframes = append(keyframes, keyframe)
+		}
+
+		if tree.Len() != len(keyframes) {
+			t.Fatalf("step %d: Len() = %d, want %d", step, tree.Len(), len(keyframes))
+		}
+
+		var end time.Duration
+		for _, keyframe := range keyframes {
+			if keyframe.EndOffset() > end {
+				end = keyframe.EndOffset()
+			}
+		}
+		if tree.End() != end {
+			t.Fatalf("step %d: End() = %v, want %v", step, tree.End(), end)
+		}
+
+		all := append([]*Keyframe(nil), keyframes...)
+		sort.SliceStable(all, func(i, j int) bool {
+			return all[i].Offset < all[j].Offset
+		})
+		if !sameKeyframes(tree.All(), all) {
+			t.Fatalf("step %d: All() isn't every keyframe ordered by offset", step)
+		}
+
+		for i := 0; i < 5; i++ {
+			at := time.Duration(rng.Int63n(int64(75 * time.Second)))
+			if got, want := tree.At(at), bruteAt(keyframes, at); !sameKeyframes(got, want) {
+				t.Fatalf("step %d: At(%v) = %v, want %v", step, at, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package ledsim
+
+// Iterating is implemented by effects that want to know when a wrapper such
+// as WithRepetition moves them to a different pass. OnIteration is called
+// with the index of the pass being started, from 0; the first pass starts
+// with OnEnter instead. Passes can be revisited out of order when seeking,
+// so effects should derive any per pass state from index alone.
+type Iterating interface {
+	OnIteration(index int, system *System)
+}
+
+// IterateEffect calls effect's OnIteration hook if it is Iterating. It takes
+// any value so BlendableEffects and BufferEffects can be told too.
+func IterateEffect(effect interface{}, index int, system *System) {
+	if it, ok := effect.(Iterating); ok {
+		it.OnIteration(index, system)
+	}
+}
@@ -0,0 +1,114 @@
+package ledsim
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// iterationRecorder records its hooks, and on entry the first number its
+// generator gives, so passes entered with the same generator can be told
+// apart from others.
+type iterationRecorder struct {
+	rng    *rand.Rand
+	events []string
+	draws  []int64
+}
+
+func (e *iterationRecorder) SetRand(rng *rand.Rand) { e.rng = rng }
+func (e *iterationRecorder) OnEnter(system *System) {
+	e.events = append(e.events, "enter")
+	e.draws = append(e.draws, e.rng.Int63())
+}
+func (e *iterationRecorder) Eval(progress float64, system *System) {}
+func (e *iterationRecorder) OnExit(system *System) {
+	e.events = append(e.events, "exit")
+}
+func (e *iterationRecorder) OnIteration(index int, system *System) {
+	e.events = append(e.events, fmt.Sprint("pass ", index))
+}
+
+func TestRepetitionIterations(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  RepetitionOptions
+		progress []float64
+		want     []string
+	}{
+		{
+			name:     "each pass",
+			progress: []float64{0.1, 0.2, 0.4, 0.7, 0.9},
+			want:     []string{"enter", "pass 1", "pass 2"},
+		},
+		{
+			name:     "reversed passes count separately",
+			options:  RepetitionOptions{Reverse: true},
+			progress: []float64{0.1, 0.2, 0.9},
+			want:     []string{"enter", "pass 1", "pass 5"},
+		},
+		{
+			name:     "going back",
+			progress: []float64{0.9, 0.1},
+			want:     []string{"enter", "pass 2", "pass 0"},
+		},
+		{
+			name:     "re-entering",
+			options:  RepetitionOptions{ReEnter: true},
+			progress: []float64{0.1, 0.4, 0.5, 0.7},
+			want:     []string{"enter", "exit", "enter", "pass 1", "exit", "enter", "pass 2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &iterationRecorder{}
+			effect := WrappedEffect{recorder}.WithRepetitionOptions(3, test.options)
+			system := pairSystem()
+			SeedEffect(effect, rand.New(rand.NewSource(1)))
+			effect.OnEnter(system)
+			for _, progress := range test.progress {
+				effect.Eval(progress, system)
+			}
+
+			if !reflect.DeepEqual(recorder.events, test.want) {
+				t.Errorf("got %v, want %v", recorder.events, test.want)
+			}
+		})
+	}
+}
+
+func TestRepetitionReEnterSeeds(t *testing.T) {
+	recorder := &iterationRecorder{}
+	effect := WrappedEffect{recorder}.WithRepetitionOptions(3, RepetitionOptions{ReEnter: true})
+	system := pairSystem()
+	SeedEffect(effect, rand.New(rand.NewSource(1)))
+	effect.OnEnter(system)
+
+	// passes 0, 1, 2, then back to 1 and 0, by seeking and by playing
+	effect.Eval(0.5, system)
+	effect.Eval(0.9, system)
+	SeekEffect(effect, 0.5, system)
+	effect.Eval(0.1, system)
+
+	draws := recorder.draws
+	if len(draws) != 5 {
+		t.Fatalf("entered %d times, want 5", len(draws))
+	}
+	if draws[0] == draws[1] || draws[1] == draws[2] || draws[0] == draws[2] {
+		t.Errorf("passes drew %v, want each pass to draw differently", draws[:3])
+	}
+	if draws[3] != draws[1] || draws[4] != draws[0] {
+		t.Errorf("revisited passes drew %v, want %v", draws[3:], []int64{draws[1], draws[0]})
+	}
+
+	// the same keyframe seed gives the same passes
+	again := &iterationRecorder{}
+	effect = WrappedEffect{again}.WithRepetitionOptions(3, RepetitionOptions{ReEnter: true})
+	SeedEffect(effect, rand.New(rand.NewSource(1)))
+	effect.OnEnter(system)
+	effect.Eval(0.5, system)
+	if !reflect.DeepEqual(again.draws, draws[:2]) {
+		t.Errorf("entering again drew %v, want %v", again.draws, draws[:2])
+	}
+}
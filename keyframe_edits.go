@@ -0,0 +1,177 @@
+package ledsim
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ErrKeyframeNotFound is returned when an edit names a keyframe ID that isn't
+// in the show.
+var ErrKeyframeNotFound = errors.New("keyframe not found")
+
+// KeyframeEdit is a change to a running show. Edits are queued with
+// EffectsManager.QueueEdit and applied at the start of the next frame, on the
+// goroutine running Evaluate, so they never race with effects.
+type KeyframeEdit struct {
+	// Remove is the ID of a keyframe to remove, or empty.
+	Remove string
+	// Build creates a keyframe to add, or is nil. It runs between frames so
+	// it can use system freely. If Remove is set too the new keyframe
+	// replaces the removed one, and takes its ID unless it has its own.
+	Build func(system *System) (*Keyframe, error)
+}
+
+// KeyframeEditResult is the outcome of a queued KeyframeEdit. Keyframe is the
+// keyframe that was added, if any.
+type KeyframeEditResult struct {
+	Keyframe *Keyframe
+	Err      error
+}
+
+type pendingEdit struct {
+	apply  func(system *System) (*Keyframe, error)
+	result chan KeyframeEditResult
+}
+
+// keyframeIndex is the part of the manager shared with other goroutines.
+type keyframeIndex struct {
+	mu      sync.Mutex
+	pending []pendingEdit
+	// snapshot is every keyframe in the show, ordered by offset, as of the
+	// last edit
+	snapshot  []*Keyframe
+	blacklist []BlacklistEntry
+	finished  bool
+}
+
+// QueueEdit queues edit to be applied at the start of the next frame. The
+// returned channel receives its result once it has been. It's safe to call
+// from any goroutine.
+func (r *EffectsManager) QueueEdit(edit KeyframeEdit) <-chan KeyframeEditResult {
+	return r.queue(func(system *System) (*Keyframe, error) {
+		return r.applyEdit(edit, system)
+	})
+}
+
+// queue queues apply to run at the start of the next frame.
+func (r *EffectsManager) queue(apply func(system *System) (*Keyframe, error)) <-chan KeyframeEditResult {
+	result := make(chan KeyframeEditResult, 1)
+
+	r.index.mu.Lock()
+	r.index.pending = append(r.index.pending, pendingEdit{
+		apply:  apply,
+		result: result,
+	})
+	r.index.mu.Unlock()
+
+	return result
+}
+
+// Keyframes returns every keyframe in the show, ordered by offset. It's safe
+// to call from any goroutine, but the keyframes' effects must not be used
+// outside the goroutine running Evaluate.
+func (r *EffectsManager) Keyframes() []*Keyframe {
+	r.index.mu.Lock()
+	defer r.index.mu.Unlock()
+
+	return append([]*Keyframe(nil), r.index.snapshot...)
+}
+
+// Keyframe returns the keyframe with the given ID, or nil if there isn't one.
+// It's safe to call from any goroutine.
+func (r *EffectsManager) Keyframe(id string) *Keyframe {
+	r.index.mu.Lock()
+	defer r.index.mu.Unlock()
+
+	for _, keyframe := range r.index.snapshot {
+		if keyframe.ID == id {
+			return keyframe
+		}
+	}
+	return nil
+}
+
+// applyEdits applies the queued edits, in the order they were queued.
+func (r *EffectsManager) applyEdits(system *System) {
+	r.index.mu.Lock()
+	pending := r.index.pending
+	r.index.pending = nil
+	r.index.mu.Unlock()
+
+	for _, p := range pending {
+		keyframe, err := p.apply(system)
+		p.result <- KeyframeEditResult{
+			Keyframe: keyframe,
+			Err:      err,
+		}
+	}
+}
+
+func (r *EffectsManager) applyEdit(edit KeyframeEdit, system *System) (keyframe *Keyframe, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			keyframe, err = nil, fmt.Errorf("panic building keyframe: %v", rec)
+		}
+	}()
+
+	var removed *Keyframe
+	if edit.Remove != "" {
+		removed = r.ids[edit.Remove]
+		if removed == nil {
+			return nil, fmt.Errorf("%w: %q", ErrKeyframeNotFound, edit.Remove)
+		}
+	}
+
+	if edit.Build == nil {
+		if removed != nil {
+			r.RemoveKeyframe(removed)
+		}
+		return nil, nil
+	}
+
+	keyframe, err = edit.Build(system)
+	if err != nil {
+		return nil, err
+	}
+
+	if removed != nil {
+		if keyframe.ID == "" {
+			keyframe.ID = removed.ID
+		}
+		if existing := r.ids[keyframe.ID]; existing != nil && existing != removed {
+			return nil, fmt.Errorf("duplicate keyframe ID %q", keyframe.ID)
+		}
+		r.RemoveKeyframe(removed)
+	}
+
+	if err := r.AddKeyframe(keyframe); err != nil {
+		if removed != nil {
+			// put back what was there
+			r.AddKeyframe(removed)
+		}
+		return nil, err
+	}
+
+	return keyframe, nil
+}
+
+// assignID gives keyframe the next free numeric ID if it doesn't have one.
+func (r *EffectsManager) assignID(keyframe *Keyframe) {
+	for keyframe.ID == "" {
+		r.nextID++
+		if id := strconv.Itoa(r.nextID); r.ids[id] == nil {
+			keyframe.ID = id
+		}
+	}
+}
+
+// updateSnapshot publishes the current keyframes to other goroutines.
+func (r *EffectsManager) updateSnapshot() {
+	snapshot := r.timeline.All()
+
+	r.index.mu.Lock()
+	r.index.snapshot = snapshot
+	r.index.mu.Unlock()
+}
@@ -0,0 +1,224 @@
+package ledsim
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// solidKeyframe lasts an hour and paints everything one colour.
+func solidKeyframe(id, label string, layer int, color colorful.Color) *Keyframe {
+	return &Keyframe{ID: id, Label: label, Duration: time.Hour, Layer: layer, Effect: &solidEffect{color}}
+}
+
+// build is a KeyframeEdit.Build that returns keyframe.
+func build(keyframe *Keyframe) func(system *System) (*Keyframe, error) {
+	return func(system *System) (*Keyframe, error) {
+		return keyframe, nil
+	}
+}
+
+func keyframeIDs(manager *EffectsManager) []string {
+	var result []string
+	for _, keyframe := range manager.Keyframes() {
+		result = append(result, keyframe.ID)
+	}
+	return result
+}
+
+func TestQueueEdit(t *testing.T) {
+	green := colorful.Color{G: 1}
+
+	tests := []struct {
+		name string
+		edit KeyframeEdit
+		// err is part of the error expected, or empty for none
+		err string
+		// id is the ID of the keyframe the edit adds, if any
+		id string
+		// ids are the keyframes in the show after the edit
+		ids []string
+		// color is what the first frame after the edit renders
+		color colorful.Color
+	}{
+		{
+			name:  "add",
+			edit:  KeyframeEdit{Build: build(solidKeyframe("", "over", 1, green))},
+			id:    "1",
+			ids:   []string{"base", "1"},
+			color: green,
+		},
+		{
+			name:  "add with an ID",
+			edit:  KeyframeEdit{Build: build(solidKeyframe("over", "over", 1, green))},
+			id:    "over",
+			ids:   []string{"base", "over"},
+			color: green,
+		},
+		{
+			name:  "add a duplicate ID",
+			edit:  KeyframeEdit{Build: build(solidKeyframe("base", "over", 1, green))},
+			err:   `duplicate keyframe ID "base"`,
+			ids:   []string{"base"},
+			color: red,
+		},
+		{
+			name:  "update keeps the ID",
+			edit:  KeyframeEdit{Remove: "base", Build: build(solidKeyframe("", "new base", 0, green))},
+			id:    "base",
+			ids:   []string{"base"},
+			color: green,
+		},
+		{
+			name:  "update to a new ID",
+			edit:  KeyframeEdit{Remove: "base", Build: build(solidKeyframe("renamed", "new base", 0, green))},
+			id:    "renamed",
+			ids:   []string{"renamed"},
+			color: green,
+		},
+		{
+			name:  "update to a taken ID",
+			edit:  KeyframeEdit{Remove: "base", Build: build(solidKeyframe("other", "new base", 0, green))},
+			err:   `duplicate keyframe ID "other"`,
+			ids:   []string{"base"},
+			color: red,
+		},
+		{
+			// the old keyframe is only removed once the new one is
+			// known to be valid, or put back if it turns out not to be
+			name:  "update is rejected",
+			edit:  KeyframeEdit{Remove: "base", Build: build(&Keyframe{Label: "empty", Effect: &solidEffect{green}})},
+			err:   `keyframe "empty" must last longer than 0s, got 0s`,
+			ids:   []string{"base"},
+			color: red,
+		},
+		{
+			name: "update fails to build",
+			edit: KeyframeEdit{Remove: "base", Build: func(system *System) (*Keyframe, error) {
+				return nil, errors.New("no such effect")
+			}},
+			err:   "no such effect",
+			ids:   []string{"base"},
+			color: red,
+		},
+		{
+			name: "build panics",
+			edit: KeyframeEdit{Build: func(system *System) (*Keyframe, error) {
+				panic("oops")
+			}},
+			err:   "panic building keyframe: oops",
+			ids:   []string{"base"},
+			color: red,
+		},
+		{
+			name: "delete",
+			edit: KeyframeEdit{Remove: "base"},
+			ids:  nil,
+		},
+		{
+			name:  "delete a missing keyframe",
+			edit:  KeyframeEdit{Remove: "nope"},
+			err:   `keyframe not found: "nope"`,
+			ids:   []string{"base"},
+			color: red,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := NewEffectsManager([]*Keyframe{
+				solidKeyframe("base", "base", 0, red),
+				// other only starts after the test
+				{ID: "other", Label: "other", Offset: 2 * time.Hour, Duration: time.Hour, Effect: &solidEffect{blue}},
+			})
+			system := pairSystem()
+			manager.Evaluate(system, 0)
+
+			result := manager.QueueEdit(test.edit)
+			manager.Evaluate(system, time.Second)
+
+			var res KeyframeEditResult
+			select {
+			case res = <-result:
+			default:
+				t.Fatal("the edit wasn't applied by the next frame")
+			}
+
+			switch {
+			case test.err == "" && res.Err != nil:
+				t.Fatalf("edit error = %v, want nil", res.Err)
+			case test.err != "" && (res.Err == nil || !strings.Contains(res.Err.Error(), test.err)):
+				t.Fatalf("edit error = %v, want it to contain %q", res.Err, test.err)
+			}
+
+			switch {
+			case test.id == "" && res.Keyframe != nil:
+				t.Errorf("edit added %q, want nothing", res.Keyframe.ID)
+			case test.id != "" && (res.Keyframe == nil || res.Keyframe.ID != test.id):
+				t.Errorf("edit added %v, want %q", res.Keyframe, test.id)
+			case test.id != "" && manager.Keyframe(test.id) != res.Keyframe:
+				t.Errorf("Keyframe(%q) isn't the keyframe added", test.id)
+			}
+
+			// other is always there
+			if got, want := keyframeIDs(manager), append(test.ids, "other"); !sameStrings(got, want) {
+				t.Errorf("show has keyframes %v, want %v", got, want)
+			}
+			for _, led := range system.LEDs {
+				if led.Color != test.color {
+					t.Errorf("led %d is %v, want %v", led.ID, led.Color, test.color)
+				}
+			}
+		})
+	}
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueueEditWaitsForFrame(t *testing.T) {
+	manager := NewEffectsManager([]*Keyframe{solidKeyframe("base", "base", 0, red)})
+	system := pairSystem()
+	manager.Evaluate(system, 0)
+
+	result := manager.QueueEdit(KeyframeEdit{Build: build(solidKeyframe("over", "over", 1, blue))})
+	deleted := manager.QueueEdit(KeyframeEdit{Remove: "base"})
+
+	// nothing changes until the next frame
+	select {
+	case res := <-result:
+		t.Fatalf("the edit was applied between frames: %+v", res)
+	default:
+	}
+	if manager.Keyframe("over") != nil || manager.Keyframe("base") == nil {
+		t.Fatalf("show has keyframes %v before the next frame, want only base", keyframeIDs(manager))
+	}
+
+	// the edits are applied in order at the start of the frame, so it
+	// renders them
+	manager.Evaluate(system, 40*time.Millisecond)
+	if res := <-result; res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := <-deleted; res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if got := keyframeIDs(manager); !sameStrings(got, []string{"over"}) {
+		t.Errorf("show has keyframes %v, want [over]", got)
+	}
+	if system.LEDs[0].Color != blue {
+		t.Errorf("the frame rendered %v, want %v", system.LEDs[0].Color, blue)
+	}
+}
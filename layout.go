@@ -0,0 +1,347 @@
+package ledsim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// LayoutVersion is the version of the structured layout format read and
+// written by this package.
+const LayoutVersion = 1
+
+// Layout is the structured, single document description of a sculpture. It
+// replaces the ledpos.txt, mapping.txt and teensy.txt trio: every LED, chain,
+// edge, controller and pin is listed explicitly instead of being inferred
+// from regexes and nearest-coordinate matching.
+type Layout struct {
+	Version     int                `json:"version"`
+	Controllers []LayoutController `json:"controllers"`
+	Chains      []LayoutChain      `json:"chains"`
+	LEDs        []LayoutLED        `json:"leds"`
+	// Edges are pairs of LED IDs. Neighbours are added in the order the
+	// edges are listed.
+	Edges [][2]int `json:"edges"`
+	// Groups are named sets of LEDs that keyframes can target.
+	Groups []*Group `json:"groups,omitempty"`
+}
+
+// LayoutController is a Teensy and the chains wired to each of its pins.
+type LayoutController struct {
+	IP   string      `json:"ip"`
+	Pins []LayoutPin `json:"pins"`
+}
+
+// LayoutPin lists the chain IDs daisy chained on one pin, in the order the
+// data flows through them.
+type LayoutPin struct {
+	Chains []int `json:"chains"`
+}
+
+// LayoutChain is a physical run of LEDs. Reversed chains are wired so that
+// data enters at the last LED of the chain rather than the first.
+type LayoutChain struct {
+	ID       int  `json:"id"`
+	Reversed bool `json:"reversed,omitempty"`
+}
+
+// LayoutLED is a single LED. IDs must be 0..n-1 in order, and positions
+// within a chain must be 0..length-1. Direction is the way the LED faces and
+// may be omitted.
+type LayoutLED struct {
+	ID        int         `json:"id"`
+	Chain     int         `json:"chain"`
+	Position  int         `json:"position"`
+	Coord     [3]float64  `json:"coord"`
+	Direction *[3]float64 `json:"direction,omitempty"`
+}
+
+// DecodeLayout reads and validates a JSON layout. Unknown fields are rejected
+// so that typos don't silently fall back to zero values.
+func DecodeLayout(r io.Reader) (*Layout, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	layout := new(Layout)
+	if err := dec.Decode(layout); err != nil {
+		return nil, fmt.Errorf("decode layout: %w", err)
+	}
+
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+// Encode writes the layout as indented JSON.
+func (l *Layout) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(l)
+}
+
+// Validate checks that the layout is internally consistent, returning every
+// problem found rather than just the first.
+func (l *Layout) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if l.Version != LayoutVersion {
+		addProblem("unsupported version %d, expected %d", l.Version, LayoutVersion)
+	}
+
+	chains := make(map[int]bool)
+	for _, chain := range l.Chains {
+		if chains[chain.ID] {
+			addProblem("chain %d is declared more than once", chain.ID)
+		}
+		chains[chain.ID] = true
+	}
+
+	wired := make(map[int]string)
+	ips := make(map[string]bool)
+	for _, controller := range l.Controllers {
+		if net.ParseIP(controller.IP).To4() == nil {
+			addProblem("controller %q is not an IPv4 address", controller.IP)
+		}
+		if ips[controller.IP] {
+			addProblem("controller %q is declared more than once", controller.IP)
+		}
+		ips[controller.IP] = true
+
+		for pin, p := range controller.Pins {
+			for _, chain := range p.Chains {
+				if !chains[chain] {
+					addProblem("controller %q pin %d references undeclared chain %d", controller.IP, pin, chain)
+				}
+				if other, found := wired[chain]; found {
+					addProblem("chain %d is wired to both %q and %q", chain, other, controller.IP)
+				}
+				wired[chain] = controller.IP
+			}
+		}
+	}
+
+	for _, chain := range l.Chains {
+		if _, found := wired[chain.ID]; !found {
+			addProblem("chain %d is not wired to any controller", chain.ID)
+		}
+	}
+
+	positions := make(map[int]map[int]bool)
+	for i, led := range l.LEDs {
+		if led.ID != i {
+			addProblem("led at index %d has id %d, ids must be 0..n-1 in order", i, led.ID)
+		}
+		if !chains[led.Chain] {
+			addProblem("led %d references undeclared chain %d", led.ID, led.Chain)
+			continue
+		}
+		if positions[led.Chain] == nil {
+			positions[led.Chain] = make(map[int]bool)
+		}
+		if positions[led.Chain][led.Position] {
+			addProblem("led %d duplicates position %d on chain %d", led.ID, led.Position, led.Chain)
+		}
+		positions[led.Chain][led.Position] = true
+	}
+
+	for chain, seen := range positions {
+		for pos := range seen {
+			if pos < 0 || pos >= len(seen) {
+				addProblem("chain %d has position %d but only %d leds", chain, pos, len(seen))
+			}
+		}
+	}
+
+	// edges are undirected, so [a b] and [b a] are the same edge
+	edges := make(map[[2]int]bool)
+	for _, edge := range l.Edges {
+		if edge[0] < 0 || edge[0] >= len(l.LEDs) || edge[1] < 0 || edge[1] >= len(l.LEDs) {
+			addProblem("edge %v references a led that does not exist", edge)
+			continue
+		} else if edge[0] == edge[1] {
+			addProblem("edge %v connects a led to itself", edge)
+			continue
+		}
+
+		key := edge
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if edges[key] {
+			addProblem("edge %v is listed more than once", edge)
+		}
+		edges[key] = true
+	}
+
+	groups := make(map[string]bool)
+	for _, group := range l.Groups {
+		if groups[group.Name] {
+			addProblem("group %q is declared more than once", group.Name)
+		}
+		groups[group.Name] = true
+		group.validate(chains, ips, len(l.LEDs), addProblem)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("invalid layout:\n\t" + strings.Join(problems, "\n\t"))
+	}
+
+	return nil
+}
+
+// LoadLayout validates layout and loads it into sys.
+func LoadLayout(sys *System, layout *Layout) error {
+	if err := populateLayout(sys, layout); err != nil {
+		return err
+	}
+
+	sys.Normalize()
+
+	for _, group := range layout.Groups {
+		sys.SetGroup(group)
+	}
+
+	fmt.Println("loaded", len(sys.LEDs), "leds")
+
+	return nil
+}
+
+func populateLayout(sys *System, layout *Layout) error {
+	if err := layout.Validate(); err != nil {
+		return err
+	}
+
+	reversed := make(map[int]bool)
+	for _, chain := range layout.Chains {
+		reversed[chain.ID] = chain.Reversed
+	}
+
+	sys.Teensys = make(map[string]*Teensy)
+	chainToIp := make(map[int]string)
+	for _, controller := range layout.Controllers {
+		teensy := &Teensy{
+			IP:     controller.IP,
+			Chains: make(map[int]*Chain),
+		}
+
+		for pin, p := range controller.Pins {
+			for pos, chain := range p.Chains {
+				teensy.Chains[chain] = &Chain{Id: chain, Pin: pin, PosOnPin: pos, Length: 0, Reversed: reversed[chain]}
+				chainToIp[chain] = controller.IP
+			}
+		}
+
+		sys.Teensys[controller.IP] = teensy
+	}
+
+	for _, l := range layout.LEDs {
+		led := &LED{
+			X: l.Coord[0],
+			Y: l.Coord[1],
+			Z: l.Coord[2],
+			PhysicalLEDPosition: PhysicalLEDPosition{
+				TeensyIp:        chainToIp[l.Chain],
+				Chain:           l.Chain,
+				PositionOnChain: l.Position,
+			},
+		}
+		if l.Direction != nil {
+			led.Direction = Vec3{X: l.Direction[0], Y: l.Direction[1], Z: l.Direction[2]}
+		}
+		sys.Teensys[led.TeensyIp].Chains[l.Chain].Length += 1
+		sys.AddLED(led)
+	}
+
+	for _, edge := range layout.Edges {
+		u, v := sys.LEDs[edge[0]], sys.LEDs[edge[1]]
+		u.Neighbours = append(u.Neighbours, v)
+		v.Neighbours = append(v.Neighbours, u)
+	}
+
+	return nil
+}
+
+// ConvertLegacyLayout parses the ledpos.txt, mapping.txt and teensy.txt trio
+// and returns the equivalent structured layout. Loading the result with
+// LoadLayout produces the same System as LoadLEDsFrom on the original files,
+// including the order of every LED's neighbours.
+func ConvertLegacyLayout(src *LayoutSource) (*Layout, error) {
+	sys := NewSystem()
+	g := newGraph()
+	if err := g.populateGraph(sys, src); err != nil {
+		return nil, err
+	}
+	if err := g.err(); err != nil {
+		return nil, err
+	}
+
+	layout := &Layout{
+		Version: LayoutVersion,
+		LEDs:    make([]LayoutLED, 0, len(sys.LEDs)),
+		Edges:   make([][2]int, 0, len(g.edgeList)),
+	}
+
+	ips := make([]string, 0, len(sys.Teensys))
+	for ip := range sys.Teensys {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	for _, ip := range ips {
+		teensy := sys.Teensys[ip]
+		controller := LayoutController{IP: ip}
+
+		for _, chain := range teensy.Chains {
+			for len(controller.Pins) <= chain.Pin {
+				controller.Pins = append(controller.Pins, LayoutPin{})
+			}
+
+			pin := &controller.Pins[chain.Pin]
+			for len(pin.Chains) <= chain.PosOnPin {
+				pin.Chains = append(pin.Chains, 0)
+			}
+			pin.Chains[chain.PosOnPin] = chain.Id
+
+			layout.Chains = append(layout.Chains, LayoutChain{ID: chain.Id, Reversed: chain.Reversed})
+		}
+
+		layout.Controllers = append(layout.Controllers, controller)
+	}
+
+	sort.Slice(layout.Chains, func(i, j int) bool {
+		return layout.Chains[i].ID < layout.Chains[j].ID
+	})
+
+	for _, led := range sys.LEDs {
+		l := LayoutLED{
+			ID:       led.ID,
+			Chain:    led.Chain,
+			Position: led.PositionOnChain,
+			Coord:    [3]float64{led.X, led.Y, led.Z},
+		}
+		if led.PhysicalDirection != (Vec3{}) {
+			l.Direction = &[3]float64{led.PhysicalDirection.X, led.PhysicalDirection.Y, led.PhysicalDirection.Z}
+		}
+		layout.LEDs = append(layout.LEDs, l)
+	}
+
+	for _, edge := range g.edgeList {
+		layout.Edges = append(layout.Edges, [2]int{edge[0].ID, edge[1].ID})
+	}
+
+	if err := layout.Validate(); err != nil {
+		return nil, fmt.Errorf("convert legacy layout: %w", err)
+	}
+
+	return layout, nil
+}
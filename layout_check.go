@@ -0,0 +1,159 @@
+package ledsim
+
+import (
+	"fmt"
+	"sort"
+)
+
+type LayoutProblemKind string
+
+const (
+	ProblemSyntax       LayoutProblemKind = "syntax"
+	ProblemUnwiredChain LayoutProblemKind = "unwired-chain"
+	ProblemSnappedEdge  LayoutProblemKind = "snapped-edge"
+	ProblemDuplicateLED LayoutProblemKind = "duplicate-led"
+	ProblemPinOverflow  LayoutProblemKind = "pin-overflow"
+	ProblemIsolatedLED  LayoutProblemKind = "isolated-led"
+	ProblemLEDCount     LayoutProblemKind = "led-count"
+)
+
+// LayoutProblem is a single issue found while checking a layout.
+type LayoutProblem struct {
+	Kind    LayoutProblemKind
+	Message string
+}
+
+func (p LayoutProblem) String() string {
+	return string(p.Kind) + ": " + p.Message
+}
+
+// DefaultMaxLEDsPerPin is the number of LEDs the Teensy firmware drives on a
+// single pin.
+const DefaultMaxLEDsPerPin = 256
+
+// LayoutCheckOptions are the tolerances used by CheckLayout. Distances are in
+// the layout's own (un-normalised) units.
+type LayoutCheckOptions struct {
+	// MaxSnapDistance is how far a mapping.txt endpoint may be from the LED
+	// it is snapped to.
+	MaxSnapDistance float64
+	// DuplicateDistance is how close two LEDs may be before they are
+	// reported as duplicates.
+	DuplicateDistance float64
+	MaxLEDsPerPin     int
+	// ExpectedLEDs is the total LED count the effects are written for, or 0
+	// to skip the check.
+	ExpectedLEDs int
+}
+
+// CheckLegacyLayout parses the ledpos.txt, mapping.txt and teensy.txt trio and
+// returns every problem found, in addition to those reported by CheckLayout.
+// The error is only non-nil if the files could not be read.
+func CheckLegacyLayout(src *LayoutSource, opts *LayoutCheckOptions) ([]LayoutProblem, error) {
+	sys := NewSystem()
+	g := newGraph()
+	if err := g.populateGraph(sys, src); err != nil {
+		return nil, err
+	}
+
+	problems := append([]LayoutProblem{}, g.problems...)
+	for _, snap := range g.snaps {
+		if snap.distance > opts.MaxSnapDistance {
+			problems = append(problems, LayoutProblem{
+				Kind: ProblemSnappedEdge,
+				Message: fmt.Sprintf("mapping.txt:%d: endpoint snapped to led %d (%q) which is %.1f units away",
+					snap.line, snap.led.ID, snap.led.RawLine, snap.distance),
+			})
+		}
+	}
+
+	for _, led := range sys.LEDs {
+		led.Neighbours = g.edges[led]
+	}
+
+	return append(problems, CheckLayout(sys, opts)...), nil
+}
+
+// CheckStructuredLayout validates layout and returns every problem reported
+// by CheckLayout on the system it describes.
+func CheckStructuredLayout(layout *Layout, opts *LayoutCheckOptions) ([]LayoutProblem, error) {
+	sys := NewSystem()
+	if err := populateLayout(sys, layout); err != nil {
+		return nil, err
+	}
+
+	return CheckLayout(sys, opts), nil
+}
+
+// CheckLayout reports duplicate and isolated LEDs, pins that drive more LEDs
+// than the firmware allows and an unexpected total LED count. sys must not
+// have been normalised yet.
+func CheckLayout(sys *System, opts *LayoutCheckOptions) []LayoutProblem {
+	var problems []LayoutProblem
+	addProblem := func(kind LayoutProblemKind, format string, args ...interface{}) {
+		problems = append(problems, LayoutProblem{
+			Kind:    kind,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if opts.ExpectedLEDs > 0 && len(sys.LEDs) != opts.ExpectedLEDs {
+		addProblem(ProblemLEDCount, "layout has %d leds, expected %d", len(sys.LEDs), opts.ExpectedLEDs)
+	}
+
+	// sort by X so that only a narrow window needs to be compared
+	byX := append([]*LED{}, sys.LEDs...)
+	sort.Slice(byX, func(i, j int) bool {
+		return byX[i].X < byX[j].X
+	})
+	for i, a := range byX {
+		for _, b := range byX[i+1:] {
+			if b.X-a.X > opts.DuplicateDistance {
+				break
+			}
+			if getDistance(a.X, a.Y, a.Z, b.X, b.Y, b.Z) <= opts.DuplicateDistance {
+				addProblem(ProblemDuplicateLED, "led %d (chain %d position %d) and led %d (chain %d position %d) are at the same position",
+					a.ID, a.Chain, a.PositionOnChain, b.ID, b.Chain, b.PositionOnChain)
+			}
+		}
+	}
+
+	for _, led := range sys.LEDs {
+		if len(led.Neighbours) == 0 {
+			addProblem(ProblemIsolatedLED, "led %d (chain %d position %d) has no neighbours",
+				led.ID, led.Chain, led.PositionOnChain)
+		}
+	}
+
+	ips := make([]string, 0, len(sys.Teensys))
+	for ip := range sys.Teensys {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	for _, ip := range ips {
+		pins := make(map[int]int)
+		for _, chain := range sys.Teensys[ip].Chains {
+			pins[chain.Pin] += chain.Length
+		}
+
+		pinNumbers := make([]int, 0, len(pins))
+		for pin := range pins {
+			pinNumbers = append(pinNumbers, pin)
+		}
+		sort.Ints(pinNumbers)
+
+		for _, pin := range pinNumbers {
+			if pins[pin] > opts.MaxLEDsPerPin {
+				addProblem(ProblemPinOverflow, "teensy %s pin %d drives %d leds, the limit is %d",
+					ip, pin, pins[pin], opts.MaxLEDsPerPin)
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Kind < problems[j].Kind
+	})
+
+	return problems
+}
@@ -0,0 +1,244 @@
+package ledsim
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testLayout is a valid layout of two chains of two LEDs on one controller,
+// joined end to end.
+func testLayout() *Layout {
+	return &Layout{
+		Version: LayoutVersion,
+		Controllers: []LayoutController{
+			{IP: "169.254.2.1", Pins: []LayoutPin{{Chains: []int{0, 1}}}},
+		},
+		Chains: []LayoutChain{{ID: 0}, {ID: 1, Reversed: true}},
+		LEDs: []LayoutLED{
+			{ID: 0, Chain: 0, Position: 0, Coord: [3]float64{0, 0, 0}},
+			{ID: 1, Chain: 0, Position: 1, Coord: [3]float64{1, 0, 0}},
+			{ID: 2, Chain: 1, Position: 0, Coord: [3]float64{2, 0, 0}},
+			{ID: 3, Chain: 1, Position: 1, Coord: [3]float64{3, 0, 0}},
+		},
+		Edges: [][2]int{{0, 1}, {1, 2}, {2, 3}},
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(l *Layout)
+		// problem is part of the error expected, or empty for none
+		problem string
+	}{
+		{
+			name:   "valid",
+			modify: func(l *Layout) {},
+		},
+		{
+			name:    "wrong version",
+			modify:  func(l *Layout) { l.Version = 2 },
+			problem: "unsupported version 2",
+		},
+		{
+			name:    "duplicate edge",
+			modify:  func(l *Layout) { l.Edges = append(l.Edges, [2]int{1, 2}) },
+			problem: "edge [1 2] is listed more than once",
+		},
+		{
+			name:    "duplicate edge reversed",
+			modify:  func(l *Layout) { l.Edges = append(l.Edges, [2]int{2, 1}) },
+			problem: "edge [2 1] is listed more than once",
+		},
+		{
+			name:    "self loop",
+			modify:  func(l *Layout) { l.Edges = append(l.Edges, [2]int{3, 3}) },
+			problem: "connects a led to itself",
+		},
+		{
+			name:    "edge out of range",
+			modify:  func(l *Layout) { l.Edges = append(l.Edges, [2]int{3, 4}) },
+			problem: "edge [3 4] references a led that does not exist",
+		},
+		{
+			name:    "duplicate chain",
+			modify:  func(l *Layout) { l.Chains = append(l.Chains, LayoutChain{ID: 1}) },
+			problem: "chain 1 is declared more than once",
+		},
+		{
+			name: "unwired chain",
+			modify: func(l *Layout) {
+				l.Controllers[0].Pins[0].Chains = []int{0}
+			},
+			problem: "chain 1 is not wired to any controller",
+		},
+		{
+			name: "chain wired twice",
+			modify: func(l *Layout) {
+				l.Controllers = append(l.Controllers, LayoutController{IP: "169.254.2.2", Pins: []LayoutPin{{Chains: []int{1}}}})
+			},
+			problem: "chain 1 is wired to both",
+		},
+		{
+			name:    "bad controller IP",
+			modify:  func(l *Layout) { l.Controllers[0].IP = "teensy" },
+			problem: `controller "teensy" is not an IPv4 address`,
+		},
+		{
+			name:    "ids out of order",
+			modify:  func(l *Layout) { l.LEDs[1].ID = 5 },
+			problem: "led at index 1 has id 5",
+		},
+		{
+			name:    "undeclared chain",
+			modify:  func(l *Layout) { l.LEDs[3].Chain = 7 },
+			problem: "led 3 references undeclared chain 7",
+		},
+		{
+			name:    "duplicate position",
+			modify:  func(l *Layout) { l.LEDs[1].Position = 0 },
+			problem: "led 1 duplicates position 0 on chain 0",
+		},
+		{
+			name:    "position gap",
+			modify:  func(l *Layout) { l.LEDs[1].Position = 2 },
+			problem: "chain 0 has position 2 but only 2 leds",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout := testLayout()
+			test.modify(layout)
+			err := layout.Validate()
+
+			switch {
+			case test.problem == "" && err != nil:
+				t.Fatalf("Validate() = %v, want nil", err)
+			case test.problem != "" && err == nil:
+				t.Fatalf("Validate() = nil, want %q", test.problem)
+			case test.problem != "" && !strings.Contains(err.Error(), test.problem):
+				t.Fatalf("Validate() = %v, want it to contain %q", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestLoadLayout(t *testing.T) {
+	sys := NewSystem()
+	if err := LoadLayout(sys, testLayout()); err != nil {
+		t.Fatal(err)
+	}
+
+	wantNeighbours := [][]int{{1}, {0, 2}, {1, 3}, {2}}
+	for i, led := range sys.LEDs {
+		if got := neighbourIDs(led); !sameInts(got, wantNeighbours[i]) {
+			t.Errorf("led %d has neighbours %v, want %v", i, got, wantNeighbours[i])
+		}
+	}
+
+	chain := sys.Teensys["169.254.2.1"].Chains[1]
+	if chain.Pin != 0 || chain.PosOnPin != 1 || chain.Length != 2 || !chain.Reversed {
+		t.Errorf("chain 1 = %+v, want pin 0, position 1, length 2, reversed", chain)
+	}
+}
+
+func neighbourIDs(led *LED) []int {
+	result := make([]int, len(led.Neighbours))
+	for i, neighbour := range led.Neighbours {
+		result[i] = neighbour.ID
+	}
+	return result
+}
+
+func closeVec(a, b Vec3) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9 && math.Abs(a.Z-b.Z) < 1e-9
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConvertLegacyLayout(t *testing.T) {
+	legacy := NewSystem()
+	if err := LoadLEDsFrom(legacy, EmbeddedLayout()); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := ConvertLegacyLayout(EmbeddedLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the layout has to survive being written out and read back
+	var buf bytes.Buffer
+	if err := layout.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeLayout(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converted := NewSystem()
+	if err := LoadLayout(converted, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(converted.LEDs) != len(legacy.LEDs) {
+		t.Fatalf("converted layout has %d leds, want %d", len(converted.LEDs), len(legacy.LEDs))
+	}
+
+	for i, want := range legacy.LEDs {
+		got := converted.LEDs[i]
+		// the direction is normalised again when it's loaded, which can
+		// change its last bit
+		if got.Physical != want.Physical || !closeVec(got.PhysicalDirection, want.PhysicalDirection) ||
+			got.PhysicalLEDPosition != want.PhysicalLEDPosition {
+			t.Fatalf("led %d = %+v at %v facing %v, want %+v at %v facing %v", i,
+				got.PhysicalLEDPosition, got.Physical, got.PhysicalDirection, want.PhysicalLEDPosition, want.Physical, want.PhysicalDirection)
+		}
+		if !sameInts(neighbourIDs(got), neighbourIDs(want)) {
+			t.Fatalf("led %d has neighbours %v, want %v", i, neighbourIDs(got), neighbourIDs(want))
+		}
+
+		seen := make(map[int]bool)
+		for _, id := range neighbourIDs(want) {
+			if seen[id] {
+				t.Fatalf("led %d has led %d as a neighbour more than once", i, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestConvertLegacyLayoutRepeatedMapping(t *testing.T) {
+	want, err := ConvertLegacyLayout(EmbeddedLayout())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mapping.txt can list an edge that's already there
+	src := EmbeddedLayout()
+	mapping := string(mappingFile)
+	firstLine := mapping[:strings.Index(mapping, "\n")+1]
+	src.Mapping = strings.NewReader(mapping + firstLine)
+
+	got, err := ConvertLegacyLayout(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Edges) != len(want.Edges) {
+		t.Fatalf("repeating a mapping line gave %d edges, want %d", len(got.Edges), len(want.Edges))
+	}
+}
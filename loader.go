@@ -1,11 +1,154 @@
 package ledsim
 
 import (
+	"bytes"
 	_ "embed"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 )
 
+// LayoutSource holds the three files that describe a sculpture: the LED
+// positions grouped by chain, the extra edges between chains and the
+// Teensy/pin assignment of every chain.
+type LayoutSource struct {
+	LEDPos  io.Reader
+	Mapping io.Reader
+	Teensy  io.Reader
+}
+
+// EmbeddedLayout returns the layout that was compiled into the binary.
+func EmbeddedLayout() *LayoutSource {
+	return &LayoutSource{
+		LEDPos:  bytes.NewReader(ledposFile),
+		Mapping: bytes.NewReader(mappingFile),
+		Teensy:  bytes.NewReader(teensyFile),
+	}
+}
+
+// EmbeddedLEDCount returns the number of LEDs in the layout compiled into the
+// binary, which is what the show's effects are written for, or 0 if it can't
+// be parsed. Unlike loading the layout it doesn't log its problems.
+func EmbeddedLEDCount() int {
+	sys := NewSystem()
+	if err := newGraph().populateGraph(sys, EmbeddedLayout()); err != nil {
+		return 0
+	}
+	return len(sys.LEDs)
+}
+
+// LayoutPaths selects the layout and timing files to load at runtime. An empty
+// path falls back to the copy embedded in the binary. If Layout is set it names
+// a structured JSON layout, which is used instead of the three legacy files.
+type LayoutPaths struct {
+	Layout  string `json:"layout"`
+	LEDPos  string `json:"ledpos"`
+	Mapping string `json:"mapping"`
+	Teensy  string `json:"teensy"`
+	Timings string `json:"timings"`
+}
+
+// ReadLayoutPaths reads a JSON config file of the form
+// {"layout": "...", "ledpos": "...", "mapping": "...", "teensy": "...", "timings": "..."}.
+// Relative paths are used as-is, relative to the working directory.
+func ReadLayoutPaths(configPath string) (*LayoutPaths, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read layout config: %w", err)
+	}
+
+	paths := new(LayoutPaths)
+	if err := json.Unmarshal(data, paths); err != nil {
+		return nil, fmt.Errorf("parse layout config %q: %w", configPath, err)
+	}
+
+	return paths, nil
+}
+
+func readFileOr(path string, fallback []byte) ([]byte, error) {
+	if path == "" {
+		return fallback, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Open reads every file named in p, substituting the embedded copy for any
+// path that is empty.
+func (p *LayoutPaths) Open() (*LayoutSource, error) {
+	ledpos, err := readFileOr(p.LEDPos, ledposFile)
+	if err != nil {
+		return nil, fmt.Errorf("read led positions: %w", err)
+	}
+
+	mapping, err := readFileOr(p.Mapping, mappingFile)
+	if err != nil {
+		return nil, fmt.Errorf("read mapping: %w", err)
+	}
+
+	teensy, err := readFileOr(p.Teensy, teensyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read teensy layout: %w", err)
+	}
+
+	return &LayoutSource{
+		LEDPos:  bytes.NewReader(ledpos),
+		Mapping: bytes.NewReader(mapping),
+		Teensy:  bytes.NewReader(teensy),
+	}, nil
+}
+
+// Load loads the layout selected by p into sys.
+func (p *LayoutPaths) Load(sys *System) error {
+	if p.Layout != "" {
+		f, err := os.Open(p.Layout)
+		if err != nil {
+			return fmt.Errorf("read layout: %w", err)
+		}
+		defer f.Close()
+
+		layout, err := DecodeLayout(f)
+		if err != nil {
+			return err
+		}
+
+		return LoadLayout(sys, layout)
+	}
+
+	src, err := p.Open()
+	if err != nil {
+		return err
+	}
+
+	return LoadLEDsFrom(sys, src)
+}
+
+// ReadTimings returns the contents of the timings file, or the embedded
+// timings if p.Timings is empty.
+func (p *LayoutPaths) ReadTimings() ([]byte, error) {
+	data, err := readFileOr(p.Timings, TimingData)
+	if err != nil {
+		return nil, fmt.Errorf("read timings: %w", err)
+	}
+
+	return data, nil
+}
+
+// LoadLEDs loads the layout embedded in the binary into sys.
 func LoadLEDs(sys *System) {
+	if err := LoadLEDsFrom(sys, EmbeddedLayout()); err != nil {
+		panic(err)
+	}
+}
+
+// LoadLEDsFrom loads the layout read from src into sys.
+func LoadLEDsFrom(sys *System, src *LayoutSource) error {
 	// var (
 	// 	scale  = 0.0005 * 2.056422
 	// 	origin = [...]float64{
@@ -16,13 +159,18 @@ func LoadLEDs(sys *System) {
 	// )
 
 	g := newGraph()
-	g.populateGraph(sys)
-	sys.Normalize()
-
+	if err := g.populateGraph(sys, src); err != nil {
+		return err
+	}
+	if err := g.err(); err != nil {
+		return err
+	}
 	for _, led := range sys.LEDs {
 		led.Neighbours = g.edges[led]
 	}
 
+	sys.Normalize()
+
 	// destroy graph
 	for k := range g.edges {
 		delete(g.edges, k)
@@ -33,4 +181,6 @@ func LoadLEDs(sys *System) {
 	g = nil
 
 	fmt.Println("loaded", len(sys.LEDs), "leds")
+
+	return nil
 }
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"ledsim"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WatchBlacklist exports manager's blacklist: how many keyframes are
+// blacklisted, and a series for each with its panic message. Stacks are too
+// long for labels, see the control panel's blacklist endpoint for those.
+func WatchBlacklist(manager *ledsim.EffectsManager) {
+	countMetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "blacklisted_keyframes",
+		Help: "The number of keyframes whose effects panicked.",
+	})
+	entryMetric := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blacklisted_keyframe",
+		Help: "A keyframe whose effect panicked, 1 if it renders its fallback and 0 if it renders nothing.",
+	}, []string{"id", "label", "stage", "message"})
+	prometheus.MustRegister(countMetric, entryMetric)
+
+	manager.OnBlacklistChange(func(entries []ledsim.BlacklistEntry) {
+		countMetric.Set(float64(len(entries)))
+
+		entryMetric.Reset()
+		for _, entry := range entries {
+			value := 0.0
+			if entry.Fallback != "" && entry.FallbackError == "" {
+				value = 1
+			}
+			entryMetric.WithLabelValues(entry.ID, entry.Label, entry.Stage, entry.Message).Set(value)
+		}
+	})
+}
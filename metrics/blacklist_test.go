@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ledsim"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// panicEffect panics whenever it's evaluated.
+type panicEffect struct{}
+
+func (e *panicEffect) OnEnter(system *ledsim.System)                {}
+func (e *panicEffect) Eval(progress float64, system *ledsim.System) { panic("broken") }
+func (e *panicEffect) OnExit(system *ledsim.System)                 {}
+
+// blankEffect does nothing, as a fallback that works.
+type blankEffect struct{}
+
+func (e *blankEffect) OnEnter(system *ledsim.System)                {}
+func (e *blankEffect) Eval(progress float64, system *ledsim.System) {}
+func (e *blankEffect) OnExit(system *ledsim.System)                 {}
+
+func TestWatchBlacklist(t *testing.T) {
+	manager := ledsim.NewEffectsManager([]*ledsim.Keyframe{
+		{ID: "a", Label: "broken", Duration: time.Second, Effect: &panicEffect{}, Fallback: &blankEffect{}},
+		{ID: "b", Label: "also broken", Offset: time.Second, Duration: time.Second, Effect: &panicEffect{}},
+	})
+	WatchBlacklist(manager)
+
+	sys := ledsim.NewSystem()
+	sys.AddLED(&ledsim.LED{})
+	manager.Evaluate(sys, 0)
+	manager.Evaluate(sys, 1500*time.Millisecond)
+
+	want := `
+# HELP blacklisted_keyframe A keyframe whose effect panicked, 1 if it renders its fallback and 0 if it renders nothing.
+# TYPE blacklisted_keyframe gauge
+blacklisted_keyframe{id="a",label="broken",message="broken",stage="Eval"} 1
+blacklisted_keyframe{id="b",label="also broken",message="broken",stage="Eval"} 0
+# HELP blacklisted_keyframes The number of keyframes whose effects panicked.
+# TYPE blacklisted_keyframes gauge
+blacklisted_keyframes 2
+`
+	if err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(want),
+		"blacklisted_keyframes", "blacklisted_keyframe"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package modelimport builds structured layouts from 3D models, so that a
+// sculpture can be previewed without a custom ledpos.txt export.
+//
+// A model is read as a set of polylines, one per physical strip. LEDs are
+// placed along each polyline at a fixed pitch, neighbouring LEDs are joined
+// by an edge and each polyline becomes its own chain.
+package modelimport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"ledsim"
+)
+
+// Polyline is an ordered list of points in model units.
+type Polyline [][3]float64
+
+// DefaultPinsPerController is the number of output pins on a Teensy.
+const DefaultPinsPerController = 8
+
+// Options controls how polylines are turned into a layout.
+type Options struct {
+	// Pitch is the distance between LEDs along a polyline, in model units.
+	Pitch float64
+	// Controllers are the IPs that chains are wired to, in order. Each one
+	// takes PinsPerController pins before moving on to the next.
+	Controllers       []string
+	PinsPerController int
+	// ChainsPerPin is how many chains are daisy chained on each pin.
+	ChainsPerPin int
+	// JoinDistance connects the ends of each polyline to the nearest LED on
+	// another polyline within this distance, so strips that meet in the
+	// model meet in the graph. 0 disables joining.
+	JoinDistance float64
+}
+
+// Read reads polylines from r, choosing the parser by the extension of name
+// (.obj or .ply).
+func Read(name string, r io.Reader) ([]Polyline, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".obj":
+		return ReadOBJ(r)
+	case ".ply":
+		return ReadPLY(r)
+	default:
+		return nil, fmt.Errorf("%s: unknown model format, expected .obj or .ply", name)
+	}
+}
+
+// BuildLayout places LEDs along polylines and wires them up according to
+// opts. The result is validated before it is returned.
+func BuildLayout(polylines []Polyline, opts *Options) (*ledsim.Layout, error) {
+	if opts.Pitch <= 0 {
+		return nil, errors.New("pitch must be positive")
+	}
+	if len(opts.Controllers) == 0 {
+		return nil, errors.New("at least one controller is required")
+	}
+
+	pinsPerController := opts.PinsPerController
+	if pinsPerController <= 0 {
+		pinsPerController = DefaultPinsPerController
+	}
+	chainsPerPin := opts.ChainsPerPin
+	if chainsPerPin <= 0 {
+		chainsPerPin = 1
+	}
+
+	layout := &ledsim.Layout{Version: ledsim.LayoutVersion}
+	for _, ip := range opts.Controllers {
+		layout.Controllers = append(layout.Controllers, ledsim.LayoutController{IP: ip})
+	}
+
+	// ends are the first and last LED of every chain, for joining
+	var ends [][2]int
+
+	for _, polyline := range polylines {
+		points := samplePolyline(polyline, opts.Pitch)
+		if len(points) == 0 {
+			continue
+		}
+
+		chain := len(layout.Chains)
+		pin := chain / chainsPerPin
+		controller := pin / pinsPerController
+		if controller >= len(opts.Controllers) {
+			return nil, fmt.Errorf("%d polylines need more than the %d pins on %d controllers",
+				len(polylines), pinsPerController*len(opts.Controllers), len(opts.Controllers))
+		}
+
+		pins := &layout.Controllers[controller].Pins
+		for len(*pins) <= pin%pinsPerController {
+			*pins = append(*pins, ledsim.LayoutPin{})
+		}
+		(*pins)[pin%pinsPerController].Chains = append((*pins)[pin%pinsPerController].Chains, chain)
+
+		layout.Chains = append(layout.Chains, ledsim.LayoutChain{ID: chain})
+
+		first := len(layout.LEDs)
+		// a polyline doesn't say which way its LEDs face, so they're left
+		// without a direction
+		for i, coord := range points {
+			id := len(layout.LEDs)
+			layout.LEDs = append(layout.LEDs, ledsim.LayoutLED{
+				ID:       id,
+				Chain:    chain,
+				Position: i,
+				Coord:    coord,
+			})
+			if i > 0 {
+				layout.Edges = append(layout.Edges, [2]int{id - 1, id})
+			}
+		}
+		ends = append(ends, [2]int{first, len(layout.LEDs) - 1})
+	}
+
+	if len(layout.LEDs) == 0 {
+		return nil, errors.New("model has no polylines long enough to hold an led")
+	}
+
+	if opts.JoinDistance > 0 {
+		layout.Edges = append(layout.Edges, joinEnds(layout, ends, opts.JoinDistance)...)
+	}
+
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func length(v [3]float64) float64 {
+	return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+}
+
+// samplePolyline returns points every pitch units along polyline, starting at
+// its first point.
+func samplePolyline(polyline Polyline, pitch float64) [][3]float64 {
+	if len(polyline) == 0 {
+		return nil
+	}
+
+	var samples [][3]float64
+	// next is how far along the current segment the next LED goes
+	next := 0.0
+	for i := 0; i+1 < len(polyline); i++ {
+		a, b := polyline[i], polyline[i+1]
+		segment := sub(b, a)
+		segmentLength := length(segment)
+		if segmentLength == 0 {
+			continue
+		}
+
+		var direction [3]float64
+		for axis := range direction {
+			direction[axis] = segment[axis] / segmentLength
+		}
+
+		for ; next <= segmentLength; next += pitch {
+			var coord [3]float64
+			for axis := range coord {
+				coord[axis] = a[axis] + direction[axis]*next
+			}
+			samples = append(samples, coord)
+		}
+		next -= segmentLength
+	}
+
+	return samples
+}
+
+func joinEnds(layout *ledsim.Layout, ends [][2]int, maxDistance float64) [][2]int {
+	joined := make(map[[2]int]bool)
+	for _, edge := range layout.Edges {
+		joined[edge] = true
+		joined[[2]int{edge[1], edge[0]}] = true
+	}
+
+	var edges [][2]int
+	for _, chainEnds := range ends {
+		for _, end := range chainEnds {
+			from := layout.LEDs[end]
+
+			nearest := -1
+			nearestDistance := maxDistance
+			for _, led := range layout.LEDs {
+				if led.Chain == from.Chain {
+					continue
+				}
+				if d := length(sub(led.Coord, from.Coord)); d <= nearestDistance {
+					nearest = led.ID
+					nearestDistance = d
+				}
+			}
+
+			if nearest < 0 || joined[[2]int{end, nearest}] {
+				continue
+			}
+			joined[[2]int{end, nearest}] = true
+			joined[[2]int{nearest, end}] = true
+			edges = append(edges, [2]int{end, nearest})
+		}
+	}
+
+	return edges
+}
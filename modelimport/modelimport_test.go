@@ -0,0 +1,97 @@
+package modelimport
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBuildLayout(t *testing.T) {
+	polylines := []Polyline{
+		// 3 units long with a corner, so LEDs fall at 0, 1, 2 and 3
+		{{0, 0, 0}, {2, 0, 0}, {2, 1, 0}},
+		// too short for the second LED
+		{{10, 0, 0}, {10, 0.5, 0}},
+	}
+
+	layout, err := BuildLayout(polylines, &Options{
+		Pitch:             1,
+		Controllers:       []string{"169.254.2.1", "169.254.2.2"},
+		PinsPerController: 1,
+		JoinDistance:      0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCoords := [][3]float64{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {2, 1, 0}, {10, 0, 0}}
+	if len(layout.LEDs) != len(wantCoords) {
+		t.Fatalf("layout has %d leds, want %d", len(layout.LEDs), len(wantCoords))
+	}
+	for i, led := range layout.LEDs {
+		for axis := range wantCoords[i] {
+			if math.Abs(led.Coord[axis]-wantCoords[i][axis]) > 1e-9 {
+				t.Errorf("led %d is at %v, want %v", i, led.Coord, wantCoords[i])
+				break
+			}
+		}
+		// a polyline doesn't say which way its LEDs face
+		if led.Direction != nil {
+			t.Errorf("led %d faces %v, want no direction", i, *led.Direction)
+		}
+	}
+
+	if len(layout.Edges) != 3 {
+		t.Errorf("layout has edges %v, want the 3 along the first polyline", layout.Edges)
+	}
+
+	// one pin per controller, so the second chain goes to the second
+	for i, controller := range layout.Controllers {
+		if len(controller.Pins) != 1 || len(controller.Pins[0].Chains) != 1 || controller.Pins[0].Chains[0] != i {
+			t.Errorf("controller %s has pins %v, want chain %d on pin 0", controller.IP, controller.Pins, i)
+		}
+	}
+}
+
+func TestBuildLayoutErrors(t *testing.T) {
+	line := []Polyline{{{0, 0, 0}, {1, 0, 0}}}
+	tests := []struct {
+		name      string
+		polylines []Polyline
+		opts      Options
+		err       string
+	}{
+		{
+			name:      "no pitch",
+			polylines: line,
+			opts:      Options{Controllers: []string{"169.254.2.1"}},
+			err:       "pitch must be positive",
+		},
+		{
+			name:      "no controllers",
+			polylines: line,
+			opts:      Options{Pitch: 1},
+			err:       "at least one controller is required",
+		},
+		{
+			name:      "too many polylines",
+			polylines: append(line, line...),
+			opts:      Options{Pitch: 1, Controllers: []string{"169.254.2.1"}, PinsPerController: 1},
+			err:       "2 polylines need more than the 1 pins",
+		},
+		{
+			name: "nothing to place",
+			opts: Options{Pitch: 1, Controllers: []string{"169.254.2.1"}},
+			err:  "model has no polylines long enough to hold an led",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := BuildLayout(test.polylines, &test.opts)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("BuildLayout() error = %v, want it to contain %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package modelimport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadOBJ reads the line elements ("l") of a Wavefront OBJ file, each of
+// which becomes a polyline. Faces and everything else are ignored. Vertex
+// references may be negative (relative to the end) and may carry a texture
+// index ("3/7"), which is dropped.
+func ReadOBJ(r io.Reader) ([]Polyline, error) {
+	var vertices [][3]float64
+	var polylines []Polyline
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("obj:%d: vertex needs 3 coordinates", line)
+			}
+
+			var vertex [3]float64
+			for i := range vertex {
+				v, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("obj:%d: %w", line, err)
+				}
+				vertex[i] = v
+			}
+			vertices = append(vertices, vertex)
+
+		case "l":
+			var polyline Polyline
+			for _, field := range fields[1:] {
+				index, err := strconv.Atoi(strings.SplitN(field, "/", 2)[0])
+				if err != nil {
+					return nil, fmt.Errorf("obj:%d: %w", line, err)
+				}
+
+				if index < 0 {
+					index += len(vertices)
+				} else {
+					index--
+				}
+				if index < 0 || index >= len(vertices) {
+					return nil, fmt.Errorf("obj:%d: vertex %s does not exist", line, field)
+				}
+
+				polyline = append(polyline, vertices[index])
+			}
+			polylines = append(polylines, polyline)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read obj: %w", err)
+	}
+
+	return polylines, nil
+}
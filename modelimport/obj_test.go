@@ -0,0 +1,81 @@
+package modelimport
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadOBJ(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+		want []Polyline
+		// err is part of the error expected, or empty for none
+		err string
+	}{
+		{
+			name: "one line",
+			obj:  "v 0 0 0\nv 1 0 0\nv 1 1 0\nl 1 2 3\n",
+			want: []Polyline{{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}},
+		},
+		{
+			name: "several lines sharing vertices",
+			obj:  "v 0 0 0\nv 1 0 0\nv 2 0 0\nl 1 2\nl 2 3\n",
+			want: []Polyline{{{0, 0, 0}, {1, 0, 0}}, {{1, 0, 0}, {2, 0, 0}}},
+		},
+		{
+			name: "negative and texture indexes",
+			obj:  "v 0 0 0\nv 1 2 3\nv 4 5 6\nl -2/1 -1/7\n",
+			want: []Polyline{{{1, 2, 3}, {4, 5, 6}}},
+		},
+		{
+			name: "faces, normals and comments are ignored",
+			obj:  "# a comment\nv 0 0 0\nvn 0 0 1\nv 1 0 0\nv 0 1 0\nf 1 2 3\n\nl 1 2\n",
+			want: []Polyline{{{0, 0, 0}, {1, 0, 0}}},
+		},
+		{
+			name: "no lines",
+			obj:  "v 0 0 0\nf 1 1 1\n",
+		},
+		{
+			name: "missing vertex",
+			obj:  "v 0 0 0\nl 1 2\n",
+			err:  "obj:2: vertex 2 does not exist",
+		},
+		{
+			name: "short vertex",
+			obj:  "v 0 0\n",
+			err:  "obj:1: vertex needs 3 coordinates",
+		},
+		{
+			name: "bad coordinate",
+			obj:  "v 0 x 0\n",
+			err:  "obj:1:",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadOBJ(strings.NewReader(test.obj))
+			checkPolylines(t, got, err, test.want, test.err)
+		})
+	}
+}
+
+// checkPolylines checks the result of reading a model against the polylines
+// or the part of the error expected.
+func checkPolylines(t *testing.T, got []Polyline, err error, want []Polyline, wantErr string) {
+	t.Helper()
+
+	switch {
+	case wantErr == "" && err != nil:
+		t.Fatalf("error = %v, want nil", err)
+	case wantErr != "" && err == nil:
+		t.Fatalf("error = nil, want %q", wantErr)
+	case wantErr != "" && !strings.Contains(err.Error(), wantErr):
+		t.Fatalf("error = %v, want it to contain %q", err, wantErr)
+	case wantErr == "" && !reflect.DeepEqual(got, want):
+		t.Fatalf("polylines = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,254 @@
+package modelimport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// plyGroupProperties are the vertex properties that split a PLY vertex list
+// into several polylines, in order of preference.
+var plyGroupProperties = []string{"polyline", "chain", "strip"}
+
+type plyProperty struct {
+	name string
+	// kind is the scalar type, or the item type of a list
+	kind string
+	// countKind is the type of a list's length, empty for scalars
+	countKind string
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// ReadPLY reads the vertex list of a PLY file (ASCII or binary) as ordered
+// points. If the vertices have an integer polyline, chain or strip property,
+// consecutive vertices with the same value form one polyline; otherwise the
+// whole list is a single polyline. Faces and other elements are ignored.
+func ReadPLY(r io.Reader) ([]Polyline, error) {
+	br := bufio.NewReader(r)
+
+	format, elements, err := readPLYHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var read func(kind string) (float64, error)
+	switch format {
+	case "ascii":
+		words := bufio.NewScanner(br)
+		words.Split(bufio.ScanWords)
+		read = func(kind string) (float64, error) {
+			if !words.Scan() {
+				if err := words.Err(); err != nil {
+					return 0, err
+				}
+				return 0, io.ErrUnexpectedEOF
+			}
+			return strconv.ParseFloat(words.Text(), 64)
+		}
+	case "binary_little_endian":
+		read = binaryReader(br, binary.LittleEndian)
+	case "binary_big_endian":
+		read = binaryReader(br, binary.BigEndian)
+	default:
+		return nil, fmt.Errorf("ply: unsupported format %q", format)
+	}
+
+	for _, element := range elements {
+		if element.name != "vertex" {
+			// elements before the vertices still have to be read past
+			for i := 0; i < element.count; i++ {
+				if _, err := readPLYRow(element, read); err != nil {
+					return nil, fmt.Errorf("ply: %s %d: %w", element.name, i, err)
+				}
+			}
+			continue
+		}
+
+		return readPLYVertices(element, read)
+	}
+
+	return nil, errors.New("ply: no vertex element")
+}
+
+func readPLYHeader(br *bufio.Reader) (string, []plyElement, error) {
+	var format string
+	var elements []plyElement
+
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		if err != nil {
+			return "", nil, fmt.Errorf("ply: header: %w", err)
+		}
+
+		fields := strings.Fields(text)
+		if line == 1 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return "", nil, errors.New("ply: missing magic number")
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) < 2 {
+				return "", nil, fmt.Errorf("ply:%d: format needs a type", line)
+			}
+			format = fields[1]
+		case "element":
+			if len(fields) != 3 {
+				return "", nil, fmt.Errorf("ply:%d: element needs a name and count", line)
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return "", nil, fmt.Errorf("ply:%d: %w", line, err)
+			}
+			elements = append(elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return "", nil, fmt.Errorf("ply:%d: property outside an element", line)
+			}
+
+			var property plyProperty
+			switch {
+			case len(fields) == 5 && fields[1] == "list":
+				property = plyProperty{name: fields[4], kind: fields[3], countKind: fields[2]}
+			case len(fields) == 3:
+				property = plyProperty{name: fields[2], kind: fields[1]}
+			default:
+				return "", nil, fmt.Errorf("ply:%d: malformed property", line)
+			}
+
+			element := &elements[len(elements)-1]
+			element.properties = append(element.properties, property)
+		case "end_header":
+			return format, elements, nil
+		}
+	}
+}
+
+func readPLYRow(element plyElement, read func(kind string) (float64, error)) (map[string]float64, error) {
+	row := make(map[string]float64, len(element.properties))
+	for _, property := range element.properties {
+		if property.countKind == "" {
+			v, err := read(property.kind)
+			if err != nil {
+				return nil, err
+			}
+			row[property.name] = v
+			continue
+		}
+
+		// lists are skipped, nothing we read from vertices is a list
+		n, err := read(property.countKind)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < int(n); i++ {
+			if _, err := read(property.kind); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return row, nil
+}
+
+func readPLYVertices(element plyElement, read func(kind string) (float64, error)) ([]Polyline, error) {
+	names := make(map[string]bool)
+	for _, property := range element.properties {
+		names[property.name] = true
+	}
+	for _, axis := range []string{"x", "y", "z"} {
+		if !names[axis] {
+			return nil, fmt.Errorf("ply: vertex has no %s property", axis)
+		}
+	}
+
+	group := ""
+	for _, name := range plyGroupProperties {
+		if names[name] {
+			group = name
+			break
+		}
+	}
+
+	var polylines []Polyline
+	var current Polyline
+	lastGroup := math.NaN()
+	for i := 0; i < element.count; i++ {
+		row, err := readPLYRow(element, read)
+		if err != nil {
+			return nil, fmt.Errorf("ply: vertex %d: %w", i, err)
+		}
+
+		if group != "" && row[group] != lastGroup {
+			if len(current) > 0 {
+				polylines = append(polylines, current)
+			}
+			current = nil
+			lastGroup = row[group]
+		}
+
+		current = append(current, [3]float64{row["x"], row["y"], row["z"]})
+	}
+	if len(current) > 0 {
+		polylines = append(polylines, current)
+	}
+
+	return polylines, nil
+}
+
+func binaryReader(r io.Reader, order binary.ByteOrder) func(kind string) (float64, error) {
+	var buf [8]byte
+	return func(kind string) (float64, error) {
+		var size int
+		switch kind {
+		case "char", "int8", "uchar", "uint8":
+			size = 1
+		case "short", "int16", "ushort", "uint16":
+			size = 2
+		case "int", "int32", "uint", "uint32", "float", "float32":
+			size = 4
+		case "double", "float64":
+			size = 8
+		default:
+			return 0, fmt.Errorf("unknown property type %q", kind)
+		}
+
+		b := buf[:size]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+
+		switch kind {
+		case "char", "int8":
+			return float64(int8(b[0])), nil
+		case "uchar", "uint8":
+			return float64(b[0]), nil
+		case "short", "int16":
+			return float64(int16(order.Uint16(b))), nil
+		case "ushort", "uint16":
+			return float64(order.Uint16(b)), nil
+		case "int", "int32":
+			return float64(int32(order.Uint32(b))), nil
+		case "uint", "uint32":
+			return float64(order.Uint32(b)), nil
+		case "float", "float32":
+			return float64(math.Float32frombits(order.Uint32(b))), nil
+		default:
+			return math.Float64frombits(order.Uint64(b)), nil
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package modelimport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestReadPLY(t *testing.T) {
+	tests := []struct {
+		name string
+		ply  string
+		want []Polyline
+		// err is part of the error expected, or empty for none
+		err string
+	}{
+		{
+			name: "single polyline",
+			ply: `ply
+format ascii 1.0
+element vertex 3
+property float x
+property float y
+property float z
+end_header
+0 0 0
+1 0 0
+1 1 0
+`,
+			want: []Polyline{{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}},
+		},
+		{
+			name: "split by chain, other properties ignored",
+			ply: `ply
+format ascii 1.0
+comment made by hand
+element vertex 4
+property float x
+property uchar red
+property float y
+property float z
+property int chain
+end_header
+0 255 0 0 7
+1 255 0 0 7
+5 255 5 5 2
+6 255 5 5 2
+`,
+			want: []Polyline{{{0, 0, 0}, {1, 0, 0}}, {{5, 5, 5}, {6, 5, 5}}},
+		},
+		{
+			name: "elements before the vertices are read past",
+			ply: `ply
+format ascii 1.0
+element face 1
+property list uchar int vertex_indices
+element vertex 2
+property float x
+property float y
+property float z
+end_header
+3 0 1 2
+0 0 0
+0 0 1
+`,
+			want: []Polyline{{{0, 0, 0}, {0, 0, 1}}},
+		},
+		{
+			name: "missing magic number",
+			ply:  "format ascii 1.0\nend_header\n",
+			err:  "ply: missing magic number",
+		},
+		{
+			name: "no vertex element",
+			ply:  "ply\nformat ascii 1.0\nelement face 0\nend_header\n",
+			err:  "ply: no vertex element",
+		},
+		{
+			name: "missing axis",
+			ply:  "ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nend_header\n0 0\n",
+			err:  "ply: vertex has no z property",
+		},
+		{
+			name: "too few vertices",
+			ply:  "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n",
+			err:  "ply: vertex 1:",
+		},
+		{
+			name: "unsupported format",
+			ply:  "ply\nformat binary_middle_endian 1.0\nelement vertex 0\nend_header\n",
+			err:  `ply: unsupported format "binary_middle_endian"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ReadPLY(strings.NewReader(test.ply))
+			checkPolylines(t, got, err, test.want, test.err)
+		})
+	}
+}
+
+func TestReadPLYBinary(t *testing.T) {
+	header := "ply\nformat %s 1.0\nelement vertex 3\nproperty float x\nproperty double y\nproperty short z\nproperty uchar strip\nend_header\n"
+	vertices := []struct {
+		x     float32
+		y     float64
+		z     int16
+		strip uint8
+	}{
+		{0.5, 1, -2, 0},
+		{1.5, 2, -3, 0},
+		{2.5, 3, -4, 1},
+	}
+	want := []Polyline{{{0.5, 1, -2}, {1.5, 2, -3}}, {{2.5, 3, -4}}}
+
+	for _, test := range []struct {
+		format string
+		order  binary.ByteOrder
+	}{
+		{"binary_little_endian", binary.LittleEndian},
+		{"binary_big_endian", binary.BigEndian},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			buf.WriteString(strings.Replace(header, "%s", test.format, 1))
+			for _, v := range vertices {
+				binary.Write(&buf, test.order, v.x)
+				binary.Write(&buf, test.order, v.y)
+				binary.Write(&buf, test.order, v.z)
+				binary.Write(&buf, test.order, v.strip)
+			}
+
+			got, err := ReadPLY(&buf)
+			checkPolylines(t, got, err, want, "")
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package ledsim
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Vec3 is a position or direction in 3D space.
+type Vec3 struct {
+	X, Y, Z float64
+}
+
+// Unit returns v scaled to length 1, or the zero vector if v is zero.
+func (v Vec3) Unit() Vec3 {
+	length := math.Sqrt(v.X*v.X + v.Y*v.Y + v.Z*v.Z)
+	if length == 0 {
+		return Vec3{}
+	}
+	return Vec3{X: v.X / length, Y: v.Y / length, Z: v.Z / length}
+}
+
+func (v Vec3) axis(a Axis) float64 {
+	switch a {
+	case AxisX:
+		return v.X
+	case AxisY:
+		return v.Y
+	default:
+		return v.Z
+	}
+}
+
+type Axis int
+
+const (
+	AxisX Axis = iota
+	AxisY
+	AxisZ
+)
+
+type NormalizeMode int
+
+const (
+	// NormalizePerAxis scales each axis to 0..1 on its own. It fills the
+	// unit cube but stretches the sculpture's proportions.
+	NormalizePerAxis NormalizeMode = iota
+	// NormalizeUniform scales every axis by the same amount so the longest
+	// axis spans 0..1, and centres the other axes on 0.5.
+	NormalizeUniform
+)
+
+// NormalizeOptions controls how physical coordinates are mapped onto the
+// 0..1 coordinates that effects work in.
+type NormalizeOptions struct {
+	Mode NormalizeMode
+	// Axes selects the physical axis that becomes X, Y and Z respectively.
+	Axes [3]Axis
+	// Flip mirrors X, Y and Z respectively after remapping.
+	Flip [3]bool
+}
+
+// DefaultNormalizeOptions matches the orientation the effects were written
+// against: X is mirrored and each axis is scaled on its own.
+var DefaultNormalizeOptions = NormalizeOptions{
+	Mode: NormalizePerAxis,
+	Axes: [3]Axis{AxisX, AxisY, AxisZ},
+	Flip: [3]bool{true, false, false},
+}
+
+// ParseNormalizeOptions builds options from command line style strings: mode
+// is "per-axis" or "uniform", axes is a permutation of "xyz" such as "xzy"
+// (physical Z becomes Y), and flip lists the resulting axes to mirror, such as
+// "x" or "xz".
+func ParseNormalizeOptions(mode, axes, flip string) (NormalizeOptions, error) {
+	var opts NormalizeOptions
+
+	switch mode {
+	case "per-axis":
+		opts.Mode = NormalizePerAxis
+	case "uniform":
+		opts.Mode = NormalizeUniform
+	default:
+		return opts, fmt.Errorf("unknown normalize mode %q, expected per-axis or uniform", mode)
+	}
+
+	if len(axes) != 3 {
+		return opts, fmt.Errorf("axes %q must be a permutation of xyz", axes)
+	}
+	seen := make(map[rune]bool)
+	for i, c := range strings.ToLower(axes) {
+		if seen[c] || !strings.ContainsRune("xyz", c) {
+			return opts, fmt.Errorf("axes %q must be a permutation of xyz", axes)
+		}
+		seen[c] = true
+		opts.Axes[i] = Axis(c - 'x')
+	}
+
+	for _, c := range strings.ToLower(flip) {
+		if !strings.ContainsRune("xyz", c) {
+			return opts, fmt.Errorf("flip %q may only contain x, y and z", flip)
+		}
+		opts.Flip[c-'x'] = true
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,301 @@
+package ledsim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fogleman/ease"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// ParamKind is the type of an effect parameter. Each kind has one Go type
+// that values are passed to SetParam as.
+type ParamKind string
+
+const (
+	ParamFloat    ParamKind = "float"    // float64
+	ParamInt      ParamKind = "int"      // int
+	ParamDuration ParamKind = "duration" // time.Duration
+	ParamColour   ParamKind = "colour"   // colorful.Color
+	ParamPalette  ParamKind = "palette"  // []colorful.Color
+	ParamEasing   ParamKind = "easing"   // string, a key of Easings
+	ParamLED      ParamKind = "led"      // *LED
+)
+
+// Param describes one parameter of an effect.
+type Param struct {
+	Name        string
+	Kind        ParamKind
+	Description string
+	// Min and Max bound float, int and duration (in seconds) params. They
+	// are ignored if equal.
+	Min, Max float64
+	Default  interface{}
+}
+
+// Parameterized is implemented by effects that describe their parameters,
+// so they can be discovered and set without knowing the effect's type.
+type Parameterized interface {
+	Params() []Param
+	// SetParam sets the named parameter, value must be of the Go type of
+	// the parameter's kind.
+	SetParam(name string, value interface{}) error
+}
+
+// ErrUnknownParam is returned when setting a parameter an effect doesn't
+// have.
+var ErrUnknownParam = errors.New("unknown parameter")
+
+// Easings are the easing functions that easing parameters can name.
+var Easings = map[string]func(t float64) float64{
+	"linear":       ease.Linear,
+	"in-quad":      ease.InQuad,
+	"out-quad":     ease.OutQuad,
+	"in-out-quad":  ease.InOutQuad,
+	"in-cubic":     ease.InCubic,
+	"out-cubic":    ease.OutCubic,
+	"in-out-cubic": ease.InOutCubic,
+	"in-sine":      ease.InSine,
+	"out-sine":     ease.OutSine,
+	"in-out-sine":  ease.InOutSine,
+	"in-expo":      ease.InExpo,
+	"out-expo":     ease.OutExpo,
+	"in-out-expo":  ease.InOutExpo,
+}
+
+// Easing returns the easing function with the given name.
+func Easing(name string) (func(t float64) float64, error) {
+	f, found := Easings[name]
+	if !found {
+		return nil, fmt.Errorf("unknown easing %q", name)
+	}
+	return f, nil
+}
+
+func (p Param) bounded() bool {
+	return p.Min != p.Max
+}
+
+func (p Param) checkRange(v float64) error {
+	if p.bounded() && (v < p.Min || v > p.Max) {
+		return fmt.Errorf("%s must be between %v and %v, got %v", p.Name, p.Min, p.Max, v)
+	}
+	return nil
+}
+
+// Check reports whether value is of the right type for p and within its
+// range.
+func (p Param) Check(value interface{}) error {
+	var ok bool
+	switch p.Kind {
+	case ParamFloat:
+		var v float64
+		if v, ok = value.(float64); ok {
+			return p.checkRange(v)
+		}
+	case ParamInt:
+		var v int
+		if v, ok = value.(int); ok {
+			return p.checkRange(float64(v))
+		}
+	case ParamDuration:
+		var v time.Duration
+		if v, ok = value.(time.Duration); ok {
+			return p.checkRange(v.Seconds())
+		}
+	case ParamColour:
+		_, ok = value.(colorful.Color)
+	case ParamPalette:
+		var v []colorful.Color
+		if v, ok = value.([]colorful.Color); ok && len(v) == 0 {
+			return fmt.Errorf("%s must have at least one colour", p.Name)
+		}
+	case ParamEasing:
+		var v string
+		if v, ok = value.(string); ok {
+			_, err := Easing(v)
+			return err
+		}
+	case ParamLED:
+		var v *LED
+		if v, ok = value.(*LED); ok && v == nil {
+			return fmt.Errorf("%s must be an led", p.Name)
+		}
+	default:
+		return fmt.Errorf("%s has unknown kind %q", p.Name, p.Kind)
+	}
+
+	if !ok {
+		return fmt.Errorf("%s is a %s parameter, got %T", p.Name, p.Kind, value)
+	}
+	return nil
+}
+
+// Decode parses a JSON value for p: numbers for float and int, a number of
+// seconds or a string such as "1.5s" for durations, "#rrggbb" for colours, a
+// list of those for palettes, an easing name, or an LED ID resolved in sys.
+func (p Param) Decode(raw json.RawMessage, sys *System) (interface{}, error) {
+	var value interface{}
+	var err error
+
+	switch p.Kind {
+	case ParamFloat:
+		var v float64
+		err = json.Unmarshal(raw, &v)
+		value = v
+	case ParamInt:
+		var v int
+		err = json.Unmarshal(raw, &v)
+		value = v
+	case ParamDuration:
+		var seconds float64
+		if err = json.Unmarshal(raw, &seconds); err == nil {
+			value = time.Duration(seconds * float64(time.Second))
+			break
+		}
+
+		var s string
+		if err = json.Unmarshal(raw, &s); err == nil {
+			value, err = time.ParseDuration(s)
+		}
+	case ParamColour:
+		var s string
+		if err = json.Unmarshal(raw, &s); err == nil {
+			value, err = colorful.Hex(s)
+		}
+	case ParamPalette:
+		var hexes []string
+		if err = json.Unmarshal(raw, &hexes); err == nil {
+			palette := make([]colorful.Color, len(hexes))
+			for i, s := range hexes {
+				if palette[i], err = colorful.Hex(s); err != nil {
+					break
+				}
+			}
+			value = palette
+		}
+	case ParamEasing:
+		var s string
+		err = json.Unmarshal(raw, &s)
+		value = s
+	case ParamLED:
+		var id int
+		if err = json.Unmarshal(raw, &id); err == nil {
+			if id < 0 || id >= len(sys.LEDs) {
+				err = fmt.Errorf("led %d does not exist", id)
+			} else {
+				value = sys.LEDs[id]
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name, err)
+	}
+
+	if err := p.Check(value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Encode returns value in the form Decode accepts, for JSON.
+func (p Param) Encode(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case colorful.Color:
+		return v.Clamped().Hex()
+	case []colorful.Color:
+		hexes := make([]string, len(v))
+		for i, c := range v {
+			hexes[i] = c.Clamped().Hex()
+		}
+		return hexes
+	case *LED:
+		if v == nil {
+			return nil
+		}
+		return v.ID
+	default:
+		return value
+	}
+}
+
+func (p Param) MarshalJSON() ([]byte, error) {
+	type param struct {
+		Name        string      `json:"name"`
+		Kind        ParamKind   `json:"kind"`
+		Description string      `json:"description,omitempty"`
+		Min         *float64    `json:"min,omitempty"`
+		Max         *float64    `json:"max,omitempty"`
+		Default     interface{} `json:"default,omitempty"`
+		Options     []string    `json:"options,omitempty"`
+	}
+
+	out := param{
+		Name:        p.Name,
+		Kind:        p.Kind,
+		Description: p.Description,
+		Default:     p.Encode(p.Default),
+	}
+	if p.bounded() {
+		out.Min, out.Max = &p.Min, &p.Max
+	}
+	if p.Kind == ParamEasing {
+		for name := range Easings {
+			out.Options = append(out.Options, name)
+		}
+		sort.Strings(out.Options)
+	}
+
+	return json.Marshal(out)
+}
+
+// CheckParam finds the parameter called name in params and checks value
+// against it, for use at the top of SetParam implementations.
+func CheckParam(params []Param, name string, value interface{}) error {
+	for _, p := range params {
+		if p.Name == name {
+			return p.Check(value)
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownParam, name)
+}
+
+// SetParams decodes each raw value with the matching parameter of effect
+// and sets it.
+func SetParams(effect Parameterized, raw map[string]json.RawMessage, sys *System) error {
+	params := make(map[string]Param)
+	for _, p := range effect.Params() {
+		params[p.Name] = p
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, found := params[name]
+		if !found {
+			return fmt.Errorf("%w %q", ErrUnknownParam, name)
+		}
+
+		value, err := p.Decode(raw[name], sys)
+		if err != nil {
+			return err
+		}
+
+		if err := effect.SetParam(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
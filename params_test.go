@@ -0,0 +1,173 @@
+package ledsim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestParamDecode(t *testing.T) {
+	sys := pairSystem()
+	float := Param{Name: "x", Kind: ParamFloat, Min: 0, Max: 1}
+	integer := Param{Name: "n", Kind: ParamInt, Min: 1, Max: 10}
+	duration := Param{Name: "d", Kind: ParamDuration, Max: 60}
+	colour := Param{Name: "c", Kind: ParamColour}
+	palette := Param{Name: "p", Kind: ParamPalette}
+	easing := Param{Name: "e", Kind: ParamEasing}
+	led := Param{Name: "start", Kind: ParamLED}
+
+	tests := []struct {
+		name  string
+		param Param
+		raw   string
+		want  interface{}
+		// err is part of the error expected, or empty for none
+		err string
+	}{
+		{name: "float", param: float, raw: "0.25", want: 0.25},
+		{name: "float out of range", param: float, raw: "2", err: "x must be between 0 and 1, got 2"},
+		{name: "float not a number", param: float, raw: `"half"`, err: "x:"},
+		{name: "int", param: integer, raw: "3", want: 3},
+		{name: "int with a fraction", param: integer, raw: "1.5", err: "n:"},
+		{name: "int out of range", param: integer, raw: "0", err: "n must be between 1 and 10, got 0"},
+		{name: "duration in seconds", param: duration, raw: "1.5", want: 1500 * time.Millisecond},
+		{name: "duration as a string", param: duration, raw: `"45s"`, want: 45 * time.Second},
+		{name: "duration that isn't one", param: duration, raw: `"soon"`, err: "d:"},
+		{name: "duration out of range", param: duration, raw: `"2m"`, err: "d must be between 0 and 60, got 120"},
+		{name: "unbounded", param: Param{Name: "d", Kind: ParamDuration}, raw: "600", want: 10 * time.Minute},
+		{name: "colour", param: colour, raw: `"#ff0000"`, want: colorful.Color{R: 1}},
+		{name: "colour by name", param: colour, raw: `"red"`, err: "c:"},
+		{name: "palette", param: palette, raw: `["#ff0000", "#0000ff"]`,
+			want: []colorful.Color{{R: 1}, {B: 1}}},
+		{name: "empty palette", param: palette, raw: `[]`, err: "p must have at least one colour"},
+		{name: "palette with a bad colour", param: palette, raw: `["#ff0000", "blue"]`, err: "p:"},
+		{name: "easing", param: easing, raw: `"in-out-sine"`, want: "in-out-sine"},
+		{name: "unknown easing", param: easing, raw: `"wobbly"`, err: `unknown easing "wobbly"`},
+		{name: "led", param: led, raw: "1", want: sys.LEDs[1]},
+		{name: "led past the end", param: led, raw: "2", err: "start: led 2 does not exist"},
+		{name: "negative led", param: led, raw: "-1", err: "start: led -1 does not exist"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.param.Decode(json.RawMessage(test.raw), sys)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("Decode(%s) error = %v, want nil", test.raw, err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("Decode(%s) error = %v, want it to contain %q", test.raw, err, test.err)
+			case test.err == "" && !reflect.DeepEqual(got, test.want):
+				t.Fatalf("Decode(%s) = %#v, want %#v", test.raw, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParamCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		param Param
+		value interface{}
+		err   string
+	}{
+		{name: "float", param: Param{Name: "x", Kind: ParamFloat}, value: 1.5},
+		{name: "wrong type", param: Param{Name: "x", Kind: ParamFloat}, value: 1, err: "x is a float parameter, got int"},
+		{name: "duration range in seconds", param: Param{Name: "d", Kind: ParamDuration, Min: 1, Max: 2},
+			value: 500 * time.Millisecond, err: "d must be between 1 and 2, got 0.5"},
+		{name: "nil led", param: Param{Name: "start", Kind: ParamLED}, value: (*LED)(nil), err: "start must be an led"},
+		{name: "unknown kind", param: Param{Name: "v", Kind: "vector"}, value: 1, err: `v has unknown kind "vector"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.param.Check(test.value)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("Check(%v) = %v, want nil", test.value, err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("Check(%v) = %v, want it to contain %q", test.value, err, test.err)
+			}
+		})
+	}
+}
+
+// paramEffect records the parameters set on it.
+type paramEffect struct {
+	values map[string]interface{}
+}
+
+func (e *paramEffect) Params() []Param {
+	return []Param{
+		{Name: "speed", Kind: ParamFloat, Max: 10},
+		{Name: "colour", Kind: ParamColour},
+	}
+}
+
+func (e *paramEffect) SetParam(name string, value interface{}) error {
+	if err := CheckParam(e.Params(), name, value); err != nil {
+		return err
+	}
+	e.values[name] = value
+	return nil
+}
+
+func TestSetParams(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]json.RawMessage
+		want map[string]interface{}
+		// err is part of the error expected, or empty for none
+		err string
+		// unknown is whether the error should be ErrUnknownParam
+		unknown bool
+	}{
+		{
+			name: "all",
+			raw:  map[string]json.RawMessage{"speed": json.RawMessage("2"), "colour": json.RawMessage(`"#0000ff"`)},
+			want: map[string]interface{}{"speed": 2.0, "colour": colorful.Color{B: 1}},
+		},
+		{
+			name: "none",
+			raw:  map[string]json.RawMessage{},
+			want: map[string]interface{}{},
+		},
+		{
+			name:    "unknown",
+			raw:     map[string]json.RawMessage{"size": json.RawMessage("2")},
+			err:     `unknown parameter "size"`,
+			unknown: true,
+		},
+		{
+			name: "out of range",
+			raw:  map[string]json.RawMessage{"speed": json.RawMessage("20")},
+			err:  "speed must be between 0 and 10, got 20",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			effect := &paramEffect{values: make(map[string]interface{})}
+			err := SetParams(effect, test.raw, nil)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("SetParams() = %v, want nil", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("SetParams() = %v, want it to contain %q", err, test.err)
+			case errors.Is(err, ErrUnknownParam) != test.unknown:
+				t.Fatalf("SetParams() = %v, ErrUnknownParam %v, want %v", err, !test.unknown, test.unknown)
+			case test.err == "" && !reflect.DeepEqual(effect.values, test.want):
+				t.Fatalf("SetParams() set %v, want %v", effect.values, test.want)
+			}
+		})
+	}
+
+	// CheckParam is what SetParam implementations reject unknown names with
+	if err := (&paramEffect{}).SetParam("size", 2.0); !errors.Is(err, ErrUnknownParam) {
+		t.Errorf("SetParam(size) = %v, want ErrUnknownParam", err)
+	}
+}
@@ -0,0 +1,59 @@
+package ledsim
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+)
+
+// Randomized is implemented by effects that use randomness. Before each
+// OnEnter the manager calls SetRand with a generator seeded from the show
+// seed and the keyframe, so a show renders the same way every time.
+type Randomized interface {
+	SetRand(rng *rand.Rand)
+}
+
+// SeedEffect passes rng to effect if it is Randomized. It takes any value so
+// BlendableEffects and Masks can be seeded too.
+func SeedEffect(effect interface{}, rng *rand.Rand) {
+	if r, ok := effect.(Randomized); ok {
+		r.SetRand(rng)
+	}
+}
+
+// seedEach gives each effect its own generator split off rng, so that what
+// one effect draws doesn't change what the others get.
+func seedEach(rng *rand.Rand, effects ...interface{}) {
+	for _, effect := range effects {
+		SeedEffect(effect, rand.New(rand.NewSource(rng.Int63())))
+	}
+}
+
+// KeyframeSeed derives the seed of keyframe's generator from the show seed
+// and the keyframe's label, timing, layer and target.
+func KeyframeSeed(seed int64, keyframe *Keyframe) int64 {
+	h := fnv.New64a()
+
+	var buf [8]byte
+	for _, n := range []int64{seed, int64(keyframe.Offset), int64(keyframe.Duration), int64(keyframe.Layer)} {
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		h.Write(buf[:])
+	}
+	h.Write([]byte(keyframe.Label))
+	h.Write([]byte{0})
+	h.Write([]byte(keyframe.Target))
+
+	return int64(h.Sum64())
+}
+
+// keyframeRand returns a new generator for keyframe, the same every time it
+// is entered.
+func (r *EffectsManager) keyframeRand(keyframe *Keyframe) *rand.Rand {
+	return rand.New(rand.NewSource(KeyframeSeed(r.seed, keyframe)))
+}
+
+// SetSeed sets the show seed that every keyframe's generator is derived
+// from. It takes effect the next time each keyframe is entered.
+func (r *EffectsManager) SetSeed(seed int64) {
+	r.seed = seed
+}
@@ -0,0 +1,141 @@
+package ledsim
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// randomEffect paints each LED a colour drawn from its generator on entry.
+type randomEffect struct {
+	rng     *rand.Rand
+	colours []colorful.Color
+}
+
+func (e *randomEffect) SetRand(rng *rand.Rand) { e.rng = rng }
+
+func (e *randomEffect) OnEnter(system *System) {
+	e.colours = make([]colorful.Color, system.IDCount())
+	for _, led := range system.LEDs {
+		e.colours[led.ID] = colorful.Color{R: e.rng.Float64(), G: e.rng.Float64(), B: e.rng.Float64()}
+	}
+}
+
+func (e *randomEffect) Eval(progress float64, system *System) {
+	for _, led := range system.LEDs {
+		led.Color = e.colours[led.ID]
+	}
+}
+
+func (e *randomEffect) OnExit(system *System) {}
+
+func colours(system *System) []colorful.Color {
+	result := make([]colorful.Color, len(system.LEDs))
+	for i, led := range system.LEDs {
+		result[i] = led.Color
+	}
+	return result
+}
+
+func sameColours(a, b []colorful.Color) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestKeyframeSeed(t *testing.T) {
+	base := Keyframe{Label: "sparkle", Offset: time.Second, Duration: time.Minute, Layer: 1, Target: "first"}
+	want := KeyframeSeed(1, &base)
+
+	if again := base; KeyframeSeed(1, &again) != want {
+		t.Error("the same keyframe got a different seed")
+	}
+	if KeyframeSeed(2, &base) == want {
+		t.Error("another show seed gave the same keyframe seed")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(k *Keyframe)
+	}{
+		{"label", func(k *Keyframe) { k.Label = "snake" }},
+		{"offset", func(k *Keyframe) { k.Offset = 2 * time.Second }},
+		{"duration", func(k *Keyframe) { k.Duration = time.Hour }},
+		{"layer", func(k *Keyframe) { k.Layer = 2 }},
+		{"target", func(k *Keyframe) { k.Target = "second" }},
+		// the label and target are separated, so moving a character
+		// between them changes the seed
+		{"label and target", func(k *Keyframe) { k.Label, k.Target = "sparklef", "irst" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyframe := base
+			test.modify(&keyframe)
+			if KeyframeSeed(1, &keyframe) == want {
+				t.Errorf("changing the %s kept the seed", test.name)
+			}
+		})
+	}
+}
+
+// renderSeeded renders the first frame of a show of two random keyframes,
+// one of them running two random effects in parallel.
+func renderSeeded(seed int64) []colorful.Color {
+	system := NewSystem()
+	for i := 0; i < 10; i++ {
+		system.AddLED(&LED{X: float64(i)})
+	}
+	system.SetGroup(&Group{Name: "left", IDs: []int{0, 1, 2, 3, 4}})
+	system.SetGroup(&Group{Name: "right", IDs: []int{5, 6, 7, 8, 9}})
+
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "left", Duration: time.Second, Target: "left", Effect: &randomEffect{}},
+		{Label: "right", Duration: time.Second, Target: "right",
+			Effect: Parallel(&randomEffect{}, &randomEffect{})},
+	})
+	manager.SetSeed(seed)
+	manager.Evaluate(system, 0)
+
+	return colours(system)
+}
+
+func TestManagerSeedsKeyframes(t *testing.T) {
+	first := renderSeeded(1)
+	if again := renderSeeded(1); !sameColours(first, again) {
+		t.Errorf("the same seed rendered %v, then %v", first, again)
+	}
+	if other := renderSeeded(2); sameColours(first, other) {
+		t.Errorf("seeds 1 and 2 both rendered %v", first)
+	}
+}
+
+func TestManagerReseedsOnEnter(t *testing.T) {
+	system := pairSystem()
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "a", Duration: time.Second, Effect: &randomEffect{}},
+		{Label: "b", Offset: time.Second, Duration: time.Second, Effect: &randomEffect{}},
+	})
+	manager.SetSeed(1)
+
+	manager.Evaluate(system, 500*time.Millisecond)
+	a := colours(system)
+	manager.Evaluate(system, 1500*time.Millisecond)
+	if b := colours(system); sameColours(a, b) {
+		t.Errorf("keyframes a and b both rendered %v", a)
+	}
+
+	// the show loops, so a is entered again and should draw the same
+	manager.Evaluate(system, 2250*time.Millisecond)
+	if again := colours(system); !sameColours(a, again) {
+		t.Errorf("a rendered %v, then %v when it was entered again", a, again)
+	}
+}
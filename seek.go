@@ -0,0 +1,43 @@
+package ledsim
+
+// Seekable is implemented by effects whose state builds up as they play, such
+// as anything that walks the sculpture. Seek rebuilds that state for an
+// arbitrary progress, so that Eval at that progress looks the same as it
+// would have if the effect had played straight through to it.
+//
+// The manager seeks running keyframes when the show time jumps, and
+// wrappers seek the effects they wrap when the progress they feed them goes
+// backwards, such as in Reverse or at the start of each repetition.
+type Seekable interface {
+	Seek(progress float64, system *System)
+}
+
+// SeekEffect seeks effect to progress if it is Seekable. It takes any value
+// so BlendableEffects and BufferEffects can be seeked too.
+func SeekEffect(effect interface{}, progress float64, system *System) {
+	if s, ok := effect.(Seekable); ok {
+		s.Seek(progress, system)
+	}
+}
+
+// seekFollower passes progress on to an effect, seeking the effect first
+// whenever progress goes backwards.
+type seekFollower struct {
+	last float64
+}
+
+func (f *seekFollower) reset() {
+	f.last = 0
+}
+
+func (f *seekFollower) follow(effect Effect, progress float64, system *System) {
+	if progress < f.last {
+		SeekEffect(effect, progress, system)
+	}
+	f.last = progress
+}
+
+func (f *seekFollower) seek(effect Effect, progress float64, system *System) {
+	SeekEffect(effect, progress, system)
+	f.last = progress
+}
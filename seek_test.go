@@ -0,0 +1,142 @@
+package ledsim
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// seekRecorder records the progress it's seeked to.
+type seekRecorder struct {
+	seeks []float64
+}
+
+func (e *seekRecorder) OnEnter(system *System)                {}
+func (e *seekRecorder) Eval(progress float64, system *System) {}
+func (e *seekRecorder) OnExit(system *System)                 {}
+func (e *seekRecorder) Seek(progress float64, system *System) {
+	e.seeks = append(e.seeks, progress)
+}
+
+func closeFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWrappersSeek(t *testing.T) {
+	tests := []struct {
+		name     string
+		wrap     func(effect Effect) Effect
+		progress []float64
+		// seek is where the wrapper is seeked to after the frames at
+		// progress, or -1 for nowhere
+		seek float64
+		want []float64
+	}{
+		{
+			name: "playing forwards",
+			wrap: func(effect Effect) Effect {
+				return WrappedEffect{effect}.WithEasing(func(t float64) float64 { return t })
+			},
+			progress: []float64{0, 0.25, 0.5},
+			seek:     -1,
+		},
+		{
+			name:     "reverse goes back every frame",
+			wrap:     func(effect Effect) Effect { return WrappedEffect{effect}.Reverse() },
+			progress: []float64{0.25, 0.5, 0.75},
+			seek:     -1,
+			want:     []float64{0.5, 0.25},
+		},
+		{
+			name:     "each repetition starts again",
+			wrap:     func(effect Effect) Effect { return WrappedEffect{effect}.WithRepetition(2) },
+			progress: []float64{0.25, 0.4, 0.6, 0.9},
+			seek:     -1,
+			want:     []float64{0.2},
+		},
+		{
+			name:     "seeking a repetition",
+			wrap:     func(effect Effect) Effect { return WrappedEffect{effect}.WithRepetition(4) },
+			progress: []float64{0.1},
+			seek:     0.6,
+			want:     []float64{0.4},
+		},
+		{
+			name:     "seeking a sequence",
+			wrap:     func(effect Effect) Effect { return Sequence(Step(1, &solidEffect{}), Step(3, effect)) },
+			progress: []float64{0.1},
+			seek:     0.625,
+			want:     []float64{0.5},
+		},
+		{
+			name: "seeking in parallel",
+			wrap: func(effect Effect) Effect { return Parallel(&solidEffect{}, effect) },
+			seek: 0.3,
+			want: []float64{0.3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &seekRecorder{}
+			effect := test.wrap(recorder)
+			system := pairSystem()
+			effect.OnEnter(system)
+			for _, progress := range test.progress {
+				effect.Eval(progress, system)
+			}
+			if test.seek >= 0 {
+				SeekEffect(effect, test.seek, system)
+			}
+
+			if !closeFloats(recorder.seeks, test.want) {
+				t.Errorf("seeked to %v, want %v", recorder.seeks, test.want)
+			}
+		})
+	}
+}
+
+func TestManagerSeeksOnJumps(t *testing.T) {
+	recorder := &seekRecorder{}
+	manager := NewEffectsManager([]*Keyframe{
+		{Label: "a", Duration: 10 * time.Second, Effect: recorder},
+	})
+	system := pairSystem()
+
+	steps := []struct {
+		delta time.Duration
+		// seek is the progress the keyframe should be seeked to, or -1
+		seek float64
+	}{
+		{0, -1},
+		{40 * time.Millisecond, -1},
+		{800 * time.Millisecond, -1},
+		// further than seekThreshold
+		{5 * time.Second, 0.5},
+		{5040 * time.Millisecond, -1},
+		// any step back
+		{5 * time.Second, 0.5},
+		{2 * time.Second, 0.2},
+	}
+
+	for _, step := range steps {
+		recorder.seeks = nil
+		manager.Evaluate(system, step.delta)
+
+		var want []float64
+		if step.seek >= 0 {
+			want = []float64{step.seek}
+		}
+		if !closeFloats(recorder.seeks, want) {
+			t.Errorf("at %v seeked to %v, want %v", step.delta, recorder.seeks, want)
+		}
+	}
+}
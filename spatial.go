@@ -0,0 +1,193 @@
+package ledsim
+
+import (
+	"math"
+	"sort"
+)
+
+// SpatialIndex is a k-d tree over LED positions. It is built once per layout
+// and is cheap enough to query from Eval on every frame.
+type SpatialIndex struct {
+	root *kdNode
+	size int
+}
+
+type kdNode struct {
+	led         *LED
+	axis        int
+	left, right *kdNode
+}
+
+func coordOf(led *LED, axis int) float64 {
+	switch axis {
+	case 0:
+		return led.X
+	case 1:
+		return led.Y
+	default:
+		return led.Z
+	}
+}
+
+func squaredDistance(led *LED, x, y, z float64) float64 {
+	dx, dy, dz := led.X-x, led.Y-y, led.Z-z
+	return dx*dx + dy*dy + dz*dz
+}
+
+// NewSpatialIndex builds an index over the current positions of leds. The
+// index must be rebuilt if the LEDs move.
+func NewSpatialIndex(leds []*LED) *SpatialIndex {
+	points := append([]*LED{}, leds...)
+	return &SpatialIndex{
+		root: buildKdTree(points, 0),
+		size: len(points),
+	}
+}
+
+func buildKdTree(points []*LED, depth int) *kdNode {
+	if len(points) == 0 {
+		return nil
+	}
+
+	axis := depth % 3
+	sort.Slice(points, func(i, j int) bool {
+		return coordOf(points[i], axis) < coordOf(points[j], axis)
+	})
+
+	mid := len(points) / 2
+	return &kdNode{
+		led:   points[mid],
+		axis:  axis,
+		left:  buildKdTree(points[:mid], depth+1),
+		right: buildKdTree(points[mid+1:], depth+1),
+	}
+}
+
+// Len returns the number of LEDs in the index.
+func (s *SpatialIndex) Len() int {
+	return s.size
+}
+
+// Nearest returns the LED closest to (x, y, z), or nil if the index is empty.
+func (s *SpatialIndex) Nearest(x, y, z float64) *LED {
+	nearest := s.KNearest(x, y, z, 1)
+	if len(nearest) == 0 {
+		return nil
+	}
+	return nearest[0]
+}
+
+type knnCandidate struct {
+	led  *LED
+	dist float64
+}
+
+// KNearest returns up to k LEDs closest to (x, y, z), nearest first.
+func (s *SpatialIndex) KNearest(x, y, z float64, k int) []*LED {
+	if k <= 0 {
+		return nil
+	}
+
+	// best is kept sorted by distance, it is small so insertion is cheap
+	best := make([]knnCandidate, 0, k)
+	target := [3]float64{x, y, z}
+
+	var search func(n *kdNode)
+	search = func(n *kdNode) {
+		if n == nil {
+			return
+		}
+
+		dist := squaredDistance(n.led, x, y, z)
+		if len(best) < k || dist < best[len(best)-1].dist {
+			i := sort.Search(len(best), func(i int) bool {
+				return best[i].dist > dist
+			})
+			if len(best) < k {
+				best = append(best, knnCandidate{})
+			}
+			copy(best[i+1:], best[i:])
+			best[i] = knnCandidate{n.led, dist}
+		}
+
+		diff := target[n.axis] - coordOf(n.led, n.axis)
+		near, far := n.left, n.right
+		if diff > 0 {
+			near, far = n.right, n.left
+		}
+
+		search(near)
+		if len(best) < k || diff*diff < best[len(best)-1].dist {
+			search(far)
+		}
+	}
+	search(s.root)
+
+	result := make([]*LED, len(best))
+	for i, candidate := range best {
+		result[i] = candidate.led
+	}
+	return result
+}
+
+// WithinRadius returns every LED within r of (x, y, z), in no particular
+// order.
+func (s *SpatialIndex) WithinRadius(x, y, z, r float64) []*LED {
+	var result []*LED
+	target := [3]float64{x, y, z}
+	r2 := r * r
+
+	var search func(n *kdNode)
+	search = func(n *kdNode) {
+		if n == nil {
+			return
+		}
+
+		if squaredDistance(n.led, x, y, z) <= r2 {
+			result = append(result, n.led)
+		}
+
+		diff := target[n.axis] - coordOf(n.led, n.axis)
+		if diff <= r {
+			search(n.left)
+		}
+		if diff >= -r {
+			search(n.right)
+		}
+	}
+	search(s.root)
+
+	return result
+}
+
+// WithinBox returns every LED inside the axis aligned box spanning min to
+// max (inclusive), in no particular order.
+func (s *SpatialIndex) WithinBox(minX, minY, minZ, maxX, maxY, maxZ float64) []*LED {
+	var result []*LED
+	lo := [3]float64{math.Min(minX, maxX), math.Min(minY, maxY), math.Min(minZ, maxZ)}
+	hi := [3]float64{math.Max(minX, maxX), math.Max(minY, maxY), math.Max(minZ, maxZ)}
+
+	var search func(n *kdNode)
+	search = func(n *kdNode) {
+		if n == nil {
+			return
+		}
+
+		if n.led.X >= lo[0] && n.led.X <= hi[0] &&
+			n.led.Y >= lo[1] && n.led.Y <= hi[1] &&
+			n.led.Z >= lo[2] && n.led.Z <= hi[2] {
+			result = append(result, n.led)
+		}
+
+		v := coordOf(n.led, n.axis)
+		if lo[n.axis] <= v {
+			search(n.left)
+		}
+		if hi[n.axis] >= v {
+			search(n.right)
+		}
+	}
+	search(s.root)
+
+	return result
+}
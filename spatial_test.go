@@ -0,0 +1,113 @@
+package ledsim
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomLEDs(rng *rand.Rand, n int, grid bool) []*LED {
+	leds := make([]*LED, n)
+	for i := range leds {
+		led := &LED{ID: i, X: rng.Float64(), Y: rng.Float64(), Z: rng.Float64()}
+		if grid {
+			// coarse coordinates, so many LEDs share a coordinate or a
+			// whole position
+			led.X, led.Y, led.Z = float64(rng.Intn(4))/4, float64(rng.Intn(4))/4, float64(rng.Intn(4))/4
+		}
+		leds[i] = led
+	}
+	return leds
+}
+
+// ids returns the sorted IDs of leds, for comparing results given in no
+// particular order.
+func ids(leds []*LED) []int {
+	result := make([]int, len(leds))
+	for i, led := range leds {
+		result[i] = led.ID
+	}
+	sort.Ints(result)
+	return result
+}
+
+func TestSpatialIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		grid bool
+	}{
+		{"empty", 0, false},
+		{"one", 1, false},
+		{"random", 500, false},
+		{"shared coordinates", 300, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			leds := randomLEDs(rng, test.n, test.grid)
+			index := NewSpatialIndex(leds)
+
+			if index.Len() != len(leds) {
+				t.Fatalf("Len() = %d, want %d", index.Len(), len(leds))
+			}
+
+			for q := 0; q < 200; q++ {
+				x, y, z := rng.Float64()*1.2-0.1, rng.Float64()*1.2-0.1, rng.Float64()*1.2-0.1
+
+				// ties make the nearest LED ambiguous, so compare distances
+				byDistance := append([]*LED(nil), leds...)
+				sort.SliceStable(byDistance, func(i, j int) bool {
+					return squaredDistance(byDistance[i], x, y, z) < squaredDistance(byDistance[j], x, y, z)
+				})
+
+				nearest := index.Nearest(x, y, z)
+				switch {
+				case len(leds) == 0 && nearest != nil:
+					t.Fatalf("Nearest on an empty index = %v, want nil", nearest)
+				case len(leds) > 0 && (nearest == nil ||
+					squaredDistance(nearest, x, y, z) != squaredDistance(byDistance[0], x, y, z)):
+					t.Fatalf("Nearest(%v, %v, %v) = %v, want %v", x, y, z, nearest, byDistance[0])
+				}
+
+				k := rng.Intn(10) + 1
+				knn := index.KNearest(x, y, z, k)
+				want := byDistance
+				if len(want) > k {
+					want = want[:k]
+				}
+				if len(knn) != len(want) {
+					t.Fatalf("KNearest(k=%d) returned %d leds, want %d", k, len(knn), len(want))
+				}
+				for i := range knn {
+					if squaredDistance(knn[i], x, y, z) != squaredDistance(want[i], x, y, z) {
+						t.Fatalf("KNearest(k=%d)[%d] is at the wrong distance", k, i)
+					}
+				}
+
+				r := rng.Float64() * 0.4
+				var within []*LED
+				for _, led := range leds {
+					if squaredDistance(led, x, y, z) <= r*r {
+						within = append(within, led)
+					}
+				}
+				if got := ids(index.WithinRadius(x, y, z, r)); !sameInts(got, ids(within)) {
+					t.Fatalf("WithinRadius(%v, %v, %v, %v) = %v, want %v", x, y, z, r, got, ids(within))
+				}
+
+				maxX, maxY, maxZ := x+rng.Float64()*0.5, y+rng.Float64()*0.5, z+rng.Float64()*0.5
+				var inBox []*LED
+				for _, led := range leds {
+					if led.X >= x && led.X <= maxX && led.Y >= y && led.Y <= maxY && led.Z >= z && led.Z <= maxZ {
+						inBox = append(inBox, led)
+					}
+				}
+				if got := ids(index.WithinBox(x, y, z, maxX, maxY, maxZ)); !sameInts(got, ids(inBox)) {
+					t.Fatalf("WithinBox = %v, want %v", got, ids(inBox))
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package ledsim
 
 import (
 	_ "embed"
-	"sync"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
@@ -14,10 +13,31 @@ type System struct {
 	LEDs    []*LED
 	Teensys map[string]*Teensy
 
-	XStats        *Stats
-	YStats        *Stats
-	ZStats        *Stats
-	normalizeOnce *sync.Once
+	// Normalization is used by Normalize to map physical coordinates onto
+	// X, Y and Z.
+	Normalization NormalizeOptions
+
+	// Stats of the remapped physical coordinates that became X, Y and Z.
+	XStats *Stats
+	YStats *Stats
+	ZStats *Stats
+
+	// Spatial indexes the normalised LED positions, it is rebuilt by
+	// Normalize.
+	Spatial *SpatialIndex
+
+	// Groups are the named LED groups keyframes can target, see View.
+	Groups map[string]*Group
+
+	// cached graph analysis, see topology.go
+	topo *topology
+
+	// views over each group, see groups.go
+	views map[string]*System
+	// parent is the full system and members the LEDs of it in this one,
+	// indexed by ID, if this is a view
+	parent  *System
+	members []bool
 }
 
 type PhysicalLEDPosition struct {
@@ -34,9 +54,18 @@ type RGBOutput struct {
 
 type LED struct {
 	ID int
-	X  float64
-	Y  float64
-	Z  float64
+	// X, Y and Z are the normalised coordinates effects work in, see
+	// System.Normalize.
+	X float64
+	Y float64
+	Z float64
+	// Physical is the position as given by the layout, in layout units.
+	Physical Vec3
+	// Direction is the unit vector the LED faces, in the same normalised
+	// space as X, Y and Z. It is the zero vector if the layout doesn't say.
+	Direction Vec3
+	// PhysicalDirection is the unit facing as given by the layout.
+	PhysicalDirection Vec3
 	PhysicalLEDPosition
 	RGBOutput
 	RawLine string
@@ -70,12 +99,18 @@ func (m MiddlewareFunc) Execute(system *System, next func() error) error {
 
 func NewSystem() *System {
 	return &System{
-		normalizeOnce: new(sync.Once),
+		Normalization: DefaultNormalizeOptions,
+		topo:          &topology{},
 	}
 }
 
+// AddLED adds led to the system, recording its X, Y, Z and Direction as its
+// physical position and facing.
 func (s *System) AddLED(led *LED) {
 	led.ID = len(s.LEDs)
+	led.Physical = Vec3{X: led.X, Y: led.Y, Z: led.Z}
+	led.Direction = led.Direction.Unit()
+	led.PhysicalDirection = led.Direction
 	s.LEDs = append(s.LEDs, led)
 }
 
@@ -85,9 +120,20 @@ type Stats struct {
 }
 
 func (s *Stats) Convert(val float64) float64 {
+	if s.Max == s.Min {
+		return 0.5
+	}
 	return (val - s.Min) / (s.Max - s.Min)
 }
 
+func (s *Stats) Range() float64 {
+	return s.Max - s.Min
+}
+
+func (s *Stats) Mid() float64 {
+	return (s.Max + s.Min) / 2
+}
+
 func (s *System) computeStats(getter func(led *LED) float64) *Stats {
 	min := 100000000.0
 	max := -100000000.0
@@ -107,41 +153,112 @@ func (s *System) computeStats(getter func(led *LED) float64) *Stats {
 	}
 }
 
+// Normalize recomputes every LED's X, Y and Z from its physical position
+// using s.Normalization. It always starts from the physical positions, so it
+// is safe to call again after changing the options.
 func (s *System) Normalize() {
-	for _, led := range s.LEDs {
-		led.X = -led.X
+	opts := s.Normalization
+	remapped := func(i int) func(led *LED) float64 {
+		return func(led *LED) float64 {
+			return led.Physical.axis(opts.Axes[i])
+		}
 	}
 
-	s.normalizeOnce.Do(func() {
-		s.XStats = s.computeStats(func(led *LED) float64 {
-			return led.X
-		})
-		s.YStats = s.computeStats(func(led *LED) float64 {
-			return led.Y
-		})
-		s.ZStats = s.computeStats(func(led *LED) float64 {
-			return led.Z
-		})
-
-		for _, led := range s.LEDs {
-			led.X = s.XStats.Convert(led.X)
-			led.Y = s.YStats.Convert(led.Y)
-			led.Z = s.ZStats.Convert(led.Z)
+	s.XStats = s.computeStats(remapped(0))
+	s.YStats = s.computeStats(remapped(1))
+	s.ZStats = s.computeStats(remapped(2))
+	stats := [3]*Stats{s.XStats, s.YStats, s.ZStats}
+
+	var scale float64
+	for _, stat := range stats {
+		if stat.Range() > scale {
+			scale = stat.Range()
 		}
-	})
-}
+	}
 
-func (s *System) DebugGetLEDByCoord(x float64, y float64, z float64) *LED {
-	minDist := 1.0
-	var curVertex *LED
-	for _, v := range s.LEDs {
-		dist := getDistance(x, y, z, v.X, v.Y, v.Z)
-		if dist < minDist {
-			minDist = dist
-			curVertex = v
+	convert := func(i int, val float64) float64 {
+		var v float64
+		if opts.Mode == NormalizeUniform {
+			v = 0.5
+			if scale > 0 {
+				v = (val-stats[i].Mid())/scale + 0.5
+			}
+		} else {
+			v = stats[i].Convert(val)
 		}
+
+		if opts.Flip[i] {
+			v = 1 - v
+		}
+		return v
 	}
-	if curVertex == nil {
+
+	// directions go through the same remapping, flips and scaling as
+	// positions, so they still point the same way relative to the sculpture
+	convertDirection := func(i int, led *LED) float64 {
+		v := led.PhysicalDirection.axis(opts.Axes[i])
+		if opts.Mode == NormalizePerAxis && stats[i].Range() > 0 {
+			v /= stats[i].Range()
+		}
+
+		if opts.Flip[i] {
+			v = -v
+		}
+		return v
+	}
+
+	for _, led := range s.LEDs {
+		led.X = convert(0, remapped(0)(led))
+		led.Y = convert(1, remapped(1)(led))
+		led.Z = convert(2, remapped(2)(led))
+		led.Direction = Vec3{
+			X: convertDirection(0, led),
+			Y: convertDirection(1, led),
+			Z: convertDirection(2, led),
+		}.Unit()
+	}
+
+	s.Spatial = NewSpatialIndex(s.LEDs)
+	s.InvalidateTopology()
+	s.views = nil
+}
+
+// NormalizeWith sets s.Normalization to opts and renormalises.
+func (s *System) NormalizeWith(opts NormalizeOptions) {
+	s.Normalization = opts
+	s.Normalize()
+}
+
+func (s *System) spatial() *SpatialIndex {
+	if s.Spatial == nil || s.Spatial.Len() != len(s.LEDs) {
+		s.Spatial = NewSpatialIndex(s.LEDs)
+	}
+	return s.Spatial
+}
+
+// Nearest returns the LED closest to (x, y, z), or nil if there are no LEDs.
+func (s *System) Nearest(x, y, z float64) *LED {
+	return s.spatial().Nearest(x, y, z)
+}
+
+// KNearest returns up to k LEDs closest to (x, y, z), nearest first.
+func (s *System) KNearest(x, y, z float64, k int) []*LED {
+	return s.spatial().KNearest(x, y, z, k)
+}
+
+// WithinRadius returns every LED within r of (x, y, z).
+func (s *System) WithinRadius(x, y, z, r float64) []*LED {
+	return s.spatial().WithinRadius(x, y, z, r)
+}
+
+// WithinBox returns every LED inside the axis aligned box spanning min to max.
+func (s *System) WithinBox(minX, minY, minZ, maxX, maxY, maxZ float64) []*LED {
+	return s.spatial().WithinBox(minX, minY, minZ, maxX, maxY, maxZ)
+}
+
+func (s *System) DebugGetLEDByCoord(x float64, y float64, z float64) *LED {
+	curVertex := s.Nearest(x, y, z)
+	if curVertex == nil || getDistance(x, y, z, curVertex.X, curVertex.Y, curVertex.Z) >= 1.0 {
 		panic("get vertex by coord failed")
 	}
 	return curVertex
@@ -0,0 +1,373 @@
+package ledsim
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxCachedFields bounds how many distance fields are kept per layout, so
+// effects that seed from random LEDs can't grow the cache forever.
+const maxCachedFields = 64
+
+// topology caches graph analysis results for one layout. It is reset by
+// InvalidateTopology whenever the LEDs, their neighbours or their normalised
+// positions change.
+type topology struct {
+	mutex       sync.Mutex
+	hops        map[string][]int
+	geodesics   map[string][]float64
+	components  [][]*LED
+	componentOf []int
+	junctions   []*LED
+	endpoints   []*LED
+}
+
+func (s *System) topology() *topology {
+	if s.topo == nil {
+		s.topo = &topology{}
+	}
+	return s.topo
+}
+
+// InvalidateTopology drops every cached graph analysis result. Loaders and
+// Normalize call it, it only needs to be called by hand after editing
+// Neighbours directly.
+func (s *System) InvalidateTopology() {
+	t := s.topology()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.hops = nil
+	t.geodesics = nil
+	t.components = nil
+	t.componentOf = nil
+	t.junctions = nil
+	t.endpoints = nil
+}
+
+func seedKey(seeds []*LED) string {
+	ids := make([]int, len(seeds))
+	for i, seed := range seeds {
+		ids[i] = seed.ID
+	}
+	sort.Ints(ids)
+
+	var sb strings.Builder
+	for i, id := range ids {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.Itoa(id))
+	}
+	return sb.String()
+}
+
+// WalkBFS visits every LED reachable from seeds in breadth first order, along
+// with its hop distance from the nearest seed. Seeds are visited at depth 0.
+// LEDs for which blocked returns true are never entered, and the walk stops
+// expanding at maxDepth (a negative maxDepth means no limit). Unlike
+// HopDistances the result is not cached, so it suits walks whose seeds change
+// every frame.
+func (s *System) WalkBFS(seeds []*LED, maxDepth int, blocked func(led *LED) bool, visit func(led *LED, depth int)) {
+	type queueEntry struct {
+		depth int
+		led   *LED
+	}
+
+	seen := make([]bool, s.IDCount())
+	queue := make([]queueEntry, 0, len(seeds))
+	for _, seed := range seeds {
+		if seen[seed.ID] {
+			continue
+		}
+		seen[seed.ID] = true
+		queue = append(queue, queueEntry{depth: 0, led: seed})
+	}
+
+	for len(queue) > 0 {
+		top := queue[0]
+		queue = queue[1:]
+
+		visit(top.led, top.depth)
+
+		if maxDepth >= 0 && top.depth >= maxDepth {
+			continue
+		}
+
+		for _, neighbour := range top.led.Neighbours {
+			if seen[neighbour.ID] {
+				continue
+			}
+			seen[neighbour.ID] = true
+
+			if !s.Contains(neighbour) || (blocked != nil && blocked(neighbour)) {
+				continue
+			}
+
+			queue = append(queue, queueEntry{
+				depth: top.depth + 1,
+				led:   neighbour,
+			})
+		}
+	}
+}
+
+// HopDistances returns the number of edges between every LED and the nearest
+// of seeds, indexed by LED ID. Unreachable LEDs, and LEDs outside a view, are
+// -1. The result is cached and shared, so it must not be modified.
+func (s *System) HopDistances(seeds ...*LED) []int {
+	t := s.topology()
+	key := seedKey(seeds)
+
+	t.mutex.Lock()
+	if dist, found := t.hops[key]; found {
+		t.mutex.Unlock()
+		return dist
+	}
+	t.mutex.Unlock()
+
+	dist := make([]int, s.IDCount())
+	for i := range dist {
+		dist[i] = -1
+	}
+	s.WalkBFS(seeds, -1, nil, func(led *LED, depth int) {
+		dist[led.ID] = depth
+	})
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.hops == nil || len(t.hops) >= maxCachedFields {
+		t.hops = make(map[string][]int)
+	}
+	t.hops[key] = dist
+
+	return dist
+}
+
+func edgeLength(a, b *LED) float64 {
+	return getDistance(a.X, a.Y, a.Z, b.X, b.Y, b.Z)
+}
+
+type geodesicEntry struct {
+	led  *LED
+	dist float64
+}
+
+type geodesicQueue []geodesicEntry
+
+func (q geodesicQueue) Len() int            { return len(q) }
+func (q geodesicQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q geodesicQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *geodesicQueue) Push(x interface{}) { *q = append(*q, x.(geodesicEntry)) }
+func (q *geodesicQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// dijkstra returns the distance along edges from the nearest seed and the
+// previous LED on that path, indexed by LED ID.
+func (s *System) dijkstra(seeds []*LED) ([]float64, []*LED) {
+	dist := make([]float64, s.IDCount())
+	prev := make([]*LED, s.IDCount())
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+
+	queue := &geodesicQueue{}
+	for _, seed := range seeds {
+		dist[seed.ID] = 0
+		heap.Push(queue, geodesicEntry{led: seed, dist: 0})
+	}
+
+	for queue.Len() > 0 {
+		top := heap.Pop(queue).(geodesicEntry)
+		if top.dist > dist[top.led.ID] {
+			continue
+		}
+
+		for _, neighbour := range top.led.Neighbours {
+			if !s.Contains(neighbour) {
+				continue
+			}
+
+			d := top.dist + edgeLength(top.led, neighbour)
+			if d < dist[neighbour.ID] {
+				dist[neighbour.ID] = d
+				prev[neighbour.ID] = top.led
+				heap.Push(queue, geodesicEntry{led: neighbour, dist: d})
+			}
+		}
+	}
+
+	return dist, prev
+}
+
+// GeodesicDistances returns the distance along edges, in normalised units,
+// between every LED and the nearest of seeds, indexed by LED ID. Unreachable
+// LEDs are +Inf. The result is cached and shared, so it must not be modified.
+func (s *System) GeodesicDistances(seeds ...*LED) []float64 {
+	t := s.topology()
+	key := seedKey(seeds)
+
+	t.mutex.Lock()
+	if dist, found := t.geodesics[key]; found {
+		t.mutex.Unlock()
+		return dist
+	}
+	t.mutex.Unlock()
+
+	dist, _ := s.dijkstra(seeds)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.geodesics == nil || len(t.geodesics) >= maxCachedFields {
+		t.geodesics = make(map[string][]float64)
+	}
+	t.geodesics[key] = dist
+
+	return dist
+}
+
+// ShortestPath returns the path from one LED to another with the fewest
+// edges, including both ends, or nil if to is unreachable.
+func (s *System) ShortestPath(from, to *LED) []*LED {
+	// walk back down the distance field from the destination
+	dist := s.HopDistances(from)
+	if dist[to.ID] < 0 {
+		return nil
+	}
+
+	path := make([]*LED, dist[to.ID]+1)
+	current := to
+	for i := len(path) - 1; i > 0; i-- {
+		path[i] = current
+		for _, neighbour := range current.Neighbours {
+			if dist[neighbour.ID] == dist[current.ID]-1 {
+				current = neighbour
+				break
+			}
+		}
+	}
+	path[0] = from
+
+	return path
+}
+
+// GeodesicPath returns the shortest path along edges from one LED to
+// another, including both ends, or nil if to is unreachable.
+func (s *System) GeodesicPath(from, to *LED) []*LED {
+	dist, prev := s.dijkstra([]*LED{from})
+	if math.IsInf(dist[to.ID], 1) {
+		return nil
+	}
+
+	var path []*LED
+	for current := to; current != nil; current = prev[current.ID] {
+		path = append(path, current)
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return path
+}
+
+func (s *System) computeComponents(t *topology) {
+	if t.components != nil {
+		return
+	}
+
+	t.componentOf = make([]int, s.IDCount())
+	for i := range t.componentOf {
+		t.componentOf[i] = -1
+	}
+
+	t.components = [][]*LED{}
+	for _, led := range s.LEDs {
+		if t.componentOf[led.ID] >= 0 {
+			continue
+		}
+
+		var component []*LED
+		s.WalkBFS([]*LED{led}, -1, nil, func(member *LED, depth int) {
+			t.componentOf[member.ID] = len(t.components)
+			component = append(component, member)
+		})
+		t.components = append(t.components, component)
+	}
+
+	sort.SliceStable(t.components, func(i, j int) bool {
+		return len(t.components[i]) > len(t.components[j])
+	})
+	for i, component := range t.components {
+		for _, led := range component {
+			t.componentOf[led.ID] = i
+		}
+	}
+
+	for _, led := range s.LEDs {
+		degree := 0
+		for _, neighbour := range led.Neighbours {
+			if s.Contains(neighbour) {
+				degree++
+			}
+		}
+
+		switch {
+		case degree >= 3:
+			t.junctions = append(t.junctions, led)
+		case degree <= 1:
+			t.endpoints = append(t.endpoints, led)
+		}
+	}
+}
+
+// Components returns the connected components of the LED graph, largest
+// first. The result is cached and shared, so it must not be modified.
+func (s *System) Components() [][]*LED {
+	t := s.topology()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s.computeComponents(t)
+	return t.components
+}
+
+// ComponentOf returns the index into Components of the component led is in.
+func (s *System) ComponentOf(led *LED) int {
+	s.Components()
+
+	t := s.topology()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.componentOf[led.ID]
+}
+
+// Junctions returns the LEDs with three or more neighbours, where the
+// sculpture branches.
+func (s *System) Junctions() []*LED {
+	s.Components()
+
+	t := s.topology()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.junctions
+}
+
+// Endpoints returns the LEDs with at most one neighbour, at the loose ends of
+// the sculpture.
+func (s *System) Endpoints() []*LED {
+	s.Components()
+
+	t := s.topology()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.endpoints
+}